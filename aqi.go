@@ -0,0 +1,183 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// nowCastHours is the number of hourly averages NowCast weighs.
+const nowCastHours = 12
+
+// aqiBreakpoint maps a PM2.5 concentration range in µg/m³ to an AQI range.
+type aqiBreakpoint struct {
+	concLow, concHigh float64
+	aqiLow, aqiHigh   float64
+}
+
+// pm25Breakpoints is the EPA PM2.5 AQI table, as revised in 2024.
+var pm25Breakpoints = []aqiBreakpoint{
+	{0.0, 9.0, 0, 50},
+	{9.1, 35.4, 51, 100},
+	{35.5, 55.4, 101, 150},
+	{55.5, 125.4, 151, 200},
+	{125.5, 225.4, 201, 300},
+	{225.5, 325.4, 301, 500},
+}
+
+// pm25AQI returns the AQI for a PM2.5 concentration in µg/m³. The
+// concentration is truncated to one decimal and values past the table are
+// reported as 500.
+func pm25AQI(conc float64) float64 {
+	conc = math.Floor(math.Max(0, conc)*10) / 10
+	for _, bp := range pm25Breakpoints {
+		if conc <= bp.concHigh {
+			return math.Round((bp.aqiHigh-bp.aqiLow)/(bp.concHigh-bp.concLow)*(conc-bp.concLow) + bp.aqiLow)
+		}
+	}
+	return 500
+}
+
+// aqiCategory is a band of the AQI scale, up to its highest AQI.
+type aqiCategory struct {
+	Name string
+	High float64
+}
+
+var aqiCategories = []aqiCategory{
+	{"Good", 50},
+	{"Moderate", 100},
+	{"Unhealthy for Sensitive Groups", 150},
+	{"Unhealthy", 200},
+	{"Very Unhealthy", 300},
+	{"Hazardous", 500},
+}
+
+// aqiCategoryIndex returns the index in aqiCategories of an AQI.
+func aqiCategoryIndex(aqi float64) int {
+	for i, category := range aqiCategories {
+		if aqi <= category.High {
+			return i
+		}
+	}
+	return len(aqiCategories) - 1
+}
+
+type pmHour struct {
+	start time.Time
+	sum   float64
+	count int
+}
+
+// AQIHistory keeps hourly PM2.5 averages for NowCast.
+type AQIHistory struct {
+	mu    sync.Mutex
+	hours []pmHour
+}
+
+// add records a reading in the average of the hour it was taken in, which
+// may be older than the latest one for a backfilled reading.
+func (h *AQIHistory) add(t time.Time, pm25 float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start := t.Truncate(time.Hour)
+	i := sort.Search(len(h.hours), func(i int) bool { return !h.hours[i].start.Before(start) })
+	if i == len(h.hours) || !h.hours[i].start.Equal(start) {
+		h.hours = append(h.hours, pmHour{})
+		copy(h.hours[i+1:], h.hours[i:])
+		h.hours[i] = pmHour{start: start}
+	}
+	h.hours[i].sum += pm25
+	h.hours[i].count++
+
+	cutoff := h.hours[len(h.hours)-1].start.Add(-(nowCastHours - 1) * time.Hour)
+	for len(h.hours) > 0 && h.hours[0].start.Before(cutoff) {
+		h.hours = h.hours[1:]
+	}
+}
+
+// nowCast returns the EPA NowCast concentration over the last 12 hours,
+// counting the current hour as the most recent one, and false unless at
+// least two of the three most recent hours have readings.
+func (h *AQIHistory) nowCast() (float64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.hours) == 0 {
+		return 0, false
+	}
+
+	latest := h.hours[len(h.hours)-1].start
+	averages := map[int]float64{}
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, hour := range h.hours {
+		age := int(latest.Sub(hour.start) / time.Hour)
+		average := hour.sum / float64(hour.count)
+		averages[age] = average
+		min = math.Min(min, average)
+		max = math.Max(max, average)
+	}
+
+	recent := 0
+	for age := 0; age < 3; age++ {
+		if _, ok := averages[age]; ok {
+			recent++
+		}
+	}
+	if recent < 2 {
+		return 0, false
+	}
+
+	weight := 1.0
+	if max > 0 {
+		weight = math.Max(min/max, 0.5)
+	}
+
+	var sum, weights float64
+	for age, average := range averages {
+		w := math.Pow(weight, float64(age))
+		sum += w * average
+		weights += w
+	}
+	return sum / weights, true
+}
+
+func (app *App) initializeAQIMetrics() {
+	app.PM25AQIGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: app.MetricSubsystem,
+		Name:      "pm25_aqi",
+		Help:      "US EPA Air Quality Index computed from PM2.5, using NowCast with --aqi-nowcast",
+	}, app.deviceLabelNames())
+}
+
+// recordAQI refreshes the device's AQI from a reading. With NowCast the AQI
+// is missing until two of the last three hours have readings. A reading
+// without pm25 removes the AQI of the latest reading, while NowCast keeps
+// its hourly averages.
+func (app *App) recordAQI(device *Device, stats AwairStats) {
+	if !device.Profile.has("pm25") {
+		return
+	}
+	if !hasField(stats, "pm25") {
+		if !app.AQINowCast {
+			app.PM25AQIGauge.Delete(device.Labels)
+		}
+		return
+	}
+
+	if !app.AQINowCast {
+		app.PM25AQIGauge.With(device.Labels).Set(pm25AQI(float64(stats.Pm25)))
+		return
+	}
+
+	device.AQIHistory.add(readingTime(stats), float64(stats.Pm25))
+	if conc, ok := device.AQIHistory.nowCast(); ok {
+		app.PM25AQIGauge.With(device.Labels).Set(pm25AQI(conc))
+	}
+}
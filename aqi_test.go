@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPM25AQI(t *testing.T) {
+	tests := []struct {
+		conc float64
+		want float64
+	}{
+		{-1, 0},
+		{0, 0},
+		{9.0, 50},
+		// Concentrations are truncated to one decimal before the lookup.
+		{9.05, 50},
+		{9.1, 51},
+		{12.0, 56},
+		{35.4, 100},
+		{35.5, 101},
+		{55.4, 150},
+		{55.5, 151},
+		{125.4, 200},
+		{225.4, 300},
+		{325.4, 500},
+		{600, 500},
+	}
+	for _, tt := range tests {
+		if got := pm25AQI(tt.conc); got != tt.want {
+			t.Errorf("pm25AQI(%v) = %v, want %v", tt.conc, got, tt.want)
+		}
+	}
+}
+
+func TestNowCast(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// reading is a PM2.5 reading taken the given number of hours ago.
+	type reading struct {
+		hoursAgo int
+		pm25     float64
+	}
+	tests := []struct {
+		name     string
+		readings []reading
+		want     float64
+		ok       bool
+	}{
+		{
+			name: "no readings",
+		},
+		{
+			name:     "one hour",
+			readings: []reading{{0, 10}},
+		},
+		{
+			name:     "two of the three most recent hours",
+			readings: []reading{{2, 10}, {0, 10}},
+			want:     10,
+			ok:       true,
+		},
+		{
+			name:     "only one of the three most recent hours",
+			readings: []reading{{5, 10}, {4, 10}, {3, 10}, {0, 10}},
+		},
+		{
+			name:     "hourly averages",
+			readings: []reading{{1, 8}, {1, 12}, {0, 20}},
+			want:     (20 + 0.5*10) / 1.5,
+			ok:       true,
+		},
+		{
+			name:     "weight factor ratio",
+			readings: []reading{{1, 15}, {0, 20}},
+			want:     (20 + 0.75*15) / 1.75,
+			ok:       true,
+		},
+		{
+			name:     "weight factor floored at one half",
+			readings: []reading{{1, 10}, {0, 40}},
+			want:     (40 + 0.5*10) / 1.5,
+			ok:       true,
+		},
+		{
+			name:     "hours past the window dropped",
+			readings: []reading{{12, 1000}, {1, 10}, {0, 10}},
+			want:     10,
+			ok:       true,
+		},
+		{
+			name:     "backfilled hours",
+			readings: []reading{{0, 20}, {1, 8}, {1, 12}},
+			want:     (20 + 0.5*10) / 1.5,
+			ok:       true,
+		},
+		{
+			name:     "backfilled hour past the window",
+			readings: []reading{{1, 10}, {0, 10}, {12, 1000}},
+			want:     10,
+			ok:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &AQIHistory{}
+			for _, r := range tt.readings {
+				h.add(start.Add(time.Duration(12-r.hoursAgo)*time.Hour), r.pm25)
+			}
+			got, ok := h.nowCast()
+			if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("nowCast() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRecordAQIMissingPM25(t *testing.T) {
+	app := &App{PM25AQIGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pm25_aqi"}, []string{"device"})}
+	device := newDevice("office", "http://office")
+	device.Labels = prometheus.Labels{"device": "office"}
+	device.Profile = knownFields
+
+	app.recordAQI(device, AwairStats{Pm25: 12})
+	if got := testutil.ToFloat64(app.PM25AQIGauge.With(device.Labels)); got != 56 {
+		t.Fatalf("AQI = %v, want 56", got)
+	}
+
+	stats := AwairStats{}
+	if err := json.Unmarshal([]byte(`{"temp": 21.5}`), &stats); err != nil {
+		t.Fatal(err)
+	}
+	app.recordAQI(device, stats)
+	if n := testutil.CollectAndCount(app.PM25AQIGauge); n != 0 {
+		t.Errorf("AQI series after a reading without pm25 = %d, want 0", n)
+	}
+}
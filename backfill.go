@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// cloudBackfillChunk is the longest range of 5-minute averages the
+	// cloud API returns in one request.
+	cloudBackfillChunk = 24 * time.Hour
+	// cloudBackfillLimit is the number of 5-minute averages in a chunk.
+	cloudBackfillLimit = 288
+)
+
+// errHistoryFound stops the scan of a device's stored readings at the first
+// one.
+var errHistoryFound = errors.New("history found")
+
+// validateCloudBackfill checks --awair-cloud-backfill. matched reports
+// whether the devices have a cloud device to backfill from, which devices
+// polled locally only have with --awair-cloud-inventory.
+func validateCloudBackfill(backfill time.Duration, token string, matched bool) error {
+	switch {
+	case backfill < 0:
+		return errors.New("awair-cloud-backfill must not be negative")
+	case backfill > 0 && token == "":
+		return errors.New("awair-cloud-backfill requires awair-cloud-token")
+	case backfill > 0 && !matched:
+		return errors.New("awair-cloud-backfill of devices polled locally requires awair-cloud-inventory")
+	}
+	return nil
+}
+
+// hasHistory reports whether the history store has readings of the device
+// taken before t.
+func hasHistory(store readingStore, name string, t time.Time) (bool, error) {
+	err := store.Readings(name, time.Unix(0, 0), t.Add(-time.Nanosecond), func(AwairStats) error {
+		return errHistoryFound
+	})
+	if errors.Is(err, errHistoryFound) {
+		return true, nil
+	}
+	return false, err
+}
+
+// backfillAddress returns the URL of the device's 5-minute averages in the
+// cloud API, or "" when the account has no device with its UUID.
+func (app *App) backfillAddress(ctx context.Context, device *Device) (string, error) {
+	if device.Cloud {
+		return strings.TrimSuffix(device.Address, "/latest") + "/5-min-avg", nil
+	}
+
+	uuid := device.UUID()
+	if uuid == "" {
+		// The device info task may not have fetched the UUID yet.
+		config, err := app.fetchDeviceConfig(ctx, device)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch device UUID: %w", err)
+		}
+		uuid = config.DeviceUUID
+	}
+	for _, cloud := range app.CloudInventory {
+		if cloud.DeviceUUID == uuid {
+			return app.cloudAirDataAddress(cloud, "5-min-avg"), nil
+		}
+	}
+	return "", nil
+}
+
+// fetchCloudAirData fetches the data points of a cloud air data endpoint
+// between from and to, oldest first.
+func (app *App) fetchCloudAirData(ctx context.Context, address string, from, to time.Time) ([]cloudAirDataPoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, cloudRequestTimeout)
+	defer cancel()
+
+	query := url.Values{}
+	query.Set("from", from.UTC().Format(time.RFC3339))
+	query.Set("to", to.UTC().Format(time.RFC3339))
+	query.Set("limit", fmt.Sprint(cloudBackfillLimit))
+	query.Set("desc", "false")
+	req, err := app.cloudRequest(ctx, address+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := app.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkCloudResponse(resp); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	airData := cloudAirData{}
+	if err := json.Unmarshal(body, &airData); err != nil {
+		return nil, fmt.Errorf("failed to parse Awair Cloud air data: %w", err)
+	}
+	return airData.Data, nil
+}
+
+// fetchCloudHistory fetches the device's 5-minute averages between from and
+// to a day at a time, as local API payloads oldest first.
+func (app *App) fetchCloudHistory(ctx context.Context, address string, from, to time.Time) ([][]byte, error) {
+	payloads := [][]byte{}
+	for start := from; start.Before(to); start = start.Add(cloudBackfillChunk) {
+		end := start.Add(cloudBackfillChunk)
+		if end.After(to) {
+			end = to
+		}
+
+		points, err := app.fetchCloudAirData(ctx, address, start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range points {
+			payload, err := point.payload()
+			if err != nil {
+				return nil, err
+			}
+			payloads = append(payloads, payload)
+		}
+	}
+	return payloads, nil
+}
+
+// runBackfill waits for the device's first reading, then backfills the
+// readings taken before it. Polls go on while the cloud is fetched.
+func (app *App) runBackfill(ctx context.Context, device *Device) {
+	var first time.Time
+	select {
+	case first = <-device.firstReading:
+	case <-ctx.Done():
+		return
+	}
+
+	if err := app.backfill(ctx, device, first); err != nil && ctx.Err() == nil {
+		app.Logger.Error("Error backfilling readings from the Awair Cloud", zap.String("device", device.Name), zap.Error(err))
+	}
+}
+
+// backfill seeds the device's history store, history buffer and derived
+// metrics with the --awair-cloud-backfill of cloud readings taken before
+// the first reading at to, unless the history store already has readings
+// of the device from before then. The readings are recorded under the poll
+// lock, as the derived metrics need the device profile.
+func (app *App) backfill(ctx context.Context, device *Device, to time.Time) error {
+	store, _ := app.Sinks["history"].(readingStore)
+	if store != nil {
+		found, err := hasHistory(store, device.Name, to)
+		if err != nil || found {
+			return err
+		}
+	}
+
+	address, err := app.backfillAddress(ctx, device)
+	if err != nil {
+		return err
+	}
+	if address == "" {
+		return errors.New("no Awair Cloud device with the device UUID")
+	}
+
+	payloads, err := app.fetchCloudHistory(ctx, address, to.Add(-app.CloudBackfill), to)
+	if err != nil {
+		return err
+	}
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	// The cloud only reports the sensors, so the derived metrics of the
+	// local-only fields must not be fed zeros.
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(payloads[0], &fields); err != nil {
+		return err
+	}
+	cloudProfile := presentFieldsProfile("cloud", fields)
+
+	readings := []AwairStats{}
+	for _, payload := range payloads {
+		stats := AwairStats{}
+		if err := json.Unmarshal(payload, &stats); err != nil {
+			return err
+		}
+		if readingTime(stats).Before(to) {
+			readings = append(readings, stats)
+		}
+	}
+
+	select {
+	case device.pollLock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-device.pollLock }()
+
+	profile := device.Profile
+	defer func() { device.Profile = profile }()
+	device.Profile = deviceProfile{Name: profile.Name}
+	for _, field := range profile.Fields {
+		if cloudProfile.has(field) {
+			device.Profile.Fields = append(device.Profile.Fields, field)
+		}
+	}
+
+	for _, stats := range readings {
+		app.recordScoreTrend(device, stats)
+		// The AQI of the latest reading is already exported, only NowCast
+		// looks back.
+		if app.AQINowCast && device.Profile.has("pm25") && hasField(stats, "pm25") {
+			device.AQIHistory.add(readingTime(stats), float64(stats.Pm25))
+		}
+		app.recordRollingAverages(device, stats)
+		app.recordReport(device, stats)
+		device.History.add(stats)
+		if sink, ok := app.Sinks["history"]; ok {
+			if err := sink.Publish(ctx, device, stats); err != nil {
+				return fmt.Errorf("failed to store backfilled reading: %w", err)
+			}
+		}
+	}
+
+	app.Logger.Info("Backfilled readings from the Awair Cloud", zap.String("device", device.Name), zap.Int("readings", len(readings)))
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestValidateCloudBackfill(t *testing.T) {
+	tests := []struct {
+		backfill time.Duration
+		token    string
+		matched  bool
+		wantErr  bool
+	}{
+		{0, "", false, false},
+		{time.Hour, "token", true, false},
+		{-time.Hour, "token", true, true},
+		{time.Hour, "", true, true},
+		{time.Hour, "token", false, true},
+	}
+	for _, tt := range tests {
+		if err := validateCloudBackfill(tt.backfill, tt.token, tt.matched); (err != nil) != tt.wantErr {
+			t.Errorf("validateCloudBackfill(%s, %q, %v) = %v, want error %v", tt.backfill, tt.token, tt.matched, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFetchCloudHistory(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		from, _ := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+		to, _ := time.Parse(time.RFC3339, r.URL.Query().Get("to"))
+		if to.Sub(from) > cloudBackfillChunk {
+			t.Errorf("requested %s of averages, want at most %s", to.Sub(from), cloudBackfillChunk)
+		}
+
+		airData := cloudAirData{}
+		for at := from; at.Before(to); at = at.Add(5 * time.Minute) {
+			airData.Data = append(airData.Data, cloudAirDataPoint{Timestamp: at, Score: 80})
+		}
+		json.NewEncoder(w).Encode(airData)
+	}))
+	defer server.Close()
+
+	app := &App{Client: server.Client()}
+	to := time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC)
+	payloads, err := app.fetchCloudHistory(context.Background(), server.URL, to.Add(-30*time.Hour), to)
+	if err != nil {
+		t.Fatalf("fetchCloudHistory() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2", requests)
+	}
+	if len(payloads) != 360 {
+		t.Fatalf("fetchCloudHistory() returned %d readings, want 360", len(payloads))
+	}
+
+	var first, last AwairStats
+	json.Unmarshal(payloads[0], &first)
+	json.Unmarshal(payloads[len(payloads)-1], &last)
+	if !first.Timestamp.Equal(to.Add(-30*time.Hour)) || !last.Timestamp.Equal(to.Add(-5*time.Minute)) {
+		t.Errorf("readings span %s to %s, want oldest first", first.Timestamp, last.Timestamp)
+	}
+}
+
+func TestRunBackfill(t *testing.T) {
+	first := time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, _ := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+		to, _ := time.Parse(time.RFC3339, r.URL.Query().Get("to"))
+		airData := cloudAirData{}
+		for at := from; !at.After(to); at = at.Add(5 * time.Minute) {
+			airData.Data = append(airData.Data, cloudAirDataPoint{Timestamp: at, Score: 60})
+		}
+		json.NewEncoder(w).Encode(airData)
+	}))
+	defer server.Close()
+
+	app := &App{
+		Client:           server.Client(),
+		Logger:           zap.NewNop(),
+		CloudBackfill:    2 * time.Hour,
+		Location:         time.UTC,
+		ScoreDeltaGauges: map[string]*prometheus.GaugeVec{},
+	}
+	for _, w := range scoreDeltaWindows {
+		app.ScoreDeltaGauges[w.name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "score_delta_" + w.name}, []string{"device"})
+	}
+	device := newDevice("office", server.URL+"/latest")
+	device.Cloud = true
+	device.Labels = prometheus.Labels{"device": "office"}
+	device.Profile = knownFields
+	device.History.init(100)
+	device.firstReading = make(chan time.Time, 1)
+
+	// The first poll and the one after are recorded before the backfill.
+	for _, stats := range []AwairStats{{Timestamp: first, Score: 90}, {Timestamp: first.Add(5 * time.Minute), Score: 90}} {
+		app.recordScoreTrend(device, stats)
+		device.History.add(stats)
+	}
+	device.firstReading <- first
+	app.runBackfill(context.Background(), device)
+
+	readings := device.History.since(time.Time{})
+	if len(readings) != 26 {
+		t.Fatalf("history has %d readings, want 26", len(readings))
+	}
+	if !readings[0].Timestamp.Equal(first.Add(-2*time.Hour)) || !readings[len(readings)-1].Timestamp.Equal(first.Add(5*time.Minute)) {
+		t.Errorf("history spans %s to %s, want oldest first", readings[0].Timestamp, readings[len(readings)-1].Timestamp)
+	}
+	// The delta is still that of the latest reading, against a backfilled one.
+	if got := testutil.ToFloat64(app.ScoreDeltaGauges["1h"].With(device.Labels)); got != 30 {
+		t.Errorf("score_delta_1h = %v, want 30", got)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Sensors whose baselines are tracked for drift. The SGP gas sensor slowly
+// re-baselines itself, which skews TVOC and eCO2 without any visible error.
+const (
+	baselineSensorVOC    = "voc"
+	baselineSensorCo2Est = "co2_est"
+)
+
+// minBaselineDays is the number of completed days needed before a drift
+// slope is reported.
+const minBaselineDays = 2
+
+// dailyMean accumulates the readings taken on a single day.
+type dailyMean struct {
+	day   time.Time
+	sum   float64
+	count int
+}
+
+func (d dailyMean) mean() float64 {
+	return d.sum / float64(d.count)
+}
+
+// baselineHistory keeps daily means of one baseline value.
+type baselineHistory struct {
+	days []dailyMean
+}
+
+// add records a value, starting a new day when day differs from the last
+// one seen, and drops days that fall out of the window.
+func (h *baselineHistory) add(day time.Time, value float64, window int) {
+	if n := len(h.days); n > 0 && h.days[n-1].day.Equal(day) {
+		h.days[n-1].sum += value
+		h.days[n-1].count++
+		return
+	}
+
+	h.days = append(h.days, dailyMean{day: day, sum: value, count: 1})
+	// Keep one extra entry for the day in progress.
+	if excess := len(h.days) - (window + 1); excess > 0 {
+		h.days = h.days[excess:]
+	}
+}
+
+// completed returns the days that have finished, excluding the one in
+// progress.
+func (h *baselineHistory) completed() []dailyMean {
+	if len(h.days) == 0 {
+		return nil
+	}
+	return h.days[:len(h.days)-1]
+}
+
+// slopePerDay fits a least-squares line through the daily means and returns
+// its slope in units per day.
+func slopePerDay(days []dailyMean) float64 {
+	n := float64(len(days))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, d := range days {
+		x := d.day.Sub(days[0].day).Hours() / 24
+		y := d.mean()
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// BaselineTracker follows the long-term trend of the gas sensor baselines.
+type BaselineTracker struct {
+	mu      sync.Mutex
+	history map[string]*baselineHistory
+	alerted map[string]bool
+}
+
+func (app *App) initializeBaselineMetrics() {
+	app.BaselineDailyMeanGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "baseline",
+		Name:      "daily_mean",
+		Help:      "Mean of the sensor baseline over the last completed day",
+	}, append(app.deviceLabelNames(), "sensor"))
+
+	app.BaselineDriftGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "baseline",
+		Name:      "drift_per_day",
+		Help:      "Slope of the daily sensor baseline means over the drift window (units per day)",
+	}, append(app.deviceLabelNames(), "sensor"))
+
+	app.BaselineDriftAlertGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "baseline",
+		Name:      "drift_alert",
+		Help:      "Whether the baseline drift exceeds --baseline-drift-threshold (1) or not (0)",
+	}, append(app.deviceLabelNames(), "sensor"))
+}
+
+func baselineLabels(device *Device, sensor string) prometheus.Labels {
+	labels := prometheus.Labels{"sensor": sensor}
+	for name, value := range device.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+func (app *App) deleteBaselineSeries(device *Device) {
+	for _, sensor := range []string{baselineSensorVOC, baselineSensorCo2Est} {
+		labels := baselineLabels(device, sensor)
+		app.BaselineDailyMeanGauge.Delete(labels)
+		app.BaselineDriftGauge.Delete(labels)
+		app.BaselineDriftAlertGauge.Delete(labels)
+	}
+}
+
+// readingTime returns when a reading was sampled, falling back to now for
+// payloads without a timestamp.
+func readingTime(stats AwairStats) time.Time {
+	if stats.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return stats.Timestamp
+}
+
+// recordBaselines adds the baselines from a reading to the daily history and
+// refreshes the drift metrics.
+func (app *App) recordBaselines(device *Device, stats AwairStats) {
+	sampleTime := readingTime(stats).In(app.Location)
+	day := time.Date(sampleTime.Year(), sampleTime.Month(), sampleTime.Day(), 0, 0, 0, 0, app.Location)
+
+	if device.Profile.has("voc_baseline") {
+		app.recordBaseline(device, baselineSensorVOC, day, float64(stats.VocBaseline))
+	}
+	if device.Profile.has("co2_est_baseline") {
+		app.recordBaseline(device, baselineSensorCo2Est, day, float64(stats.Co2EstBaseline))
+	}
+}
+
+func (app *App) recordBaseline(device *Device, sensor string, day time.Time, value float64) {
+	t := &device.Baselines
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	history, ok := t.history[sensor]
+	if !ok {
+		history = &baselineHistory{}
+		t.history[sensor] = history
+	}
+	history.add(day, value, app.BaselineDriftWindow)
+
+	completed := history.completed()
+	if len(completed) == 0 {
+		return
+	}
+
+	sensorLabels := baselineLabels(device, sensor)
+	app.BaselineDailyMeanGauge.With(sensorLabels).Set(completed[len(completed)-1].mean())
+
+	if len(completed) < minBaselineDays {
+		return
+	}
+	slope := slopePerDay(completed)
+	app.BaselineDriftGauge.With(sensorLabels).Set(slope)
+
+	if app.BaselineDriftThreshold <= 0 {
+		return
+	}
+
+	alert := math.Abs(slope) > app.BaselineDriftThreshold
+	if alert {
+		app.BaselineDriftAlertGauge.With(sensorLabels).Set(1)
+	} else {
+		app.BaselineDriftAlertGauge.With(sensorLabels).Set(0)
+	}
+
+	if alert && !t.alerted[sensor] {
+		app.Logger.Warn("Sensor baseline is drifting",
+			zap.String("device", device.Name),
+			zap.String("sensor", sensor),
+			zap.Float64("drift_per_day", slope),
+			zap.Float64("threshold", app.BaselineDriftThreshold),
+			zap.Int("days", len(completed)),
+		)
+	}
+	t.alerted[sensor] = alert
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func (app *App) initializeBreakerMetrics() {
+	app.DeviceUpGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Name:      "device_up",
+		Help:      "Whether the device is reachable (1) or its circuit breaker is open (0)",
+	}, app.deviceLabelNames())
+}
+
+// updateBreaker opens the device's circuit breaker after --breaker-failures
+// consecutive failed polls and closes it on the next successful one. Without
+// a breaker the device is up whenever its last poll succeeded.
+func (app *App) updateBreaker(device *Device, err error) {
+	if app.BreakerFailures <= 0 {
+		app.DeviceUpGauge.With(device.Labels).Set(boolToFloat(err == nil))
+		return
+	}
+
+	switch {
+	case err == nil && device.breakerOpen.Load():
+		device.breakerOpen.Store(false)
+		app.Logger.Info("Device is reachable again, closing circuit breaker", zap.String("device", device.Name))
+	case err != nil && !device.breakerOpen.Load() && device.Status.ConsecutiveFailures() >= app.BreakerFailures:
+		device.breakerOpen.Store(true)
+		app.Logger.Error("Device is unreachable, opening circuit breaker",
+			zap.String("device", device.Name),
+			zap.Int("failures", app.BreakerFailures),
+			zap.Duration("retry_interval", app.BreakerInterval),
+			zap.Error(err))
+	}
+	app.DeviceUpGauge.With(device.Labels).Set(boolToFloat(!device.breakerOpen.Load()))
+}
+
+// pollInterval returns how long to wait before the next poll of the device,
+// which is --breaker-interval while its circuit breaker is open. With
+// --poll-backoff-max the interval doubles with every consecutive failed
+// poll after the first, up to that maximum, until a poll succeeds.
+func (app *App) pollInterval(device *Device) time.Duration {
+	if device.breakerOpen.Load() {
+		return app.BreakerInterval
+	}
+
+	interval := app.pollFrequency(device)
+	failures := device.Status.ConsecutiveFailures()
+	if app.PollBackoffMax <= interval || failures < 2 {
+		return interval
+	}
+	for ; failures > 1 && interval < app.PollBackoffMax; failures-- {
+		interval *= 2
+	}
+	if interval > app.PollBackoffMax {
+		interval = app.PollBackoffMax
+	}
+	return interval
+}
+
+// logPollError logs a failed poll, at debug level while the circuit breaker
+// is open so an offline device does not flood the logs.
+func (app *App) logPollError(device *Device, msg string, err error) {
+	level := zapcore.ErrorLevel
+	if device.breakerOpen.Load() {
+		level = zapcore.DebugLevel
+	}
+	if ce := app.Logger.Check(level, msg); ce != nil {
+		ce.Write(zap.String("device", device.Name), zap.Error(err))
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
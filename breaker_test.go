@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	app := newTestApp(t, "--breaker-failures=2", "--breaker-interval=10m", "--poll-frequency=10s", "--retry-attempts=1")
+	fake := newFakeDevice(t)
+	device := addTestDevice(app, "office", fake.address())
+	ctx := context.Background()
+
+	fake.status.Store(http.StatusServiceUnavailable)
+	for i := 1; i <= 2; i++ {
+		if err := app.poll(ctx, device); err == nil {
+			t.Fatal("poll() of a failing device succeeded")
+		}
+		wantOpen := i == 2
+		if got := device.breakerOpen.Load(); got != wantOpen {
+			t.Errorf("breaker open after %d failed polls = %v, want %v", i, got, wantOpen)
+		}
+	}
+	if got := testutil.ToFloat64(app.DeviceUpGauge.With(device.Labels)); got != 0 {
+		t.Errorf("device_up with the breaker open = %v, want 0", got)
+	}
+	if got := app.pollInterval(device); got != 10*time.Minute {
+		t.Errorf("pollInterval() with the breaker open = %s, want --breaker-interval", got)
+	}
+
+	fake.status.Store(http.StatusOK)
+	if err := app.poll(ctx, device); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+	if device.breakerOpen.Load() {
+		t.Error("breaker still open after a successful poll")
+	}
+	if got := testutil.ToFloat64(app.DeviceUpGauge.With(device.Labels)); got != 1 {
+		t.Errorf("device_up with the breaker closed = %v, want 1", got)
+	}
+	if got := app.pollInterval(device); got != 10*time.Second {
+		t.Errorf("pollInterval() with the breaker closed = %s, want --poll-frequency", got)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	app := newTestApp(t, "--breaker-failures=0", "--retry-attempts=1")
+	fake := newFakeDevice(t)
+	device := addTestDevice(app, "office", fake.address())
+
+	fake.status.Store(http.StatusServiceUnavailable)
+	for i := 0; i < 10; i++ {
+		app.poll(context.Background(), device)
+	}
+	if device.breakerOpen.Load() {
+		t.Error("breaker opened with --breaker-failures=0")
+	}
+	if got := testutil.ToFloat64(app.DeviceUpGauge.With(device.Labels)); got != 0 {
+		t.Errorf("device_up after a failed poll = %v, want 0", got)
+	}
+}
+
+func TestPollIntervalBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      string
+		failures int
+		want     time.Duration
+	}{
+		{"disabled", "0s", 5, 10 * time.Second},
+		{"no failures", "1m", 0, 10 * time.Second},
+		{"first failure", "1m", 1, 10 * time.Second},
+		{"second failure", "1m", 2, 20 * time.Second},
+		{"third failure", "1m", 3, 40 * time.Second},
+		{"capped", "1m", 4, time.Minute},
+		{"many failures", "1m", 100, time.Minute},
+		{"max below frequency", "5s", 5, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, "--poll-frequency=10s", "--poll-backoff-max="+tt.max)
+			device := addTestDevice(app, "office", "http://office")
+			device.Status.consecutiveFailures = tt.failures
+
+			if got := app.pollInterval(device); got != tt.want {
+				t.Errorf("pollInterval() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// calibrationSensors are the measured payload fields offsets apply to. The
+// others are derived by the device from them.
+var calibrationSensors = []string{"temp", "humid", "co2", "voc", "pm25"}
+
+// deviceOffsetSensors are the payload fields the offsets and scales of a
+// device in the config file apply to.
+var deviceOffsetSensors = []string{"temp", "humid", "co2"}
+
+func isDeviceOffsetSensor(sensor string) bool {
+	for _, s := range deviceOffsetSensors {
+		if s == sensor {
+			return true
+		}
+	}
+	return false
+}
+
+// calibrationMinSamples is the number of paired readings needed before an
+// offset is computed for a sensor.
+const calibrationMinSamples = 10
+
+// calibrationFile is the format of the --calibration-file.
+type calibrationFile struct {
+	Devices map[string]deviceCalibration `yaml:"devices"`
+}
+
+// deviceCalibration is the calibration of a device against a reference. The
+// offsets are added to its readings; the residuals are the standard
+// deviation of the differences left once they are, i.e. how closely the
+// device tracked the reference.
+type deviceCalibration struct {
+	Reference    string             `yaml:"reference,omitempty"`
+	CalibratedAt time.Time          `yaml:"calibrated_at,omitempty"`
+	Offsets      map[string]float64 `yaml:"offsets"`
+	Residuals    map[string]float64 `yaml:"residuals,omitempty"`
+}
+
+func loadCalibration(path string) (calibrationFile, error) {
+	file := calibrationFile{Devices: map[string]deviceCalibration{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return file, fmt.Errorf("failed to read calibration file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("failed to parse calibration file %s: %w", path, err)
+	}
+	if file.Devices == nil {
+		file.Devices = map[string]deviceCalibration{}
+	}
+	for name, calibration := range file.Devices {
+		for sensor := range calibration.Offsets {
+			if !isCalibrationSensor(sensor) {
+				return file, fmt.Errorf("invalid calibration of %s: unknown sensor %q", name, sensor)
+			}
+		}
+	}
+	return file, nil
+}
+
+func isCalibrationSensor(sensor string) bool {
+	for _, s := range calibrationSensors {
+		if s == sensor {
+			return true
+		}
+	}
+	return false
+}
+
+// calibrationStats accumulates the differences between the reference's and a
+// device's readings of a sensor.
+type calibrationStats struct {
+	n     int
+	sum   float64
+	sumSq float64
+}
+
+func (s *calibrationStats) add(difference float64) {
+	s.n++
+	s.sum += difference
+	s.sumSq += difference * difference
+}
+
+// offset returns the mean difference and the standard deviation around it.
+func (s calibrationStats) offset() (offset, residual float64) {
+	offset = s.sum / float64(s.n)
+	variance := s.sumSq/float64(s.n) - offset*offset
+	return offset, math.Sqrt(math.Max(variance, 0))
+}
+
+// calibrationRun compares the readings of co-located devices with those of
+// the reference device until it ends.
+type calibrationRun struct {
+	reference string
+	// devices are the co-located devices, every other device when empty.
+	devices map[string]bool
+	end     time.Time
+
+	mu    sync.Mutex
+	stats map[string]map[string]*calibrationStats
+}
+
+func (r *calibrationRun) includes(device *Device) bool {
+	if device.Name == r.reference {
+		return false
+	}
+	return len(r.devices) == 0 || r.devices[device.Name]
+}
+
+// initializeCalibration loads the calibration file and prepares the
+// co-location calibration of the devices polled from startup.
+func (app *App) initializeCalibration(devices []*Device) error {
+	if app.CalibrationFile == "" {
+		if app.CalibrateReference != "" {
+			return fmt.Errorf("calibrate-reference requires calibration-file")
+		}
+		return nil
+	}
+
+	file, err := loadCalibration(app.CalibrationFile)
+	if err != nil {
+		return err
+	}
+	app.calibration = file
+
+	if app.CalibrateReference == "" {
+		return nil
+	}
+	if app.CalibrateDuration <= 0 {
+		return fmt.Errorf("calibrate-duration must be positive")
+	}
+	run := &calibrationRun{
+		reference: app.CalibrateReference,
+		devices:   map[string]bool{},
+		end:       time.Now().Add(app.CalibrateDuration),
+		stats:     map[string]map[string]*calibrationStats{},
+	}
+	polled := map[string]bool{}
+	for _, device := range devices {
+		polled[device.Name] = true
+	}
+	// Discovered devices only show up once found.
+	for _, name := range append([]string{app.CalibrateReference}, app.CalibrateDevices...) {
+		if !polled[name] && !app.Discover {
+			return fmt.Errorf("calibrated device %q is not polled", name)
+		}
+	}
+	for _, name := range app.CalibrateDevices {
+		if name == app.CalibrateReference {
+			return fmt.Errorf("calibrate-devices must not include the reference %q", name)
+		}
+		run.devices[name] = true
+	}
+	app.calibrationRun = run
+	return nil
+}
+
+func (app *App) initializeCalibrationMetrics() {
+	app.CalibrationOffsetGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "calibration",
+		Name:      "offset",
+		Help:      "Offset added to the sensor's readings from the device's offsets in --config or --calibration-file",
+	}, append(app.deviceLabelNames(), "sensor"))
+
+	app.CalibrationScaleGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "calibration",
+		Name:      "scale",
+		Help:      "Factor the sensor's readings are multiplied by before the offset is added, from the device's scales in --config",
+	}, append(app.deviceLabelNames(), "sensor"))
+
+	app.CalibrationResidualGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "calibration",
+		Name:      "residual",
+		Help:      "Standard deviation of the difference from the reference device left after the offset, from the last co-location calibration",
+	}, append(app.deviceLabelNames(), "sensor"))
+}
+
+func calibrationLabels(device *Device, sensor string) prometheus.Labels {
+	labels := prometheus.Labels{"sensor": sensor}
+	for name, value := range device.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// deviceCalibration returns the device's calibration from the file.
+func (app *App) deviceCalibration(device *Device) deviceCalibration {
+	app.calibrationMu.RLock()
+	defer app.calibrationMu.RUnlock()
+	return app.calibration.Devices[device.Name]
+}
+
+// deviceOffsets returns the offsets added to the device's readings, those
+// of the calibration file overridden by those of the config file.
+func (app *App) deviceOffsets(device *Device) map[string]float64 {
+	offsets := map[string]float64{}
+	for sensor, offset := range app.deviceCalibration(device).Offsets {
+		offsets[sensor] = offset
+	}
+	app.devicesMu.RLock()
+	defer app.devicesMu.RUnlock()
+	for sensor, offset := range device.Offsets {
+		offsets[sensor] = offset
+	}
+	return offsets
+}
+
+// deviceScales returns the factors the device's readings are multiplied by.
+func (app *App) deviceScales(device *Device) map[string]float64 {
+	app.devicesMu.RLock()
+	defer app.devicesMu.RUnlock()
+	return device.Scales
+}
+
+// recordCalibrationMetrics exports the device's offsets, scales and
+// residuals.
+func (app *App) recordCalibrationMetrics(device *Device) {
+	if app.CalibrationOffsetGauge == nil {
+		return
+	}
+
+	app.deleteCalibrationMetrics(device)
+	calibration := app.deviceCalibration(device)
+	for sensor, offset := range app.deviceOffsets(device) {
+		app.CalibrationOffsetGauge.With(calibrationLabels(device, sensor)).Set(offset)
+	}
+	for sensor, scale := range app.deviceScales(device) {
+		app.CalibrationScaleGauge.With(calibrationLabels(device, sensor)).Set(scale)
+	}
+	for sensor, residual := range calibration.Residuals {
+		app.CalibrationResidualGauge.With(calibrationLabels(device, sensor)).Set(residual)
+	}
+}
+
+func (app *App) deleteCalibrationMetrics(device *Device) {
+	if app.CalibrationOffsetGauge == nil {
+		return
+	}
+	for _, sensor := range calibrationSensors {
+		app.CalibrationOffsetGauge.Delete(calibrationLabels(device, sensor))
+		app.CalibrationScaleGauge.Delete(calibrationLabels(device, sensor))
+		app.CalibrationResidualGauge.Delete(calibrationLabels(device, sensor))
+	}
+}
+
+// calibrate returns the reading multiplied by the device's scales with its
+// offsets added. Corrections of the integer fields are rounded. The dew
+// point is recomputed from the corrected temperature and humidity.
+func (app *App) calibrate(device *Device, stats AwairStats) AwairStats {
+	offsets := app.deviceOffsets(device)
+	scales := app.deviceScales(device)
+	corrected := map[string]bool{}
+	for _, sensor := range calibrationSensors {
+		offset, hasOffset := offsets[sensor]
+		scale, hasScale := scales[sensor]
+		if !hasOffset && !hasScale {
+			continue
+		}
+		if !hasScale {
+			scale = 1
+		}
+		corrected[sensor] = true
+
+		switch sensor {
+		case "temp":
+			stats.Temp = stats.Temp*scale + offset
+		case "humid":
+			stats.Humid = math.Max(0, math.Min(100, stats.Humid*scale+offset))
+		case "co2":
+			stats.Co2 = int(math.Max(0, math.Round(float64(stats.Co2)*scale+offset)))
+		case "voc":
+			stats.Voc = int(math.Max(0, math.Round(float64(stats.Voc)*scale+offset)))
+		case "pm25":
+			stats.Pm25 = int(math.Max(0, math.Round(float64(stats.Pm25)*scale+offset)))
+		}
+	}
+
+	if (corrected["temp"] || corrected["humid"]) && hasField(stats, "dew_point") && stats.Humid > 0 {
+		stats.DewPoint = math.Round(dewPoint(stats.Temp, stats.Humid)*100) / 100
+	}
+	return stats
+}
+
+// recordCalibrationSample pairs the device's uncalibrated reading with the
+// reference's latest reading, when it was taken within a poll interval.
+func (app *App) recordCalibrationSample(device *Device, raw AwairStats) {
+	run := app.calibrationRun
+	if run == nil || !run.includes(device) {
+		return
+	}
+	at := readingTime(raw)
+	if at.After(run.end) {
+		return
+	}
+	reference := app.device(run.reference)
+	if reference == nil {
+		return
+	}
+	latest, _ := reference.Status.Latest()
+	if latest == nil || math.Abs(readingTime(*latest).Sub(at).Seconds()) > app.pollFrequency(reference).Seconds() {
+		return
+	}
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	stats := run.stats[device.Name]
+	if stats == nil {
+		stats = map[string]*calibrationStats{}
+		run.stats[device.Name] = stats
+	}
+	for _, sensor := range calibrationSensors {
+		if !device.Profile.has(sensor) || !reference.Profile.has(sensor) {
+			continue
+		}
+		if stats[sensor] == nil {
+			stats[sensor] = &calibrationStats{}
+		}
+		stats[sensor].add(fieldValue(*latest, sensor) - fieldValue(raw, sensor))
+	}
+}
+
+// finishCalibration computes the offsets of the co-located devices, writes
+// them to the calibration file and applies them.
+func (app *App) finishCalibration() error {
+	run := app.calibrationRun
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	names := make([]string, 0, len(run.stats))
+	for name := range run.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	app.calibrationMu.Lock()
+	calibrated := map[string]deviceCalibration{}
+	for _, name := range names {
+		calibration := deviceCalibration{
+			Reference:    run.reference,
+			CalibratedAt: time.Now().UTC().Truncate(time.Second),
+			Offsets:      map[string]float64{},
+			Residuals:    map[string]float64{},
+		}
+		for sensor, stats := range run.stats[name] {
+			if stats.n < calibrationMinSamples {
+				app.Logger.Warn("Too few readings paired with the reference to calibrate the sensor", zap.String("device", name), zap.String("sensor", sensor), zap.Int("samples", stats.n))
+				continue
+			}
+			offset, residual := stats.offset()
+			// Keep the precision of the readings.
+			calibration.Offsets[sensor] = math.Round(offset*100) / 100
+			calibration.Residuals[sensor] = math.Round(residual*100) / 100
+		}
+		if len(calibration.Offsets) > 0 {
+			app.calibration.Devices[name] = calibration
+			calibrated[name] = calibration
+		}
+	}
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	err := encoder.Encode(app.calibration)
+	app.calibrationMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if len(calibrated) == 0 {
+		return fmt.Errorf("no device had enough readings paired with %s", run.reference)
+	}
+	if err := writeFileAtomic(app.CalibrationFile, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write calibration file: %w", err)
+	}
+	for _, name := range names {
+		calibration, ok := calibrated[name]
+		if !ok {
+			continue
+		}
+		app.Logger.Info("Calibrated device against the reference", zap.String("device", name), zap.String("reference", run.reference), zap.Any("offsets", calibration.Offsets), zap.Any("residuals", calibration.Residuals))
+		if device := app.device(name); device != nil {
+			app.recordCalibrationMetrics(device)
+		}
+	}
+	return nil
+}
+
+// runCalibration ends the calibration run after --calibrate-duration.
+func (app *App) runCalibration(ctx context.Context) {
+	app.Logger.Info("Calibrating co-located devices", zap.String("reference", app.calibrationRun.reference), zap.Time("until", app.calibrationRun.end))
+
+	timer := time.NewTimer(time.Until(app.calibrationRun.end))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		app.Logger.Warn("Exporter stopped before the calibration ended, no offsets were written")
+		return
+	}
+
+	if err := app.finishCalibration(); err != nil {
+		app.Logger.Error("Error finishing calibration", zap.Error(err))
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestCalibrationStatsOffset(t *testing.T) {
+	tests := []struct {
+		differences  []float64
+		wantOffset   float64
+		wantResidual float64
+	}{
+		{[]float64{1.5, 1.5, 1.5}, 1.5, 0},
+		{[]float64{-2, -4}, -3, 1},
+		{[]float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, 2},
+	}
+	for _, tt := range tests {
+		stats := calibrationStats{}
+		for _, d := range tt.differences {
+			stats.add(d)
+		}
+		offset, residual := stats.offset()
+		if offset != tt.wantOffset || residual != tt.wantResidual {
+			t.Errorf("offset() of %v = %v, %v, want %v, %v", tt.differences, offset, residual, tt.wantOffset, tt.wantResidual)
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	app := &App{calibration: calibrationFile{Devices: map[string]deviceCalibration{
+		"office": {Offsets: map[string]float64{"temp": -1.5, "humid": 3, "co2": 12.6, "pm25": -5}},
+	}}}
+
+	got := app.calibrate(newDevice("office", ""), AwairStats{Temp: 23, Humid: 98.5, Co2: 600, Voc: 100, Pm25: 2})
+	// The dew point is recomputed, at saturation the temperature.
+	want := AwairStats{DewPoint: 21.5, Temp: 21.5, Humid: 100, Co2: 613, Voc: 100, Pm25: 0}
+	if got != want {
+		t.Errorf("calibrate() = %+v, want %+v", got, want)
+	}
+
+	other := AwairStats{Temp: 23, Co2: 600}
+	if got := app.calibrate(newDevice("bedroom", ""), other); got != other {
+		t.Errorf("calibrate() of an uncalibrated device = %+v, want %+v", got, other)
+	}
+}
+
+func TestCalibrateDeviceOffsets(t *testing.T) {
+	app := &App{calibration: calibrationFile{Devices: map[string]deviceCalibration{
+		"office": {Offsets: map[string]float64{"temp": -0.5, "co2": 10}},
+	}}}
+	office := newDevice("office", "")
+	// The config file's offset of the self-heating Element wins.
+	office.Offsets = map[string]float64{"temp": -1.5}
+
+	got := app.calibrate(office, AwairStats{DewPoint: 9.2, Temp: 23, Humid: 40, Co2: 600})
+	want := AwairStats{DewPoint: math.Round(dewPoint(21.5, 40)*100) / 100, Temp: 21.5, Humid: 40, Co2: 610}
+	if got != want {
+		t.Errorf("calibrate() = %+v, want %+v", got, want)
+	}
+	if got.DewPoint < 7.2 || got.DewPoint > 7.4 {
+		t.Errorf("calibrate() dew point = %v, want about 7.3", got.DewPoint)
+	}
+}
+
+func TestCalibrateDeviceScales(t *testing.T) {
+	app := &App{}
+	office := newDevice("office", "")
+	office.Offsets = map[string]float64{"humid": 2}
+	office.Scales = map[string]float64{"humid": 1.1, "co2": 0.95}
+
+	got := app.calibrate(office, AwairStats{Temp: 21.5, Humid: 40, Co2: 1000, Voc: 100})
+	want := AwairStats{DewPoint: math.Round(dewPoint(21.5, 46)*100) / 100, Temp: 21.5, Humid: 46, Co2: 950, Voc: 100}
+	if got != want {
+		t.Errorf("calibrate() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCalibrationRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calibration.yaml")
+	reference := newDevice("reference", "")
+	reference.Profile, _ = findDeviceProfile("element")
+	office := newDevice("office", "")
+	office.Profile, _ = findDeviceProfile("element")
+	// The Glow C has no CO2 sensor to calibrate.
+	glow := newDevice("glow", "")
+	glow.Profile, _ = findDeviceProfile("glow-c")
+
+	app := &App{
+		Logger:             zap.NewNop(),
+		TimeBetweenChecks:  time.Minute,
+		CalibrationFile:    path,
+		CalibrateReference: "reference",
+		CalibrateDuration:  time.Hour,
+		Devices:            []*Device{reference, office, glow},
+	}
+	if err := app.initializeCalibration(app.Devices); err != nil {
+		t.Fatalf("initializeCalibration() error = %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < calibrationMinSamples; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		reference.Status.recordSuccess(AwairStats{Timestamp: at, Temp: 21, Humid: 40, Co2: 600})
+		// office reads 1.5 °C warm, its CO2 alternates 10 and 30 ppm low.
+		co2 := 590
+		if i%2 == 1 {
+			co2 = 570
+		}
+		app.recordCalibrationSample(office, AwairStats{Timestamp: at, Temp: 22.5, Humid: 40, Co2: co2})
+		app.recordCalibrationSample(glow, AwairStats{Timestamp: at, Temp: 20, Humid: 45})
+	}
+	// Readings too far from the reference's are not paired.
+	app.recordCalibrationSample(office, AwairStats{Timestamp: start.Add(time.Hour), Temp: 40})
+
+	if err := app.finishCalibration(); err != nil {
+		t.Fatalf("finishCalibration() error = %v", err)
+	}
+
+	file, err := loadCalibration(path)
+	if err != nil {
+		t.Fatalf("loadCalibration() error = %v", err)
+	}
+	if _, ok := file.Devices["reference"]; ok {
+		t.Error("the reference was calibrated")
+	}
+	tests := []struct {
+		device, sensor string
+		offset         float64
+		residual       float64
+	}{
+		{"office", "temp", -1.5, 0},
+		{"office", "humid", 0, 0},
+		{"office", "co2", 20, 10},
+		{"glow", "temp", 1, 0},
+		{"glow", "humid", -5, 0},
+	}
+	for _, tt := range tests {
+		calibration := file.Devices[tt.device]
+		if calibration.Reference != "reference" {
+			t.Errorf("%s reference = %q, want reference", tt.device, calibration.Reference)
+		}
+		if got := calibration.Offsets[tt.sensor]; got != tt.offset {
+			t.Errorf("%s %s offset = %v, want %v", tt.device, tt.sensor, got, tt.offset)
+		}
+		if got := calibration.Residuals[tt.sensor]; got != tt.residual {
+			t.Errorf("%s %s residual = %v, want %v", tt.device, tt.sensor, got, tt.residual)
+		}
+	}
+	if _, ok := file.Devices["glow"].Offsets["co2"]; ok {
+		t.Error("glow has a co2 offset")
+	}
+
+	// The offsets apply to the following readings.
+	if got := app.calibrate(office, AwairStats{Temp: 22.5}).Temp; got != 21 {
+		t.Errorf("calibrated temp = %v, want 21", got)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/prometheus/exporter-toolkit/web"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	registerCommand("check-config", command{
+		Usage: "Check a --config file without starting the exporter, printing every error and warning found and exiting 1 on errors.\nThe checks needing the network, such as listing Kubernetes or Awair Cloud devices, are skipped.",
+		Run:   runCheckConfig,
+	})
+}
+
+// validateOptions checks the options before the exporter starts, returning
+// every failure rather than the first.
+func (app *App) validateOptions(config *Config) []error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	_, err := newLogger(app.LogLevel, app.LogFormat)
+	check(err)
+	if app.LogSummaryInterval < 0 {
+		check(errors.New("log-summary-interval must not be negative"))
+	}
+	check(validateStalePolicy(app.StalePolicy))
+	check(validateRangePolicy(app.RangePolicy))
+	check(validateDeviceProfile(app.DeviceProfile))
+	check(validateForceSensors(app.ForceSensors))
+	check(validateTemperatureUnit(app.TemperatureUnit))
+	check(validateRolling(app.RollingWindows, app.RollingSensors))
+	_, err = parseSmoothing(app.Smoothing)
+	check(err)
+	_, err = parseSpikeLimits(app.SpikeLimit)
+	check(err)
+	check(validateMetricNaming(app.MetricPrefix, app.MetricNamespace, app.MetricSubsystem))
+	_, err = parseStaticLabels(app.Labels)
+	check(err)
+	_, err = loadTimezone(app.Timezone)
+	check(err)
+	check(validateThresholds(app.Thresholds))
+	if config != nil {
+		_, err = newWebhooks(config.Webhooks)
+		check(err)
+		_, err = newProbeModules(config.ProbeModules, app.Proxy, app.ProxyFromEnv)
+		check(err)
+	}
+
+	if app.CloudToken != "" && app.CloudPollFrequency <= 0 {
+		check(errors.New("awair-cloud-poll-frequency must be positive"))
+	}
+	check(validateCloudBackfill(app.CloudBackfill, app.CloudToken, app.pollsCloud() || app.CloudInventoryOnly))
+	check(validatePollFrequency(app.TimeBetweenChecks))
+	if app.Discover && app.DiscoverInterval <= 0 {
+		check(errors.New("discover-interval must be positive"))
+	}
+	if app.DeviceInfoInterval <= 0 {
+		check(errors.New("device-info-interval must be positive"))
+	}
+	if app.BreakerFailures > 0 && app.BreakerInterval <= 0 {
+		check(errors.New("breaker-interval must be positive"))
+	}
+	if app.PollWorkers < 0 {
+		check(errors.New("poll-workers must not be negative"))
+	}
+	check(validatePollJitter(app.PollJitter))
+	check(validateRetries(app.RetryAttempts, app.RetryInitialBackoff, app.RetryMaxBackoff, app.RetryJitter))
+	_, err = newDeviceClient(app.CAFile, app.InsecureSkipVerify, app.Proxy, app.ProxyFromEnv)
+	check(err)
+	check(validateDeviceHeaders(app.DeviceHeaders))
+	if _, err := parseByteSize(app.MaxBodySize); err != nil {
+		check(fmt.Errorf("invalid awair-max-body-size: %w", err))
+	}
+
+	if app.WebConfigFile != "" {
+		if err := web.Validate(app.WebConfigFile); err != nil {
+			check(fmt.Errorf("invalid web configuration: %w", err))
+		}
+	}
+	check(validateTelemetryPath(app.TelemetryPath))
+	if app.BaselineDriftWindow < minBaselineDays {
+		check(fmt.Errorf("baseline-drift-window must be at least %d days", minBaselineDays))
+	}
+
+	return errs
+}
+
+// unknownConfigKeys reports the keys of the config file the exporter
+// ignores, most likely typos.
+func unknownConfigKeys(data []byte) []string {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var typeErr *yaml.TypeError
+	if err := decoder.Decode(&Config{}); errors.As(err, &typeErr) {
+		return typeErr.Errors
+	}
+	return nil
+}
+
+// checkConfig returns the errors and warnings of the config file at path,
+// with the other options at their defaults.
+func checkConfig(path string) (errs []error, warnings []string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("failed to read config: %w", err)}, nil
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		return []error{err}, nil
+	}
+	warnings = unknownConfigKeys(data)
+
+	app := &App{Logger: zap.NewNop()}
+	fs := pflag.NewFlagSet("exporter", pflag.ContinueOnError)
+	app.registerFlags(fs)
+	app.applyConfig(fs, config)
+	errs = app.validateOptions(config)
+
+	// The devices of Kubernetes, the Awair Cloud and discovery are only
+	// known once the exporter runs.
+	if app.KubernetesDevices || app.CloudToken != "" || app.Discover && len(config.Devices) == 0 {
+		return errs, warnings
+	}
+	var devices []*Device
+	if len(config.Devices) > 0 {
+		devices, err = configDevices(config.Devices)
+	} else {
+		devices, err = parseDevices(app.AwairAddresses)
+	}
+	if err != nil {
+		return append(errs, err), warnings
+	}
+	app.Devices = devices
+	app.ExtraLabelNames = app.extraLabelNames(devices)
+	if err := app.validateDivergence(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := app.initializeCalibration(devices); err != nil {
+		errs = append(errs, err)
+	}
+	return errs, append(warnings, app.configWarnings()...)
+}
+
+func runCheckConfig(fs *pflag.FlagSet, args []string) int {
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	path := fs.Arg(0)
+	errs, warnings := checkConfig(path)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", path, warning)
+	}
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: error: %s\n", path, err)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	fmt.Printf("%s: ok\n", path)
+	return 0
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		wantErrs     []string
+		wantWarnings []string
+	}{
+		{
+			name: "valid",
+			config: `
+poll_frequency: 30s
+devices:
+  - name: office
+    address: http://192.168.1.20/air-data/latest
+`,
+		},
+		{
+			name: "invalid",
+			config: `
+poll_frequency: 0s
+stale_policy: nope
+discover: true
+discover_interval: 0s
+temprature_unit: fahrenheit
+devices:
+  - name: office
+    address: http://192.168.1.20/air-data
+    labels: {device: x}
+`,
+			wantErrs:     []string{"invalid stale policy", "poll-frequency must be positive", "discover-interval must be positive", `label name "device" is reserved`},
+			wantWarnings: []string{"field temprature_unit not found"},
+		},
+		{
+			name: "warnings",
+			config: `
+poll_frequency: 5s
+awair_address: [http://192.168.1.20/air-data]
+`,
+			wantWarnings: []string{"field awair_address not found", "below 10s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			errs, warnings := checkConfig(path)
+			if len(errs) != len(tt.wantErrs) {
+				t.Errorf("checkConfig() errors = %v, want %d", errs, len(tt.wantErrs))
+			}
+			for i := 0; i < len(errs) && i < len(tt.wantErrs); i++ {
+				if !strings.Contains(errs[i].Error(), tt.wantErrs[i]) {
+					t.Errorf("checkConfig() error %d = %v, want %q", i, errs[i], tt.wantErrs[i])
+				}
+			}
+			if got := strings.Join(warnings, "\n"); len(warnings) != len(tt.wantWarnings) {
+				t.Errorf("checkConfig() warnings = %q, want %d", got, len(tt.wantWarnings))
+			}
+			for i := 0; i < len(warnings) && i < len(tt.wantWarnings); i++ {
+				if !strings.Contains(warnings[i], tt.wantWarnings[i]) {
+					t.Errorf("checkConfig() warning %d = %q, want %q", i, warnings[i], tt.wantWarnings[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateOptionsDeviceInfoInterval(t *testing.T) {
+	app := &App{}
+	app.registerFlags(pflag.NewFlagSet("test", pflag.ContinueOnError))
+	if errs := app.validateOptions(nil); len(errs) != 0 {
+		t.Fatalf("validateOptions() of the defaults = %v", errs)
+	}
+
+	app.DeviceInfoInterval = 0
+	errs := app.validateOptions(nil)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "device-info-interval must be positive") {
+		t.Errorf("validateOptions() = %v, want device-info-interval error", errs)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// deviceDialTimeout bounds connecting to a device, leaving the rest of
+	// pollTimeout for the request itself.
+	deviceDialTimeout = time.Millisecond * 500
+	// deviceIdleTimeout keeps the connection to a device open between polls
+	// at the default --poll-frequency, so most polls skip the TCP and TLS
+	// handshakes over the device's Wi-Fi.
+	deviceIdleTimeout = time.Second * 90
+	// defaultMaxBodySize is the default --awair-max-body-size, far above the
+	// ~1 KiB of a reading.
+	defaultMaxBodySize = "64KiB"
+)
+
+// newDeviceClient builds the HTTP client used to reach the devices, trusting
+// the certificates in caFile in addition to the system roots. Devices are
+// reached through proxy if set. Otherwise, as they are on the LAN, the
+// HTTP_PROXY environment variables are ignored unless proxyFromEnv is set.
+func newDeviceClient(caFile string, insecureSkipVerify bool, proxy string, proxyFromEnv bool) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   deviceDialTimeout,
+			KeepAlive: time.Second * 30,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: pollTimeout,
+		// Polls of a device are serialized, but may overlap with a
+		// device info request.
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     deviceIdleTimeout,
+	}
+	switch {
+	case proxy != "":
+		proxyURL, err := parseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	case proxyFromEnv:
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// parseProxy parses an --awair-proxy URL, which may carry credentials as
+// user:password@.
+func parseProxy(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid awair-proxy: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid awair-proxy %q: scheme must be http, https, socks5 or socks5h", proxyURL.Redacted())
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid awair-proxy %q: missing host", proxyURL.Redacted())
+	}
+	return proxyURL, nil
+}
+
+// readDeviceBody reads the body of a device's response, failing once it
+// exceeds --awair-max-body-size rather than buffering whatever a wrong URL
+// or misbehaving proxy sends.
+func (app *App) readDeviceBody(body io.Reader) ([]byte, error) {
+	limit := app.MaxBodyBytes
+	if limit <= 0 {
+		limit, _ = parseByteSize(defaultMaxBodySize)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, permanentError{fmt.Errorf("response body exceeds %d bytes, see --awair-max-body-size", limit)}
+	}
+	return data, nil
+}
+
+// newDeviceRequest returns a GET request to a device, carrying the
+// --awair-user-agent and --awair-header headers, e.g. the API key of an
+// authenticated gateway in front of the device.
+func (app *App) newDeviceRequest(ctx context.Context, address string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range app.DeviceHeaders {
+		req.Header.Set(name, value)
+	}
+	userAgent := app.UserAgent
+	if userAgent == "" {
+		userAgent = "awair-local-prom-exporter/" + currentBuildInfo().Version
+	}
+	req.Header.Set("User-Agent", userAgent)
+	return req, nil
+}
+
+// validateDeviceHeaders checks the --awair-header names and values.
+func validateDeviceHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		switch {
+		case name == "" || strings.ContainsAny(name, " \t\r\n:"):
+			return fmt.Errorf("invalid awair-header name %q", name)
+		case strings.EqualFold(name, "User-Agent"):
+			return errors.New("invalid awair-header User-Agent, set it with awair-user-agent")
+		case strings.EqualFold(name, "Host"):
+			return errors.New("invalid awair-header Host, set it in the device address")
+		case strings.ContainsAny(value, "\r\n"):
+			return fmt.Errorf("invalid awair-header %q, its value must not contain line breaks", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadDeviceBody(t *testing.T) {
+	app := &App{MaxBodyBytes: 16}
+	if body, err := app.readDeviceBody(strings.NewReader(`{"temp":21.5}`)); err != nil || string(body) != `{"temp":21.5}` {
+		t.Errorf("readDeviceBody() = %q, %v, want the body", body, err)
+	}
+	_, err := app.readDeviceBody(strings.NewReader(strings.Repeat("x", 17)))
+	if !errors.As(err, &permanentError{}) {
+		t.Errorf("readDeviceBody() of a 17 byte body error = %v, want a permanent error", err)
+	}
+
+	// Apps not configured from the flags, e.g. of the subcommands, use the
+	// default limit.
+	app = &App{}
+	if _, err := app.readDeviceBody(strings.NewReader(strings.Repeat("x", 65<<10))); err == nil {
+		t.Error("readDeviceBody() of a 65 KiB body succeeded, want the default limit to fail it")
+	}
+}
+
+func TestNewDeviceRequest(t *testing.T) {
+	app := &App{DeviceHeaders: map[string]string{"X-Api-Key": "secret"}}
+	req, err := app.newDeviceRequest(context.Background(), "http://10.0.0.5/air-data/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("X-Api-Key"); got != "secret" {
+		t.Errorf("X-Api-Key = %q, want secret", got)
+	}
+	if got := req.UserAgent(); !strings.HasPrefix(got, "awair-local-prom-exporter/") {
+		t.Errorf("User-Agent = %q, want the exporter's", got)
+	}
+
+	app.UserAgent = "gateway-client/1.0"
+	req, err = app.newDeviceRequest(context.Background(), "http://10.0.0.5/air-data/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.UserAgent(); got != "gateway-client/1.0" {
+		t.Errorf("User-Agent = %q, want gateway-client/1.0", got)
+	}
+}
+
+func TestValidateDeviceHeaders(t *testing.T) {
+	tests := []struct {
+		headers map[string]string
+		wantErr bool
+	}{
+		{map[string]string{"X-Api-Key": "secret", "Authorization": "Bearer secret"}, false},
+		{map[string]string{"X Api Key": "secret"}, true},
+		{map[string]string{"user-agent": "curl"}, true},
+		{map[string]string{"Host": "awair.lan"}, true},
+		{map[string]string{"X-Api-Key": "secret\r\nX-Other: 1"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateDeviceHeaders(tt.headers); (err != nil) != tt.wantErr {
+			t.Errorf("validateDeviceHeaders(%v) error = %v, want error %v", tt.headers, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// cloudRequestTimeout replaces pollTimeout for cloud devices, as the
+	// cloud API is much slower to answer than a device on the LAN.
+	cloudRequestTimeout = time.Second * 10
+	// cloudDevicesPath lists the devices of the token's account.
+	cloudDevicesPath = "/v1/users/self/devices"
+)
+
+// cloudDevice is a device in the Awair Cloud inventory.
+type cloudDevice struct {
+	Name         string `json:"name"`
+	DeviceID     int    `json:"deviceId"`
+	DeviceType   string `json:"deviceType"`
+	DeviceUUID   string `json:"deviceUUID"`
+	RoomType     string `json:"roomType"`
+	LocationName string `json:"locationName"`
+}
+
+// cloudAirData is the cloud API's air data of a device, the latest reading
+// or a series of averages.
+type cloudAirData struct {
+	Data []cloudAirDataPoint `json:"data"`
+}
+
+type cloudAirDataPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Score     float64   `json:"score"`
+	Sensors   []struct {
+		Comp  string  `json:"comp"`
+		Value float64 `json:"value"`
+	} `json:"sensors"`
+}
+
+// cloudSensorFields maps the cloud sensor components to local payload
+// fields.
+var cloudSensorFields = map[string]string{
+	"temp":  "temp",
+	"humid": "humid",
+	"co2":   "co2",
+	"voc":   "voc",
+	"pm25":  "pm25",
+	"pm10":  "pm10_est",
+	"lux":   "lux",
+	"spl_a": "spl_a",
+}
+
+// cloudIntegerFields are the local payload fields decoded as integers.
+var cloudIntegerFields = map[string]bool{
+	"co2": true, "voc": true, "pm25": true, "pm10_est": true,
+}
+
+// cloudAddress returns the URL of a cloud API path.
+func (app *App) cloudAddress(path string) string {
+	return strings.TrimSuffix(app.CloudURL, "/") + path
+}
+
+// cloudRequest builds an authenticated request to the cloud API.
+func (app *App) cloudRequest(ctx context.Context, address string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+app.CloudToken)
+	return req, nil
+}
+
+// checkCloudResponse turns an unsuccessful cloud API response into an error.
+// Rate limiting and a rejected token are permanent, as retrying only spends
+// more of the quota.
+func checkCloudResponse(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return permanentError{errors.New("rate limited by the Awair Cloud API, raise --awair-cloud-poll-frequency")}
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return permanentError{fmt.Errorf("the Awair Cloud API rejected the token: %s", resp.Status)}
+	}
+	return fmt.Errorf("unexpected status %s from the Awair Cloud API", resp.Status)
+}
+
+// pollsCloud reports whether the devices are the --awair-cloud-token
+// account's, polled from the cloud API. The simulator and AwairDevices take
+// precedence.
+func (app *App) pollsCloud() bool {
+	return app.CloudToken != "" && !app.CloudInventoryOnly && app.Simulate <= 0 && !app.KubernetesDevices
+}
+
+// cloudDevices lists the devices of the --awair-cloud-token account, polled
+// from the cloud API every --awair-cloud-poll-frequency. Devices sharing a
+// name are told apart by their device ID.
+func (app *App) cloudDevices(ctx context.Context) ([]*Device, error) {
+	inventory, err := app.cloudInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(inventory) == 0 {
+		return nil, errors.New("the Awair Cloud account has no devices")
+	}
+
+	counts := map[string]int{}
+	for _, cloud := range inventory {
+		counts[cloud.Name]++
+	}
+
+	devices := make([]*Device, 0, len(inventory))
+	for _, cloud := range inventory {
+		name := cloud.Name
+		if name == "" || counts[name] > 1 {
+			name = cloud.DeviceUUID
+		}
+
+		device := newDevice(name, app.cloudAirDataAddress(cloud, "latest"))
+		device.Cloud = true
+		device.uuid.Store(cloud.DeviceUUID)
+		device.PollFrequency = app.CloudPollFrequency
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// cloudAirDataAddress returns the URL of one of the device's air data
+// endpoints, e.g. latest.
+func (app *App) cloudAirDataAddress(cloud cloudDevice, endpoint string) string {
+	return app.cloudAddress(fmt.Sprintf("%s/%s/%d/air-data/%s", cloudDevicesPath, url.PathEscape(cloud.DeviceType), cloud.DeviceID, endpoint))
+}
+
+// cloudInventory fetches the devices registered to the token's account.
+func (app *App) cloudInventory(ctx context.Context) ([]cloudDevice, error) {
+	ctx, cancel := context.WithTimeout(ctx, cloudRequestTimeout)
+	defer cancel()
+
+	req, err := app.cloudRequest(ctx, app.cloudAddress(cloudDevicesPath))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := app.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Awair Cloud devices: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkCloudResponse(resp); err != nil {
+		return nil, fmt.Errorf("failed to list Awair Cloud devices: %w", err)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := struct {
+		Devices []cloudDevice `json:"devices"`
+	}{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse Awair Cloud devices: %w", err)
+	}
+	return result.Devices, nil
+}
+
+// cloudReading converts the cloud API's latest air data into the local API
+// payload.
+func cloudReading(body []byte) ([]byte, error) {
+	airData := cloudAirData{}
+	if err := json.Unmarshal(body, &airData); err != nil {
+		return nil, err
+	}
+	if len(airData.Data) == 0 {
+		return nil, errors.New("no air data from the Awair Cloud API")
+	}
+	return airData.Data[0].payload()
+}
+
+// payload converts the data point into the local API payload, adding the
+// dew point and absolute humidity the cloud does not report.
+func (point cloudAirDataPoint) payload() ([]byte, error) {
+	payload := map[string]interface{}{
+		"timestamp": point.Timestamp,
+		"score":     int(math.Round(point.Score)),
+	}
+	values := map[string]float64{}
+	for _, sensor := range point.Sensors {
+		field, ok := cloudSensorFields[sensor.Comp]
+		if !ok {
+			continue
+		}
+		values[field] = sensor.Value
+		if cloudIntegerFields[field] {
+			payload[field] = int(math.Round(sensor.Value))
+		} else {
+			payload[field] = sensor.Value
+		}
+	}
+
+	temp, hasTemp := values["temp"]
+	humid, hasHumid := values["humid"]
+	if hasTemp && hasHumid && humid > 0 {
+		payload["dew_point"] = dewPoint(temp, humid)
+		payload["abs_humid"] = absoluteHumidity(temp, humid)
+	}
+
+	return json.Marshal(payload)
+}
+
+// The device labels set from the --awair-cloud-inventory account.
+const (
+	cloudNameLabel = "cloud_name"
+	cloudRoomLabel = "room"
+)
+
+// setCloudLabels sets the cloud labels to the name and room the account
+// registers the device under, matched on its UUID. Labels of the same name
+// from the config file win, and the labels stay empty until the UUID is
+// fetched or when the account does not have the device.
+func (app *App) setCloudLabels(labels prometheus.Labels, device *Device) {
+	cloud := cloudDevice{}
+	if uuid := device.UUID(); uuid != "" {
+		for _, candidate := range app.CloudInventory {
+			if candidate.DeviceUUID == uuid {
+				cloud = candidate
+				break
+			}
+		}
+	}
+	for name, value := range map[string]string{cloudNameLabel: cloud.Name, cloudRoomLabel: cloud.RoomType} {
+		if _, ok := device.ExtraLabels[name]; !ok {
+			labels[name] = value
+		}
+	}
+}
+
+// cloudInventoryCollector exports the devices of the --awair-cloud-inventory
+// account and flags those no local poller reaches. Devices are matched on
+// the UUID reported by their local config endpoint.
+type cloudInventoryCollector struct {
+	app     *App
+	info    *prometheus.Desc
+	missing *prometheus.Desc
+}
+
+func (app *App) initializeCloudInventoryMetrics() {
+	if len(app.CloudInventory) == 0 {
+		return
+	}
+
+	prometheus.MustRegister(cloudInventoryCollector{
+		app: app,
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(app.metricNamespace(), "cloud", "device_info"),
+			"Device registered to the Awair Cloud account, with the name of the local device polling it, always 1",
+			[]string{"uuid", "cloud_name", "room", "location", "device"}, nil,
+		),
+		missing: prometheus.NewDesc(
+			prometheus.BuildFQName(app.metricNamespace(), "cloud", "device_missing"),
+			"Whether no polled device matches the Awair Cloud device (1) or one does (0)",
+			[]string{"uuid", "cloud_name"}, nil,
+		),
+	})
+}
+
+func (c cloudInventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.info
+	ch <- c.missing
+}
+
+func (c cloudInventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	local := map[string]string{}
+	for _, device := range c.app.devices() {
+		if uuid := device.UUID(); uuid != "" {
+			local[uuid] = device.Name
+		}
+	}
+
+	for _, cloud := range c.app.CloudInventory {
+		name := local[cloud.DeviceUUID]
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, cloud.DeviceUUID, cloud.Name, cloud.RoomType, cloud.LocationName, name)
+		ch <- prometheus.MustNewConstMetric(c.missing, prometheus.GaugeValue, boolToFloat(name == ""), cloud.DeviceUUID, cloud.Name)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/pflag"
+)
+
+// command is a subcommand run instead of the exporter when its name is the
+// first argument, e.g. awair-local-prom-exporter healthcheck.
+type command struct {
+	Usage string
+	// Run parses the arguments following the name into fs and returns the
+	// exit code.
+	Run func(fs *pflag.FlagSet, args []string) int
+}
+
+var commandRegistry = map[string]command{}
+
+func registerCommand(name string, cmd command) {
+	if _, ok := commandRegistry[name]; ok {
+		panic(fmt.Sprintf("command %q registered twice", name))
+	}
+	commandRegistry[name] = cmd
+}
+
+// availableCommands returns the names of all subcommands.
+func availableCommands() []string {
+	names := make([]string, 0, len(commandRegistry))
+	for name := range commandRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runCommand runs the subcommand named by args[0], reporting false when
+// there is none.
+func runCommand(args []string) (exitCode int, ok bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	cmd, ok := commandRegistry[args[0]]
+	if !ok {
+		return 0, false
+	}
+
+	fs := pflag.NewFlagSet(args[0], pflag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n\n%s\n\nFlags:\n%s", os.Args[0], args[0], cmd.Usage, fs.FlagUsages())
+	}
+	return cmd.Run(fs, args[1:]), true
+}
+
+// parseExitCode returns the exit code of a failure to parse the flags of a
+// subcommand, 0 for --help.
+func parseExitCode(err error) int {
+	if errors.Is(err, pflag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the format of the --config file. Options given on the command
+// line take precedence over the values in the file.
+type Config struct {
+	LogLevel            *string           `yaml:"log_level"`
+	LogFormat           *string           `yaml:"log_format"`
+	LogSummaryInterval  *time.Duration    `yaml:"log_summary_interval"`
+	Listen              *string           `yaml:"listen"`
+	Port                *uint64           `yaml:"port"`
+	ListenSocketMode    *string           `yaml:"listen_socket_mode"`
+	WebConfigFile       *string           `yaml:"web_config_file"`
+	EnableLifecycle     *bool             `yaml:"web_enable_lifecycle"`
+	TelemetryPath       *string           `yaml:"web_telemetry_path"`
+	AccessLog           *bool             `yaml:"web_access_log"`
+	CAFile              *string           `yaml:"awair_ca_file"`
+	InsecureSkipVerify  *bool             `yaml:"awair_insecure_skip_verify"`
+	Proxy               *string           `yaml:"awair_proxy"`
+	ProxyFromEnv        *bool             `yaml:"awair_proxy_from_env"`
+	MaxBodySize         *string           `yaml:"awair_max_body_size"`
+	UserAgent           *string           `yaml:"awair_user_agent"`
+	DeviceHeaders       map[string]string `yaml:"awair_headers"`
+	CloudToken          *string           `yaml:"awair_cloud_token"`
+	CloudURL            *string           `yaml:"awair_cloud_url"`
+	CloudPollFrequency  *time.Duration    `yaml:"awair_cloud_poll_frequency"`
+	CloudBackfill       *time.Duration    `yaml:"awair_cloud_backfill"`
+	CloudInventoryOnly  *bool             `yaml:"awair_cloud_inventory"`
+	PollFrequency       *time.Duration    `yaml:"poll_frequency"`
+	PollJitter          *float64          `yaml:"poll_jitter"`
+	PollBackoffMax      *time.Duration    `yaml:"poll_backoff_max"`
+	PollWorkers         *int              `yaml:"poll_workers"`
+	RetryAttempts       *int              `yaml:"retry_attempts"`
+	RetryInitialBackoff *time.Duration    `yaml:"retry_initial_backoff"`
+	RetryMaxBackoff     *time.Duration    `yaml:"retry_max_backoff"`
+	RetryJitter         *float64          `yaml:"retry_jitter"`
+	BreakerFailures     *int              `yaml:"breaker_failures"`
+	BreakerInterval     *time.Duration    `yaml:"breaker_interval"`
+	ReadyWindow         *time.Duration    `yaml:"ready_window"`
+	SampleTimestamps    *bool             `yaml:"sample_timestamps"`
+	TemperatureUnit     *string           `yaml:"temperature_unit"`
+	AQINowCast          *bool             `yaml:"aqi_nowcast"`
+	RollingWindows      *[]time.Duration  `yaml:"rolling_windows"`
+	RollingSensors      *[]string         `yaml:"rolling_sensors"`
+	DivergenceLabel     *string           `yaml:"divergence_label"`
+	DivergenceWindow    *time.Duration    `yaml:"divergence_window"`
+	DivergenceSensors   *[]string         `yaml:"divergence_sensors"`
+	CalibrationFile     *string           `yaml:"calibration_file"`
+	CalibrateReference  *string           `yaml:"calibrate_reference"`
+	CalibrateDevices    *[]string         `yaml:"calibrate_devices"`
+	CalibrateDuration   *time.Duration    `yaml:"calibrate_duration"`
+	Timezone            *string           `yaml:"timezone"`
+	HistoryBuffer       *time.Duration    `yaml:"history_buffer"`
+	StateFile           *string           `yaml:"state_file"`
+	MetricPrefix        *string           `yaml:"metric_prefix"`
+	MetricNamespace     *string           `yaml:"metric_namespace"`
+	MetricSubsystem     *string           `yaml:"metric_subsystem"`
+	Labels              map[string]string `yaml:"labels"`
+	StaleAfter          *time.Duration    `yaml:"stale_after"`
+	StalePolicy         *string           `yaml:"stale_policy"`
+	RangePolicy         *string           `yaml:"range_policy"`
+	StaleAfterFailures  *int              `yaml:"stale_after_failures"`
+	MaxStaleness        *time.Duration    `yaml:"max_staleness"`
+	ScrapeOnCollect     *bool             `yaml:"scrape_on_collect"`
+	DeviceProfile       *string           `yaml:"device_profile"`
+	ForceSensors        *[]string         `yaml:"force_sensors"`
+	UUIDLabel           *bool             `yaml:"uuid_label"`
+	Discover            *bool             `yaml:"discover"`
+	DiscoverInterval    *time.Duration    `yaml:"discover_interval"`
+	TracingEndpoint     *string           `yaml:"tracing_endpoint"`
+	TracingHeaders      map[string]string `yaml:"tracing_headers"`
+	KubernetesDevices   *bool             `yaml:"kubernetes_devices"`
+	KubernetesNamespace *string           `yaml:"kubernetes_namespace"`
+	KubernetesResync    *time.Duration    `yaml:"kubernetes_resync"`
+
+	Devices      []DeviceConfig               `yaml:"devices"`
+	Thresholds   []Threshold                  `yaml:"thresholds"`
+	Webhooks     []WebhookConfig              `yaml:"webhooks"`
+	ProbeModules map[string]ProbeModuleConfig `yaml:"probe_modules"`
+	Smoothing    map[string]float64           `yaml:"smoothing"`
+	SpikeLimits  map[string]float64           `yaml:"spike_limits"`
+}
+
+// DeviceConfig configures a single device in the --config file.
+type DeviceConfig struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"`
+	// Labels are added to every series of the device.
+	Labels map[string]string `yaml:"labels"`
+	// PollFrequency overrides --poll-frequency for the device.
+	PollFrequency *time.Duration `yaml:"poll_frequency"`
+	// Offsets are added to the device's readings, taking precedence over
+	// the offsets of the --calibration-file.
+	Offsets map[string]float64 `yaml:"offsets"`
+	// Scales multiply the device's readings before the offsets are added.
+	Scales map[string]float64 `yaml:"scales"`
+}
+
+// ProbeModuleConfig configures a module of the /probe endpoint, picked with
+// ?module=, in the --config file.
+type ProbeModuleConfig struct {
+	// Timeout replaces the default probe timeout, still bounded by the
+	// scrape timeout.
+	Timeout            time.Duration `yaml:"timeout"`
+	CAFile             string        `yaml:"ca_file"`
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"`
+	// Labels are added to every series of the probe.
+	Labels map[string]string `yaml:"labels"`
+	// Sensors are the exported fields, detected from the payload when
+	// empty.
+	Sensors []string `yaml:"sensors"`
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	config := &Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// setFromConfig copies a config file value into dst unless the matching
+// flag was set on the command line.
+func setFromConfig[T any](fs *pflag.FlagSet, flag string, dst *T, value *T) {
+	if value != nil && !fs.Changed(flag) {
+		*dst = *value
+	}
+}
+
+// fieldFlags returns the values of a field=value flag from those of the
+// config file.
+func fieldFlags(values map[string]float64) map[string]string {
+	flags := make(map[string]string, len(values))
+	for field, value := range values {
+		flags[field] = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return flags
+}
+
+// applyConfig merges the config file into the options parsed from fs.
+func (app *App) applyConfig(fs *pflag.FlagSet, config *Config) {
+	setFromConfig(fs, "log-level", &app.LogLevel, config.LogLevel)
+	setFromConfig(fs, "log-format", &app.LogFormat, config.LogFormat)
+	setFromConfig(fs, "log-summary-interval", &app.LogSummaryInterval, config.LogSummaryInterval)
+	setFromConfig(fs, "listen", &app.ListenAddress, config.Listen)
+	setFromConfig(fs, "port", &app.ListenPort, config.Port)
+	setFromConfig(fs, "listen-socket-mode", &app.ListenSocketMode, config.ListenSocketMode)
+	setFromConfig(fs, "web.config.file", &app.WebConfigFile, config.WebConfigFile)
+	setFromConfig(fs, "web.enable-lifecycle", &app.EnableLifecycle, config.EnableLifecycle)
+	setFromConfig(fs, "web.telemetry-path", &app.TelemetryPath, config.TelemetryPath)
+	setFromConfig(fs, "web.access-log", &app.AccessLog, config.AccessLog)
+	setFromConfig(fs, "awair-ca-file", &app.CAFile, config.CAFile)
+	setFromConfig(fs, "awair-insecure-skip-verify", &app.InsecureSkipVerify, config.InsecureSkipVerify)
+	setFromConfig(fs, "awair-proxy", &app.Proxy, config.Proxy)
+	setFromConfig(fs, "awair-proxy-from-env", &app.ProxyFromEnv, config.ProxyFromEnv)
+	setFromConfig(fs, "awair-max-body-size", &app.MaxBodySize, config.MaxBodySize)
+	setFromConfig(fs, "awair-user-agent", &app.UserAgent, config.UserAgent)
+	if config.DeviceHeaders != nil && !fs.Changed("awair-header") {
+		app.DeviceHeaders = config.DeviceHeaders
+	}
+	setFromConfig(fs, "awair-cloud-token", &app.CloudToken, config.CloudToken)
+	setFromConfig(fs, "awair-cloud-url", &app.CloudURL, config.CloudURL)
+	setFromConfig(fs, "awair-cloud-poll-frequency", &app.CloudPollFrequency, config.CloudPollFrequency)
+	setFromConfig(fs, "awair-cloud-backfill", &app.CloudBackfill, config.CloudBackfill)
+	setFromConfig(fs, "awair-cloud-inventory", &app.CloudInventoryOnly, config.CloudInventoryOnly)
+	setFromConfig(fs, "poll-frequency", &app.TimeBetweenChecks, config.PollFrequency)
+	setFromConfig(fs, "poll-jitter", &app.PollJitter, config.PollJitter)
+	setFromConfig(fs, "poll-backoff-max", &app.PollBackoffMax, config.PollBackoffMax)
+	setFromConfig(fs, "poll-workers", &app.PollWorkers, config.PollWorkers)
+	setFromConfig(fs, "retry-attempts", &app.RetryAttempts, config.RetryAttempts)
+	setFromConfig(fs, "retry-initial-backoff", &app.RetryInitialBackoff, config.RetryInitialBackoff)
+	setFromConfig(fs, "retry-max-backoff", &app.RetryMaxBackoff, config.RetryMaxBackoff)
+	setFromConfig(fs, "retry-jitter", &app.RetryJitter, config.RetryJitter)
+	setFromConfig(fs, "breaker-failures", &app.BreakerFailures, config.BreakerFailures)
+	setFromConfig(fs, "breaker-interval", &app.BreakerInterval, config.BreakerInterval)
+	setFromConfig(fs, "ready-window", &app.ReadyWindow, config.ReadyWindow)
+	setFromConfig(fs, "sample-timestamps", &app.SampleTimestamps, config.SampleTimestamps)
+	setFromConfig(fs, "temperature-unit", &app.TemperatureUnit, config.TemperatureUnit)
+	setFromConfig(fs, "aqi-nowcast", &app.AQINowCast, config.AQINowCast)
+	setFromConfig(fs, "rolling-windows", &app.RollingWindows, config.RollingWindows)
+	setFromConfig(fs, "rolling-sensors", &app.RollingSensors, config.RollingSensors)
+	if config.Smoothing != nil && !fs.Changed("smoothing") {
+		app.Smoothing = fieldFlags(config.Smoothing)
+	}
+	if config.SpikeLimits != nil && !fs.Changed("spike-limit") {
+		app.SpikeLimit = fieldFlags(config.SpikeLimits)
+	}
+	setFromConfig(fs, "divergence-label", &app.DivergenceLabel, config.DivergenceLabel)
+	setFromConfig(fs, "divergence-window", &app.DivergenceWindow, config.DivergenceWindow)
+	setFromConfig(fs, "divergence-sensors", &app.DivergenceSensors, config.DivergenceSensors)
+	setFromConfig(fs, "calibration-file", &app.CalibrationFile, config.CalibrationFile)
+	setFromConfig(fs, "calibrate-reference", &app.CalibrateReference, config.CalibrateReference)
+	setFromConfig(fs, "calibrate-devices", &app.CalibrateDevices, config.CalibrateDevices)
+	setFromConfig(fs, "calibrate-duration", &app.CalibrateDuration, config.CalibrateDuration)
+	setFromConfig(fs, "timezone", &app.Timezone, config.Timezone)
+	setFromConfig(fs, "history-buffer", &app.HistoryBuffer, config.HistoryBuffer)
+	setFromConfig(fs, "state-file", &app.StateFile, config.StateFile)
+	setFromConfig(fs, "metric-prefix", &app.MetricPrefix, config.MetricPrefix)
+	setFromConfig(fs, "metric-namespace", &app.MetricNamespace, config.MetricNamespace)
+	setFromConfig(fs, "metric-subsystem", &app.MetricSubsystem, config.MetricSubsystem)
+	if config.Labels != nil && !fs.Changed("label") {
+		app.Labels = labelFlags(config.Labels)
+	}
+	setFromConfig(fs, "stale-after", &app.StaleAfter, config.StaleAfter)
+	setFromConfig(fs, "stale-policy", &app.StalePolicy, config.StalePolicy)
+	setFromConfig(fs, "range-policy", &app.RangePolicy, config.RangePolicy)
+	setFromConfig(fs, "stale-after-failures", &app.StaleAfterFailures, config.StaleAfterFailures)
+	setFromConfig(fs, "max-staleness", &app.MaxStaleness, config.MaxStaleness)
+	setFromConfig(fs, "scrape-on-collect", &app.ScrapeOnCollect, config.ScrapeOnCollect)
+	setFromConfig(fs, "device-profile", &app.DeviceProfile, config.DeviceProfile)
+	setFromConfig(fs, "force-sensors", &app.ForceSensors, config.ForceSensors)
+	setFromConfig(fs, "uuid-label", &app.UUIDLabel, config.UUIDLabel)
+	setFromConfig(fs, "discover", &app.Discover, config.Discover)
+	setFromConfig(fs, "discover-interval", &app.DiscoverInterval, config.DiscoverInterval)
+	setFromConfig(fs, "tracing-endpoint", &app.TracingEndpoint, config.TracingEndpoint)
+	if config.TracingHeaders != nil && !fs.Changed("tracing-header") {
+		app.TracingHeaders = config.TracingHeaders
+	}
+	setFromConfig(fs, "kubernetes-devices", &app.KubernetesDevices, config.KubernetesDevices)
+	setFromConfig(fs, "kubernetes-namespace", &app.KubernetesNamespace, config.KubernetesNamespace)
+	setFromConfig(fs, "kubernetes-resync", &app.KubernetesResync, config.KubernetesResync)
+
+	app.Thresholds = config.Thresholds
+}
+
+// configDevices builds the devices listed in the config file.
+func configDevices(configs []DeviceConfig) ([]*Device, error) {
+	devices := make([]*Device, 0, len(configs))
+	seen := map[string]bool{}
+	for _, config := range configs {
+		value := config.Address
+		if config.Name != "" {
+			value = config.Name + "=" + config.Address
+		}
+		device, err := parseDevice(value)
+		if err != nil {
+			return nil, err
+		}
+		if seen[device.Name] {
+			return nil, fmt.Errorf("duplicate device name %q in config", device.Name)
+		}
+		seen[device.Name] = true
+
+		for name := range config.Labels {
+			if err := validateDeviceLabelName(name); err != nil {
+				return nil, fmt.Errorf("invalid device %q: %w", device.Name, err)
+			}
+		}
+		device.ExtraLabels = config.Labels
+		if config.PollFrequency != nil {
+			if err := validatePollFrequency(*config.PollFrequency); err != nil {
+				return nil, fmt.Errorf("invalid device %q: %w", device.Name, err)
+			}
+			device.PollFrequency = *config.PollFrequency
+		}
+		for sensor := range config.Offsets {
+			if !isDeviceOffsetSensor(sensor) {
+				return nil, fmt.Errorf("invalid device %q: offsets only apply to %s, not %q", device.Name, strings.Join(deviceOffsetSensors, ", "), sensor)
+			}
+		}
+		for sensor, scale := range config.Scales {
+			if !isDeviceOffsetSensor(sensor) {
+				return nil, fmt.Errorf("invalid device %q: scales only apply to %s, not %q", device.Name, strings.Join(deviceOffsetSensors, ", "), sensor)
+			}
+			if scale <= 0 {
+				return nil, fmt.Errorf("invalid device %q: scale of %s must be positive", device.Name, sensor)
+			}
+		}
+		device.Offsets = config.Offsets
+		device.Scales = config.Scales
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
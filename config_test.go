@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+poll_frequency: 1m
+retry_attempts: 5
+labels:
+  site: home
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantFrequency time.Duration
+		wantAttempts  int
+		wantLabels    []string
+	}{
+		{
+			name:          "config file over defaults",
+			wantFrequency: time.Minute,
+			wantAttempts:  5,
+			wantLabels:    []string{"site=home"},
+		},
+		{
+			name:          "flags over config file",
+			args:          []string{"--poll-frequency=10s", "--label=site=office"},
+			wantFrequency: 10 * time.Second,
+			wantAttempts:  5,
+			wantLabels:    []string{"site=office"},
+		},
+		{
+			name:          "flag set to its default",
+			args:          []string{"--retry-attempts=3"},
+			wantFrequency: time.Minute,
+			wantAttempts:  3,
+			wantLabels:    []string{"site=home"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{}
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			fs.DurationVar(&app.TimeBetweenChecks, "poll-frequency", 30*time.Second, "")
+			fs.IntVar(&app.RetryAttempts, "retry-attempts", 3, "")
+			fs.StringArrayVar(&app.Labels, "label", nil, "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			app.applyConfig(fs, config)
+
+			if app.TimeBetweenChecks != tt.wantFrequency {
+				t.Errorf("poll frequency = %s, want %s", app.TimeBetweenChecks, tt.wantFrequency)
+			}
+			if app.RetryAttempts != tt.wantAttempts {
+				t.Errorf("retry attempts = %d, want %d", app.RetryAttempts, tt.wantAttempts)
+			}
+			if strings.Join(app.Labels, ",") != strings.Join(tt.wantLabels, ",") {
+				t.Errorf("labels = %v, want %v", app.Labels, tt.wantLabels)
+			}
+		})
+	}
+}
+
+func TestConfigDevices(t *testing.T) {
+	minute := time.Minute
+	zero := time.Duration(0)
+
+	tests := []struct {
+		name    string
+		devices []DeviceConfig
+		wantErr string
+	}{
+		{
+			name: "valid",
+			devices: []DeviceConfig{
+				{Name: "bedroom", Address: "http://192.168.1.20/air-data/latest", Labels: map[string]string{"floor": "1"}, PollFrequency: &minute},
+				{Address: "http://192.168.1.21/air-data/latest", Offsets: map[string]float64{"temp": -1.5}, Scales: map[string]float64{"co2": 0.97}},
+			},
+		},
+		{
+			name: "duplicate name",
+			devices: []DeviceConfig{
+				{Name: "bedroom", Address: "http://192.168.1.20/air-data/latest"},
+				{Name: "bedroom", Address: "http://192.168.1.21/air-data/latest"},
+			},
+			wantErr: `duplicate device name "bedroom"`,
+		},
+		{
+			name:    "reserved label",
+			devices: []DeviceConfig{{Name: "bedroom", Address: "http://192.168.1.20/air-data/latest", Labels: map[string]string{"sensor": "x"}}},
+			wantErr: `label name "sensor" is reserved`,
+		},
+		{
+			name:    "invalid label",
+			devices: []DeviceConfig{{Name: "bedroom", Address: "http://192.168.1.20/air-data/latest", Labels: map[string]string{"__name": "x"}}},
+			wantErr: `invalid label name "__name"`,
+		},
+		{
+			name:    "zero poll frequency",
+			devices: []DeviceConfig{{Name: "bedroom", Address: "http://192.168.1.20/air-data/latest", PollFrequency: &zero}},
+			wantErr: "poll-frequency must be positive",
+		},
+		{
+			name:    "offset of a derived field",
+			devices: []DeviceConfig{{Name: "bedroom", Address: "http://192.168.1.20/air-data/latest", Offsets: map[string]float64{"dew_point": 1}}},
+			wantErr: `offsets only apply to temp, humid, co2, not "dew_point"`,
+		},
+		{
+			name:    "zero scale",
+			devices: []DeviceConfig{{Name: "bedroom", Address: "http://192.168.1.20/air-data/latest", Scales: map[string]float64{"co2": 0}}},
+			wantErr: "scale of co2 must be positive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices, err := configDevices(tt.devices)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("configDevices() error = %v", err)
+				}
+				if len(devices) != len(tt.devices) {
+					t.Errorf("configDevices() returned %d devices, want %d", len(devices), len(tt.devices))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("configDevices() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTelemetryPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{"/metrics", false},
+		{"/exporter/metrics", false},
+		{"metrics", true},
+		{"/", true},
+		{"/healthz", true},
+		{"/reports/metrics", true},
+	}
+	for _, tt := range tests {
+		if err := validateTelemetryPath(tt.path); (err != nil) != tt.wantErr {
+			t.Errorf("validateTelemetryPath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// dailySensors are the payload fields exported as daily summaries.
+var dailySensors = []string{"temp", "co2", "pm25"}
+
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+	return location, nil
+}
+
+func (app *App) initializeDailyMetrics() {
+	app.DailySummaryGauges = map[string]*prometheus.GaugeVec{}
+	for _, field := range dailySensors {
+		app.DailySummaryGauges[field] = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: app.metricNamespace(),
+			Subsystem: app.MetricSubsystem,
+			Name:      climateMetricNames[field] + "_daily",
+			Help:      "Minimum, maximum and mean of the " + field + " readings since midnight in --timezone",
+		}, append(app.deviceLabelNames(), "stat"))
+	}
+}
+
+func statLabels(device *Device, stat string) prometheus.Labels {
+	labels := prometheus.Labels{"stat": stat}
+	for name, value := range device.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// recordDailySummary exports the summaries of the current day kept for the
+// reports. They start over with the first reading after midnight.
+func (app *App) recordDailySummary(device *Device) {
+	h := &device.Reports
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.days) == 0 {
+		return
+	}
+	today := h.days[len(h.days)-1]
+
+	for field, gauge := range app.DailySummaryGauges {
+		summary, ok := today.Sensors[field]
+		if !ok || summary.Count == 0 {
+			continue
+		}
+		gauge.With(statLabels(device, "min")).Set(summary.Min)
+		gauge.With(statLabels(device, "max")).Set(summary.Max)
+		gauge.With(statLabels(device, "mean")).Set(summary.Sum / float64(summary.Count))
+	}
+}
+
+func (app *App) deleteDailySummary(device *Device) {
+	for _, gauge := range app.DailySummaryGauges {
+		for _, stat := range []string{"min", "max", "mean"} {
+			gauge.Delete(statLabels(device, stat))
+		}
+	}
+}
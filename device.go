@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Device is an Awair device polled by the exporter. Its name is used as the
+// device label on every per-device metric.
+type Device struct {
+	Name    string
+	Address string
+	// ExtraLabels are added to the device's series from the config file.
+	ExtraLabels map[string]string
+	// PollFrequency overrides --poll-frequency when set. Guarded by
+	// App.devicesMu once the device is started.
+	PollFrequency time.Duration
+	// Offsets and Scales are the device's calibration from the config
+	// file. Guarded by App.devicesMu once the device is started.
+	Offsets map[string]float64
+	Scales  map[string]float64
+	// Discovered is set for devices found by --discover rather than
+	// configured.
+	Discovered bool
+	// Cloud is set for devices polled from the Awair Cloud API rather than
+	// their local API.
+	Cloud bool
+	// Labels identify the device on its series.
+	Labels prometheus.Labels
+
+	Status          DeviceStatus
+	Baselines       BaselineTracker
+	ScoreHistory    ScoreHistory
+	AQIHistory      AQIHistory
+	MoldRisk        MoldRisk
+	RollingAverages RollingAverages
+	Smoothing       Smoothing
+	Spikes          SpikeFilter
+	// Divergence keeps the --divergence-sensors readings compared with the
+	// other devices of the group.
+	Divergence RollingAverages
+	Rates      RateTracker
+	Thresholds ThresholdStates
+	History    HistoryBuffer
+	Reports    ReportHistory
+	Profile    deviceProfile
+
+	climateExpired  bool
+	profileDetected bool
+	// backfillPending is set until the first successful poll hands the
+	// time of its reading to the backfill task over firstReading.
+	backfillPending bool
+	firstReading    chan time.Time
+	pollLock        chan struct{}
+	// breakerOpen is set while the circuit breaker stops regular polling.
+	breakerOpen atomic.Bool
+	// responseCodes holds the HTTP status codes the device answered with,
+	// to delete their response counters with the device.
+	responseCodes sync.Map
+
+	// collectors are the device's own registered metrics.
+	collectors []prometheus.Collector
+	cancel     context.CancelFunc
+	// tasks tracks the device's background goroutines.
+	tasks sync.WaitGroup
+	// infoLabels are the labels of the current device info series.
+	infoLabels prometheus.Labels
+	// uuid is the UUID from the device's config endpoint, once fetched.
+	uuid atomic.Value
+}
+
+// UUID returns the device UUID from its config endpoint, or "" until it has
+// been fetched.
+func (d *Device) UUID() string {
+	uuid, _ := d.uuid.Load().(string)
+	return uuid
+}
+
+func newDevice(name, address string) *Device {
+	return &Device{
+		Name:    name,
+		Address: address,
+		Baselines: BaselineTracker{
+			history: map[string]*baselineHistory{},
+			alerted: map[string]bool{},
+		},
+		pollLock: make(chan struct{}, 1),
+	}
+}
+
+// parseDevice parses an --awair-address value, either a bare URL or
+// name=URL. Devices given as a bare URL are named after the URL's host.
+func parseDevice(value string) (*Device, error) {
+	name, address, found := strings.Cut(value, "=")
+	if !found || strings.Contains(name, "/") {
+		name, address = "", value
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid awair address %q: %w", value, err)
+	}
+	if name == "" {
+		name = u.Host
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid awair address %q: missing host", value)
+	}
+
+	return newDevice(name, address), nil
+}
+
+func parseDevices(values []string) ([]*Device, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("at least one awair address is required")
+	}
+
+	devices := make([]*Device, 0, len(values))
+	seen := map[string]bool{}
+	for _, value := range values {
+		device, err := parseDevice(value)
+		if err != nil {
+			return nil, err
+		}
+		if seen[device.Name] {
+			return nil, fmt.Errorf("duplicate device name %q, use name=URL to tell devices apart", device.Name)
+		}
+		seen[device.Name] = true
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// deviceLabelNames returns the names of the labels identifying a device,
+// the device name followed by the extra labels of the configured devices.
+func (app *App) deviceLabelNames() []string {
+	return append([]string{"device"}, app.ExtraLabelNames...)
+}
+
+// deviceLabels returns the label values identifying a device. Extra labels
+// the device does not set are left empty, as is the uuid label of
+// --uuid-label until the device UUID has been fetched.
+func (app *App) deviceLabels(device *Device) prometheus.Labels {
+	labels := prometheus.Labels{"device": device.Name}
+	for _, name := range app.ExtraLabelNames {
+		labels[name] = device.ExtraLabels[name]
+	}
+	if app.UUIDLabel {
+		labels[uuidLabel] = device.UUID()
+	}
+	if app.CloudInventoryOnly {
+		app.setCloudLabels(labels, device)
+	}
+	return labels
+}
+
+// extraLabelNames returns the sorted union of the devices' extra labels.
+func extraLabelNames(devices []*Device) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, device := range devices {
+		for name := range device.ExtraLabels {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pollFrequency returns how often the device is polled, or the default
+// --poll-frequency for a nil device.
+func (app *App) pollFrequency(device *Device) time.Duration {
+	app.devicesMu.RLock()
+	defer app.devicesMu.RUnlock()
+
+	if device != nil && device.PollFrequency > 0 {
+		return device.PollFrequency
+	}
+	return app.TimeBetweenChecks
+}
+
+// devices returns a snapshot of the polled devices.
+func (app *App) devices() []*Device {
+	app.devicesMu.RLock()
+	defer app.devicesMu.RUnlock()
+
+	return append([]*Device(nil), app.Devices...)
+}
+
+// device returns the polled device with the given name, or nil.
+func (app *App) device(name string) *Device {
+	app.devicesMu.RLock()
+	defer app.devicesMu.RUnlock()
+
+	for _, device := range app.Devices {
+		if device.Name == name {
+			return device
+		}
+	}
+	return nil
+}
+
+// startDevice sets up the device's metrics and polls it until ctx is done
+// or the device is stopped. With --scrape-on-collect the device is only
+// polled by scrapes.
+func (app *App) startDevice(ctx context.Context, device *Device) {
+	ctx, device.cancel = context.WithCancel(ctx)
+	device.Labels = app.deviceLabels(device)
+	app.initializeProfile(device)
+	app.initializeDeviceSeries(device)
+	app.restoreDevice(device)
+	device.History.init(app.historyCapacity(device))
+	device.backfillPending = app.CloudBackfill > 0
+	device.firstReading = make(chan time.Time, 1)
+
+	app.devicesMu.Lock()
+	app.Devices = append(app.Devices, device)
+	app.devicesMu.Unlock()
+
+	// Cloud devices have no local config endpoint.
+	if !device.Cloud {
+		app.runDeviceTask(ctx, device, "info", app.recordDeviceInfo)
+	}
+	if device.backfillPending {
+		app.runDeviceTask(ctx, device, "backfill", app.runBackfill)
+	}
+	if !app.ScrapeOnCollect {
+		app.runDeviceTask(ctx, device, "poller", app.recordMetrics)
+	}
+}
+
+// initializeDeviceSeries registers the device's own metrics and exports the
+// series known before the first poll.
+func (app *App) initializeDeviceSeries(device *Device) {
+	device.collectors = app.initializeStalenessMetrics(device)
+	app.initializeScoreDeltas(device)
+	// Export the poll counters at zero before the first poll.
+	app.PollsCounter.With(device.Labels)
+	app.PollErrorsCounter.With(device.Labels)
+	app.PollRetriesCounter.With(device.Labels)
+	app.DuplicateSamplesCounter.With(device.Labels)
+	for field := range app.SpikeLimits {
+		app.RejectedSamplesCounter.With(spikeLabels(device, field))
+	}
+	app.recordCalibrationMetrics(device)
+}
+
+// runDeviceTask runs a supervised background goroutine for the device.
+func (app *App) runDeviceTask(ctx context.Context, device *Device, name string, fn func(ctx context.Context, device *Device)) {
+	app.pollers.Add(1)
+	device.tasks.Add(1)
+	go func() {
+		defer app.pollers.Done()
+		defer device.tasks.Done()
+		app.supervise(ctx, name+":"+device.Name, func(ctx context.Context) {
+			fn(ctx, device)
+		})
+	}()
+}
+
+// stopDevice stops polling the device and removes all of its series.
+func (app *App) stopDevice(device *Device) {
+	app.devicesMu.Lock()
+	for i, d := range app.Devices {
+		if d == device {
+			app.Devices = append(app.Devices[:i:i], app.Devices[i+1:]...)
+			break
+		}
+	}
+	app.devicesMu.Unlock()
+
+	device.cancel()
+	device.tasks.Wait()
+	// Wait for a poll in flight from a scrape, and block any later one.
+	device.pollLock <- struct{}{}
+
+	app.deleteDeviceSeries(device)
+}
+
+// deleteDeviceSeries unregisters the device's own metrics and removes every
+// series labelled with the device's labels.
+func (app *App) deleteDeviceSeries(device *Device) {
+	for _, field := range app.climateFields(device.Profile) {
+		app.climateGaugeForField(field).Delete(device.Labels)
+	}
+	for _, gauge := range app.RawGauges {
+		gauge.Delete(device.Labels)
+	}
+	for _, collector := range device.collectors {
+		prometheus.Unregister(collector)
+	}
+	app.LastSampleTimestampGauge.Delete(device.Labels)
+	app.ClockSkewGauge.Delete(device.Labels)
+	if device.infoLabels != nil {
+		app.DeviceInfoGauge.Delete(device.infoLabels)
+	}
+	app.WifiRSSIGauge.Delete(device.Labels)
+	app.PollsCounter.Delete(device.Labels)
+	app.PollErrorsCounter.Delete(device.Labels)
+	app.LastPollSuccessGauge.Delete(device.Labels)
+	app.DeviceUpGauge.Delete(device.Labels)
+	app.PollDuration.Delete(device.Labels)
+	app.PollRetriesCounter.Delete(device.Labels)
+	app.DuplicateSamplesCounter.Delete(device.Labels)
+	for field := range app.SpikeLimits {
+		app.RejectedSamplesCounter.Delete(spikeLabels(device, field))
+	}
+	for field := range sensorRanges {
+		app.RangeViolationsCounter.Delete(rangeLabels(device, field))
+	}
+	device.responseCodes.Range(func(code, _ interface{}) bool {
+		app.PollHTTPResponsesCounter.Delete(responseLabels(device, code.(int)))
+		return true
+	})
+	app.deleteBaselineSeries(device)
+	app.deleteScoreDeltas(device)
+	app.deleteScoreComponents(device)
+	app.deleteMoldRisk(device)
+	app.PM25AQIGauge.Delete(device.Labels)
+	app.deleteRollingAverages(device)
+	app.deleteDivergence(device)
+	app.deleteCalibrationMetrics(device)
+	app.deleteDailySummary(device)
+	app.deleteRates(device)
+	app.deleteThresholds(device)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epk/awair-local-prom-exporter/pkg/awair"
+	"go.uber.org/zap"
+)
+
+// DeviceStatus tracks the outcome of polls against the Awair device.
+type DeviceStatus struct {
+	mu sync.Mutex
+
+	lastAttempt         time.Time
+	lastSuccess         time.Time
+	lastError           string
+	lastErrorTime       time.Time
+	consecutiveFailures int
+	lastSampleTime      time.Time
+	clockSkew           time.Duration
+	latest              *AwairStats
+}
+
+func (s *DeviceStatus) recordSuccess(stats AwairStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.lastAttempt = now
+	s.lastSuccess = now
+	s.consecutiveFailures = 0
+	s.lastSampleTime = stats.Timestamp
+	s.clockSkew = 0
+	if !stats.Timestamp.IsZero() {
+		s.clockSkew = stats.Timestamp.Sub(now)
+	}
+	s.latest = &stats
+}
+
+func (s *DeviceStatus) recordFailure(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.lastAttempt = now
+	s.lastError = err.Error()
+	s.lastErrorTime = now
+	s.consecutiveFailures++
+}
+
+func (s *DeviceStatus) LastSuccess() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastSuccess
+}
+
+// ClockSkew returns the device sample time minus the exporter's clock when
+// the last reading arrived, which includes the age of the sample.
+func (s *DeviceStatus) ClockSkew() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.clockSkew
+}
+
+func (s *DeviceStatus) LastSampleTime() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastSampleTime
+}
+
+// Latest returns the most recent reading and when it was polled.
+func (s *DeviceStatus) Latest() (*AwairStats, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.latest, s.lastSuccess
+}
+
+func (s *DeviceStatus) ConsecutiveFailures() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.consecutiveFailures
+}
+
+type deviceDiagnostics struct {
+	Name                string     `json:"name"`
+	Address             string     `json:"address"`
+	Reachable           bool       `json:"reachable"`
+	LastAttempt         *time.Time `json:"last_attempt,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorTime       *time.Time `json:"last_error_time,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastSampleTime      *time.Time `json:"last_sample_time,omitempty"`
+	ClockSkewSeconds    float64    `json:"clock_skew_seconds"`
+}
+
+type sinkDiagnostics struct {
+	Name    string `json:"name"`
+	Backlog *int   `json:"backlog,omitempty"`
+}
+
+type runtimeDiagnostics struct {
+	GoVersion      string  `json:"go_version"`
+	GoMaxProcs     int     `json:"gomaxprocs"`
+	Goroutines     int     `json:"goroutines"`
+	HeapAllocBytes uint64  `json:"heap_alloc_bytes"`
+	HeapSysBytes   uint64  `json:"heap_sys_bytes"`
+	NumGC          uint32  `json:"num_gc"`
+	UptimeSeconds  float64 `json:"uptime_seconds"`
+}
+
+type diagnosticsReport struct {
+	Time           time.Time           `json:"time"`
+	Devices        []deviceDiagnostics `json:"devices"`
+	Sinks          []sinkDiagnostics   `json:"sinks"`
+	Runtime        runtimeDiagnostics  `json:"runtime"`
+	ConfigWarnings []string            `json:"config_warnings"`
+}
+
+// backlogger is implemented by sinks that buffer readings before delivery.
+type backlogger interface {
+	Backlog() int
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (device *Device) diagnostics() deviceDiagnostics {
+	s := &device.Status
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return deviceDiagnostics{
+		Name:                device.Name,
+		Address:             device.Address,
+		Reachable:           !s.lastSuccess.IsZero() && s.consecutiveFailures == 0,
+		LastAttempt:         optionalTime(s.lastAttempt),
+		LastSuccess:         optionalTime(s.lastSuccess),
+		LastError:           s.lastError,
+		LastErrorTime:       optionalTime(s.lastErrorTime),
+		ConsecutiveFailures: s.consecutiveFailures,
+		LastSampleTime:      optionalTime(s.lastSampleTime),
+		ClockSkewSeconds:    s.clockSkew.Seconds(),
+	}
+}
+
+// configWarnings reports settings that are valid but likely to cause
+// confusing results.
+func (app *App) configWarnings() []string {
+	warnings := []string{}
+
+	for _, device := range app.devices() {
+		u, err := url.Parse(device.Address)
+		switch {
+		case err != nil:
+			warnings = append(warnings, device.Name+": awair-address is not a valid URL: "+err.Error())
+		case u.Scheme != "http" && u.Scheme != "https":
+			warnings = append(warnings, device.Name+": awair-address should use the http or https scheme")
+		case !strings.HasSuffix(u.Path, awair.LatestPath):
+			warnings = append(warnings, device.Name+": awair-address does not point at the /air-data/latest endpoint")
+		}
+
+		if !app.ScrapeOnCollect && app.pollFrequency(device) < 10*time.Second {
+			warnings = append(warnings, device.Name+": poll-frequency is below 10s, the device only refreshes its sample every ~10s")
+		}
+	}
+
+	return warnings
+}
+
+func (app *App) diagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	report := diagnosticsReport{
+		Time:    time.Now(),
+		Devices: []deviceDiagnostics{},
+		Sinks:   []sinkDiagnostics{},
+		Runtime: runtimeDiagnostics{
+			GoVersion:      runtime.Version(),
+			GoMaxProcs:     runtime.GOMAXPROCS(0),
+			Goroutines:     runtime.NumGoroutine(),
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapSysBytes:   mem.HeapSys,
+			NumGC:          mem.NumGC,
+			UptimeSeconds:  time.Since(app.StartTime).Seconds(),
+		},
+		ConfigWarnings: app.configWarnings(),
+	}
+
+	for _, device := range app.devices() {
+		report.Devices = append(report.Devices, device.diagnostics())
+	}
+
+	for name, sink := range app.Sinks {
+		diag := sinkDiagnostics{Name: name}
+		if b, ok := sink.(backlogger); ok {
+			backlog := b.Backlog()
+			diag.Backlog = &backlog
+		}
+		report.Sinks = append(report.Sinks, diag)
+	}
+	sort.Slice(report.Sinks, func(i, j int) bool { return report.Sinks[i].Name < report.Sinks[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		app.Logger.Error("Error writing diagnostics", zap.Error(err))
+	}
+}
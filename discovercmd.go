@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// maxSweepHosts bounds the addresses of a --cidr sweep, a /20.
+const maxSweepHosts = 4096
+
+func init() {
+	registerCommand("discover", command{
+		Usage: "Find the Awair devices on the LAN over mDNS and, with --cidr, by asking every address of the ranges for its device metadata.\nPrints the devices' names, addresses, models and firmware, or with --config the devices stanza of a config file.",
+		Run:   runDiscover,
+	})
+}
+
+// foundDevice is an Awair device found by the discover command.
+type foundDevice struct {
+	Name     string
+	Address  string
+	Model    string
+	Firmware string
+}
+
+func runDiscover(fs *pflag.FlagSet, args []string) int {
+	useMDNS := fs.Bool("mdns", true, "Browse mDNS for devices")
+	cidrs := fs.StringSlice("cidr", nil, "Comma-separated IPv4 ranges to sweep for devices, e.g. 192.168.1.0/24 (repeatable)")
+	port := fs.Uint16("port", 80, "Port of the devices' local API on the swept addresses")
+	timeout := fs.Duration("timeout", 500*time.Millisecond, "Time to wait for each swept address")
+	concurrency := fs.Int("concurrency", 64, "Number of addresses swept at once")
+	asConfig := fs.Bool("config", false, "Print the devices stanza of a config file instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "concurrency must be positive")
+		return 2
+	}
+
+	var hosts []netip.Addr
+	for _, cidr := range *cidrs {
+		addrs, err := cidrHosts(cidr, maxSweepHosts-len(hosts))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		hosts = append(hosts, addrs...)
+	}
+
+	client, err := newDeviceClient("", false, "", false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	app := &App{Logger: zap.NewNop(), Client: client}
+	ctx := context.Background()
+
+	var addresses []string
+	names := map[string]string{}
+	if *useMDNS {
+		services, err := browseMDNS(ctx, awairService, discoveryQueryWindow)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		for _, service := range services {
+			if isAwairService(service) {
+				address := discoveredAddress(service)
+				addresses = append(addresses, address)
+				names[address] = discoveredName(service)
+			}
+		}
+	}
+	for _, host := range hosts {
+		hostPort := host.String()
+		if *port != 80 {
+			hostPort = net.JoinHostPort(hostPort, strconv.Itoa(int(*port)))
+		}
+		addresses = append(addresses, fmt.Sprintf("http://%s/air-data/latest", hostPort))
+	}
+
+	devices := app.identifyDevices(ctx, addresses, names, *timeout, *concurrency)
+	if len(devices) == 0 {
+		fmt.Fprintln(os.Stderr, "no Awair devices found")
+		return 1
+	}
+	if *asConfig {
+		printDevicesConfig(os.Stdout, devices)
+	} else {
+		printFoundDevices(os.Stdout, devices)
+	}
+	return 0
+}
+
+// cidrHosts returns the host addresses of an IPv4 range, without its
+// network and broadcast addresses, failing when there are more than max.
+func cidrHosts(cidr string, max int) ([]netip.Addr, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cidr %q: %w", cidr, err)
+	}
+	if !prefix.Addr().Is4() {
+		return nil, fmt.Errorf("invalid cidr %q: only IPv4 ranges can be swept", cidr)
+	}
+	prefix = prefix.Masked()
+	if bits := 32 - prefix.Bits(); bits > 30 || 1<<bits > max {
+		return nil, fmt.Errorf("cidr %q has too many addresses to sweep, at most %d in total", cidr, maxSweepHosts)
+	}
+
+	var hosts []netip.Addr
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, addr)
+	}
+	// /31 and /32 ranges have no network and broadcast addresses.
+	if prefix.Bits() < 31 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// identifyDevices asks each address for its device metadata, returning the
+// Awair devices sorted by name. Devices found twice, e.g. over mDNS and in a
+// swept range, are listed once.
+func (app *App) identifyDevices(ctx context.Context, addresses []string, names map[string]string, timeout time.Duration, concurrency int) []foundDevice {
+	var mu sync.Mutex
+	found := map[string]foundDevice{}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, address := range addresses {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(address string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			config, err := app.fetchDeviceConfig(ctx, newDevice("", address))
+			if err != nil || !strings.HasPrefix(config.DeviceUUID, awairInstancePrefix) {
+				return
+			}
+			name := names[address]
+			if name == "" {
+				// e.g. awair-element-12345 from awair-element_12345.
+				name = strings.ReplaceAll(config.DeviceUUID, "_", "-")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := found[config.DeviceUUID]; !ok || names[address] != "" {
+				found[config.DeviceUUID] = foundDevice{Name: name, Address: address, Model: config.Model(), Firmware: config.FwVersion}
+			}
+		}(address)
+	}
+	wg.Wait()
+
+	devices := make([]foundDevice, 0, len(found))
+	for _, device := range found {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	return devices
+}
+
+func printFoundDevices(out io.Writer, devices []foundDevice) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tADDRESS\tMODEL\tFIRMWARE")
+	for _, device := range devices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", device.Name, device.Address, device.Model, device.Firmware)
+	}
+	w.Flush()
+}
+
+// printDevicesConfig prints the devices as the devices list of a --config
+// file.
+func printDevicesConfig(out io.Writer, devices []foundDevice) {
+	fmt.Fprintln(out, "devices:")
+	for _, device := range devices {
+		fmt.Fprintf(out, "  # %s, firmware %s\n", device.Model, device.Firmware)
+		fmt.Fprintf(out, "  - name: %s\n", device.Name)
+		fmt.Fprintf(out, "    address: %s\n", device.Address)
+	}
+}
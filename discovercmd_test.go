@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/epk/awair-local-prom-exporter/pkg/awair"
+	"go.uber.org/zap"
+)
+
+func TestCIDRHosts(t *testing.T) {
+	tests := []struct {
+		cidr      string
+		wantFirst string
+		wantLast  string
+		wantCount int
+		wantErr   bool
+	}{
+		{cidr: "192.168.1.0/24", wantFirst: "192.168.1.1", wantLast: "192.168.1.254", wantCount: 254},
+		{cidr: "192.168.1.77/30", wantFirst: "192.168.1.77", wantLast: "192.168.1.78", wantCount: 2},
+		{cidr: "10.0.0.5/32", wantFirst: "10.0.0.5", wantLast: "10.0.0.5", wantCount: 1},
+		{cidr: "10.0.0.0/16", wantErr: true},
+		{cidr: "fd00::/120", wantErr: true},
+		{cidr: "192.168.1.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		hosts, err := cidrHosts(tt.cidr, maxSweepHosts)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("cidrHosts(%q) error = %v, wantErr %v", tt.cidr, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if len(hosts) != tt.wantCount || hosts[0].String() != tt.wantFirst || hosts[len(hosts)-1].String() != tt.wantLast {
+			t.Errorf("cidrHosts(%q) = %d hosts from %s to %s, want %d from %s to %s", tt.cidr, len(hosts), hosts[0], hosts[len(hosts)-1], tt.wantCount, tt.wantFirst, tt.wantLast)
+		}
+	}
+}
+
+func TestIdentifyDevices(t *testing.T) {
+	newServer := func(uuid string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != awair.ConfigPath {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"device_uuid":"` + uuid + `","fw_version":"1.4.0"}`))
+		}))
+	}
+	element := newServer("awair-element_123")
+	defer element.Close()
+	other := newServer("printer_1")
+	defer other.Close()
+
+	elementAddress := element.URL + "/air-data/latest"
+	app := &App{Logger: zap.NewNop(), Client: http.DefaultClient}
+	// The element is found both over mDNS, named after its host, and swept.
+	devices := app.identifyDevices(context.Background(), []string{elementAddress, other.URL + "/air-data/latest", elementAddress, "http://127.0.0.1:1/air-data/latest"},
+		map[string]string{elementAddress: "awair-elem-1a2b3c"}, time.Second, 2)
+
+	want := []foundDevice{{Name: "awair-elem-1a2b3c", Address: elementAddress, Model: "awair-element", Firmware: "1.4.0"}}
+	if len(devices) != 1 || devices[0] != want[0] {
+		t.Fatalf("identifyDevices() = %+v, want %+v", devices, want)
+	}
+
+	out := &bytes.Buffer{}
+	printDevicesConfig(out, devices)
+	if !strings.Contains(out.String(), "  - name: awair-elem-1a2b3c\n    address: "+elementAddress+"\n") {
+		t.Errorf("printDevicesConfig() = %s", out)
+	}
+}
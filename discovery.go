@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// awairService is the mDNS service Awair devices advertise their local API
+// under, with instances named after the device, e.g. "AWAIR-ELEM-1A2B3C".
+const (
+	awairService         = "_http._tcp.local."
+	awairInstancePrefix  = "awair"
+	discoveryQueryWindow = 3 * time.Second
+)
+
+// discoverDevices browses the LAN for Awair devices every
+// --discover-interval and starts polling the ones not polled yet.
+func (app *App) discoverDevices(ctx context.Context) {
+	ticker := time.NewTicker(app.DiscoverInterval)
+	defer ticker.Stop()
+
+	for {
+		app.discover(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (app *App) discover(ctx context.Context) {
+	services, err := browseMDNS(ctx, awairService, discoveryQueryWindow)
+	if err != nil {
+		app.Logger.Error("Error discovering devices", zap.Error(err))
+		return
+	}
+
+	addresses := map[string]bool{}
+	names := map[string]bool{}
+	for _, device := range app.devices() {
+		addresses[device.Address] = true
+		names[device.Name] = true
+	}
+
+	for _, service := range services {
+		if !isAwairService(service) {
+			continue
+		}
+
+		address := discoveredAddress(service)
+		if addresses[address] {
+			continue
+		}
+
+		name := discoveredName(service)
+		if names[name] {
+			app.Logger.Warn("Discovered device has the same name as a polled device, skipping",
+				zap.String("device", name),
+				zap.String("awair_address", address),
+			)
+			continue
+		}
+
+		app.Logger.Info("Discovered device", zap.String("device", name), zap.String("awair_address", address))
+		device := newDevice(name, address)
+		device.Discovered = true
+		app.startDevice(ctx, device)
+		addresses[address] = true
+		names[name] = true
+	}
+}
+
+// isAwairService reports whether an mDNS service instance is an Awair
+// device's local API.
+func isAwairService(service mdnsService) bool {
+	return strings.HasPrefix(strings.ToLower(service.Instance), awairInstancePrefix)
+}
+
+// discoveredName returns the name of a discovered device, its mDNS host
+// name.
+func discoveredName(service mdnsService) string {
+	return strings.ToLower(strings.TrimSuffix(service.Host, ".local."))
+}
+
+// discoveredAddress returns the air-data URL of a discovered device.
+func discoveredAddress(service mdnsService) string {
+	host := service.IP.String()
+	if service.Port != 80 {
+		host = net.JoinHostPort(host, strconv.Itoa(int(service.Port)))
+	}
+	return fmt.Sprintf("http://%s/air-data/latest", host)
+}
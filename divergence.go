@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// validateDivergence checks the divergence flags once the device label names
+// are known.
+func (app *App) validateDivergence() error {
+	if app.DivergenceLabel == "" {
+		return nil
+	}
+	if app.DivergenceWindow <= 0 {
+		return fmt.Errorf("divergence-window must be positive")
+	}
+	if err := validateForceSensors(app.DivergenceSensors); err != nil {
+		return fmt.Errorf("invalid divergence sensors: %w", err)
+	}
+	for _, name := range app.ExtraLabelNames {
+		if name == app.DivergenceLabel {
+			return nil
+		}
+	}
+	return fmt.Errorf("divergence-label %q is not a label of the devices", app.DivergenceLabel)
+}
+
+func (app *App) initializeDivergenceMetrics() {
+	if app.DivergenceLabel == "" {
+		return
+	}
+
+	app.DivergenceGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Name:      "device_divergence",
+		Help:      "Difference between the device's mean reading over --divergence-window and the median of the other devices sharing its --divergence-label",
+	}, append(app.deviceLabelNames(), "sensor"))
+}
+
+func divergenceLabels(device *Device, sensor string) prometheus.Labels {
+	labels := prometheus.Labels{"sensor": sensor}
+	for name, value := range device.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// median returns the median of values, which must not be empty.
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// divergencePeers returns the other devices sharing the device's group.
+func (app *App) divergencePeers(device *Device) []*Device {
+	app.devicesMu.RLock()
+	defer app.devicesMu.RUnlock()
+
+	group := device.Labels[app.DivergenceLabel]
+	if group == "" {
+		return nil
+	}
+	peers := []*Device{}
+	for _, other := range app.Devices {
+		if other != device && other.Labels[app.DivergenceLabel] == group {
+			peers = append(peers, other)
+		}
+	}
+	return peers
+}
+
+// recordDivergence compares the device's mean readings over the window with
+// those of the other devices of its group. Against the median of several
+// peers a drifting unit stands out, while the others stay close to zero;
+// with a single peer both devices diverge by the same amount.
+func (app *App) recordDivergence(device *Device, stats AwairStats) {
+	if app.DivergenceGauge == nil {
+		return
+	}
+
+	at := readingTime(stats)
+	since := at.Add(-app.DivergenceWindow)
+	peers := app.divergencePeers(device)
+	for _, field := range app.DivergenceSensors {
+		if !device.Profile.has(field) || !hasField(stats, field) {
+			continue
+		}
+		own := device.Divergence.add(field, at, fieldValue(stats, field), []time.Duration{app.DivergenceWindow})[0]
+
+		means := []float64{}
+		for _, peer := range peers {
+			if mean, ok := peer.Divergence.meanSince(field, since); ok {
+				means = append(means, mean)
+			}
+		}
+		labels := divergenceLabels(device, field)
+		if len(means) == 0 {
+			app.DivergenceGauge.Delete(labels)
+			continue
+		}
+		app.DivergenceGauge.With(labels).Set(own - median(means))
+	}
+}
+
+func (app *App) deleteDivergence(device *Device) {
+	if app.DivergenceGauge == nil {
+		return
+	}
+	for _, field := range app.DivergenceSensors {
+		app.DivergenceGauge.Delete(divergenceLabels(device, field))
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{[]float64{4}, 4},
+		{[]float64{9, 1, 5}, 5},
+		{[]float64{8, 2, 4, 6}, 5},
+	}
+	for _, tt := range tests {
+		if got := median(tt.values); got != tt.want {
+			t.Errorf("median(%v) = %v, want %v", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestRecordDivergence(t *testing.T) {
+	app := &App{
+		DivergenceLabel:   "room",
+		DivergenceWindow:  time.Hour,
+		DivergenceSensors: []string{"pm25", "co2"},
+		DivergenceGauge:   prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "divergence"}, []string{"device", "room", "sensor"}),
+	}
+	newRoomDevice := func(name, room string) *Device {
+		device := newDevice(name, "http://"+name)
+		device.Labels = prometheus.Labels{"device": name, "room": room}
+		device.Profile = deviceProfile{Fields: []string{"pm25"}}
+		app.Devices = append(app.Devices, device)
+		return device
+	}
+	a := newRoomDevice("a", "office")
+	b := newRoomDevice("b", "office")
+	c := newRoomDevice("c", "office")
+	other := newRoomDevice("other", "bedroom")
+
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	// The window drops the first readings, taken over an hour before the
+	// last ones.
+	readings := []struct {
+		device *Device
+		at     time.Duration
+		pm25   int
+	}{
+		{a, 0, 100},
+		{a, 90 * time.Minute, 10},
+		{b, 90 * time.Minute, 12},
+		{other, 90 * time.Minute, 50},
+		{c, 100 * time.Minute, 40},
+		{c, 110 * time.Minute, 30},
+		{a, 110 * time.Minute, 10},
+	}
+	for _, r := range readings {
+		app.recordDivergence(r.device, AwairStats{Timestamp: start.Add(r.at), Pm25: r.pm25})
+	}
+
+	// A device alone in its room and a sensor outside the profile have
+	// nothing to compare.
+	if n := testutil.CollectAndCount(app.DivergenceGauge); n != 3 {
+		t.Errorf("divergence series = %d, want 3", n)
+	}
+
+	want := map[*Device]float64{
+		// a: 10 against the median of b's 12 and c's 35, once polled again.
+		a: 10 - 23.5,
+		// b was compared with a alone, c had no readings yet.
+		b: 12 - 10,
+		// c: 35 against the median of 10 and 12.
+		c: 35 - 11,
+	}
+	for device, value := range want {
+		labels := divergenceLabels(device, "pm25")
+		if got := testutil.ToFloat64(app.DivergenceGauge.With(labels)); got != value {
+			t.Errorf("divergence of %s = %v, want %v", device.Name, got, value)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const eventsKeepAlive = time.Second * 15
+
+// eventsHandler streams each new reading of every device, or of the one named
+// by the device query parameter, as Server-Sent Events. Event IDs are the
+// reading times in Unix nanoseconds, so a client reconnecting with
+// Last-Event-ID is first sent the buffered readings it missed.
+func (app *App) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("device")
+	var device *Device
+	if name != "" {
+		if device = app.device(name); device == nil {
+			http.Error(w, "unknown device", http.StatusNotFound)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before replaying so no reading falls in between.
+	readings := app.Stream.subscribe(name)
+	if readings == nil {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer app.Stream.unsubscribe(readings)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", app.pollFrequency(device).Milliseconds())
+
+	// sent holds the time of the last reading sent for each device.
+	sent := map[string]time.Time{}
+	send := func(reading streamReading) error {
+		sampled := readingTime(reading.Data)
+		if !sampled.After(sent[reading.Name]) {
+			return nil
+		}
+		sent[reading.Name] = sampled
+
+		data, err := json.Marshal(reading)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: reading\ndata: %s\n\n", sampled.UnixNano(), data)
+		return err
+	}
+
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		if nanos, err := strconv.ParseInt(lastID, 10, 64); err == nil {
+			for _, reading := range app.missedReadings(name, time.Unix(0, nanos)) {
+				if err := send(reading); err != nil {
+					return
+				}
+			}
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case reading, ok := <-readings:
+			if !ok {
+				return
+			}
+			if err := send(reading); err != nil {
+				app.Logger.Debug("Error writing event", zap.Error(err))
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// missedReadings returns the buffered readings taken after t, oldest first.
+func (app *App) missedReadings(name string, t time.Time) []streamReading {
+	var missed []streamReading
+	for _, device := range app.devices() {
+		if name != "" && device.Name != name {
+			continue
+		}
+		for _, stats := range device.History.since(t) {
+			missed = append(missed, streamReading{Name: device.Name, Data: stats})
+		}
+	}
+	sort.SliceStable(missed, func(i, j int) bool {
+		return readingTime(missed[i].Data).Before(readingTime(missed[j].Data))
+	})
+	return missed
+}
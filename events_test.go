@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads the fields of the next event of a stream.
+func readEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+
+	fields := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return fields
+		}
+		if name, value, ok := strings.Cut(line, ": "); ok {
+			fields[name] = value
+		}
+	}
+}
+
+// getEvents opens the event stream at url, closing it when the test ends.
+func getEvents(t *testing.T, url, lastEventID string) *bufio.Reader {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want 200", url, resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestEventsHandler(t *testing.T) {
+	app := newTestApp(t, "--poll-frequency=10s")
+	fake := newFakeDevice(t)
+	device := addTestDevice(app, "office", fake.address())
+	server := httptest.NewServer(http.HandlerFunc(app.eventsHandler))
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + "?device=kitchen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status of an unknown device = %d, want 404", resp.StatusCode)
+	}
+
+	events := getEvents(t, server.URL+"?device=office", "")
+	if got := readEvent(t, events)["retry"]; got != "10000" {
+		t.Errorf("retry = %q, want the poll frequency in milliseconds", got)
+	}
+	waitForSubscribers(t, &app.Stream, 1)
+
+	if err := app.poll(context.Background(), device); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+	event := readEvent(t, events)
+	if event["event"] != "reading" {
+		t.Errorf("event = %q, want reading", event["event"])
+	}
+	var reading streamReading
+	if err := json.Unmarshal([]byte(event["data"]), &reading); err != nil {
+		t.Fatalf("decoding event data: %v", err)
+	}
+	if reading.Name != "office" || reading.Data.Temp != 21.5 {
+		t.Errorf("reading = %+v, want 21.5ºC from office", reading)
+	}
+	if want := strconv.FormatInt(reading.Data.Timestamp.UnixNano(), 10); event["id"] != want {
+		t.Errorf("id = %q, want the reading time %s", event["id"], want)
+	}
+}
+
+func TestEventsHandlerLastEventID(t *testing.T) {
+	app := newTestApp(t)
+	fake := newFakeDevice(t)
+	device := addTestDevice(app, "office", fake.address())
+	server := httptest.NewServer(http.HandlerFunc(app.eventsHandler))
+	t.Cleanup(server.Close)
+
+	for i := 0; i < 3; i++ {
+		if err := app.poll(context.Background(), device); err != nil {
+			t.Fatalf("poll() error = %v", err)
+		}
+	}
+	readings := device.History.since(time.Time{})
+	if len(readings) != 3 {
+		t.Fatalf("buffered readings = %d, want 3", len(readings))
+	}
+
+	// Reconnecting after the first reading replays the other two.
+	events := getEvents(t, server.URL, strconv.FormatInt(readings[0].Timestamp.UnixNano(), 10))
+	readEvent(t, events)
+	for _, want := range readings[1:] {
+		if got, want := readEvent(t, events)["id"], strconv.FormatInt(want.Timestamp.UnixNano(), 10); got != want {
+			t.Errorf("replayed id = %q, want %s", got, want)
+		}
+	}
+}
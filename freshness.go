@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// poll fetches a reading from the device, serialized with any other poll of
+// the same device in flight. It gives up waiting for the poll lock once ctx
+// is done.
+func (app *App) poll(ctx context.Context, device *Device) error {
+	select {
+	case device.pollLock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-device.pollLock }()
+
+	err := app.getAwairData(ctx, device)
+	app.applyStalePolicy(device)
+	return err
+}
+
+// refreshIfOlderThan polls the device unless a reading newer than maxAge is
+// already available, e.g. because a concurrent poll just finished.
+func (app *App) refreshIfOlderThan(ctx context.Context, device *Device, maxAge time.Duration) error {
+	select {
+	case device.pollLock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-device.pollLock }()
+
+	if age, ok := dataAge(device); ok && age <= maxAge {
+		return nil
+	}
+
+	err := app.getAwairData(ctx, device)
+	app.applyStalePolicy(device)
+	return err
+}
+
+// freshGatherer refreshes every device whose reading is older than maxAge
+// before gathering, waiting at most --max-staleness-wait. Devices are
+// refreshed concurrently. Only /metrics gathers through it, as the
+// pushgateway sink gathers from within a poll.
+type freshGatherer struct {
+	prometheus.Gatherer
+	app *App
+	// ctx is done when the exporter shuts down.
+	ctx    context.Context
+	maxAge time.Duration
+}
+
+// freshGatherer returns gatherer refreshing the readings older than
+// --max-staleness first, or every reading with --scrape-on-collect.
+func (app *App) freshGatherer(ctx context.Context, gatherer prometheus.Gatherer) prometheus.Gatherer {
+	maxAge := app.MaxStaleness
+	if app.ScrapeOnCollect {
+		maxAge = 0
+	} else if maxAge <= 0 {
+		return gatherer
+	}
+	return freshGatherer{Gatherer: gatherer, app: app, ctx: ctx, maxAge: maxAge}
+}
+
+func (g freshGatherer) Gather() ([]*dto.MetricFamily, error) {
+	ctx, cancel := context.WithTimeout(g.ctx, g.app.MaxStalenessWait)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, device := range g.app.devices() {
+		if age, ok := dataAge(device); ok && age <= g.maxAge {
+			continue
+		}
+
+		wg.Add(1)
+		go func(device *Device) {
+			defer wg.Done()
+			g.app.runRecovered(ctx, "refresh:"+device.Name, func(ctx context.Context) {
+				err := g.app.withPollWorker(ctx, device, func(ctx context.Context) error {
+					return g.app.refreshIfOlderThan(ctx, device, g.maxAge)
+				})
+				if err != nil {
+					g.app.Logger.Warn("Failed to refresh stale reading before scrape", zap.String("device", device.Name), zap.Error(err))
+				}
+			})
+		}(device)
+	}
+	wg.Wait()
+
+	return g.Gatherer.Gather()
+}
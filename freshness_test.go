@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFreshGatherer(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantPolls int32
+	}{
+		{"disabled", nil, 0},
+		{"max staleness", []string{"--max-staleness=1h"}, 1},
+		{"scrape on collect", []string{"--scrape-on-collect"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, tt.args...)
+			fake := newFakeDevice(t)
+			device := addTestDevice(app, "office", fake.address())
+
+			gatherer := app.freshGatherer(context.Background(), prometheus.DefaultGatherer)
+			for i := 0; i < 2; i++ {
+				if _, err := gatherer.Gather(); err != nil {
+					t.Fatalf("Gather() error = %v", err)
+				}
+			}
+
+			if got := fake.polls.Load(); got != tt.wantPolls {
+				t.Errorf("polled %d times, want %d", got, tt.wantPolls)
+			}
+			if tt.wantPolls > 0 {
+				if got := testutil.ToFloat64(app.TempGauge.With(device.Labels)); got != 21.5 {
+					t.Errorf("temp_c = %v, want the refreshed 21.5", got)
+				}
+			}
+		})
+	}
+}
+
+func TestFreshGathererWait(t *testing.T) {
+	app := newTestApp(t, "--scrape-on-collect", "--max-staleness-wait=50ms")
+	fake := newFakeDevice(t)
+	device := addTestDevice(app, "office", fake.address())
+
+	// A poll in flight holds the device past the wait.
+	device.pollLock <- struct{}{}
+	defer func() { <-device.pollLock }()
+
+	start := time.Now()
+	if _, err := app.freshGatherer(context.Background(), prometheus.DefaultGatherer).Gather(); err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Gather() took %s, want about --max-staleness-wait", elapsed)
+	}
+	if got := fake.polls.Load(); got != 0 {
+		t.Errorf("polled %d times, want 0", got)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// healthzHandler reports that the process is alive.
+func (app *App) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler reports ready once any device has been polled successfully
+// within --ready-window.
+func (app *App) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	for _, device := range app.devices() {
+		if lastSuccess := device.Status.LastSuccess(); !lastSuccess.IsZero() && time.Since(lastSuccess) <= app.ReadyWindow {
+			fmt.Fprintln(w, "ok")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, "no successful device poll in the last %s\n", app.ReadyWindow)
+}
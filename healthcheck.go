@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	registerCommand("healthcheck", command{
+		Usage: "Exit 0 when the exporter's /readyz answers 200 and 1 otherwise, e.g. for a Docker HEALTHCHECK in an image without curl.",
+		Run:   runHealthcheck,
+	})
+}
+
+func runHealthcheck(fs *pflag.FlagSet, args []string) int {
+	url := fs.String("url", "http://127.0.0.1:2112/readyz", "URL of the exporter's readiness endpoint, with user:password@ for basic authentication")
+	timeout := fs.Duration("timeout", 5*time.Second, "Time to wait for the answer")
+	insecureSkipVerify := fs.Bool("insecure-skip-verify", false, "Skip verifying the exporter's TLS certificate")
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	client := &http.Client{
+		Timeout:   *timeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecureSkipVerify}},
+	}
+	if err := checkHealth(client, *url); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// checkHealth returns an error unless url answers 200.
+func checkHealth(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("unhealthy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// readyz explains why in a line.
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unhealthy: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckHealth(t *testing.T) {
+	ready := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready {
+			http.Error(w, "no successful device poll in the last 5m0s", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	if err := checkHealth(server.Client(), server.URL); err != nil {
+		t.Errorf("checkHealth() of a ready exporter error = %v", err)
+	}
+
+	ready = false
+	err := checkHealth(server.Client(), server.URL)
+	if err == nil || !strings.Contains(err.Error(), "503 Service Unavailable: no successful device poll") {
+		t.Errorf("checkHealth() of an unready exporter error = %v", err)
+	}
+}
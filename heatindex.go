@@ -0,0 +1,44 @@
+package main
+
+import "math"
+
+// heatIndex returns the NOAA heat index in ºC for a temperature in ºC and a
+// relative humidity in %, following the NWS algorithm: Steadman's simple
+// formula, replaced by the Rothfusz regression and its adjustments when
+// the result is 80ºF or more.
+func heatIndex(temp, humid float64) float64 {
+	t := celsiusToFahrenheit(temp)
+
+	hi := 0.5 * (t + 61 + (t-68)*1.2 + humid*0.094)
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*humid -
+			0.22475541*t*humid - 0.00683783*t*t - 0.05481717*humid*humid +
+			0.00122874*t*t*humid + 0.00085282*t*humid*humid - 0.00000199*t*t*humid*humid
+
+		switch {
+		case humid < 13 && t >= 80 && t <= 112:
+			hi -= (13 - humid) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		case humid > 85 && t >= 80 && t <= 87:
+			hi += (humid - 85) / 10 * (87 - t) / 5
+		}
+	}
+
+	return (hi - 32) * 5 / 9
+}
+
+// humidex returns the Canadian humidex for a temperature in ºC and a
+// relative humidity in %, from the vapour pressure given by the Magnus
+// formula. It reads like a temperature: 30ºC at 70% feels like 41.
+func humidex(temp, humid float64) float64 {
+	vapourPressure := humid / 100 * 6.112 * math.Exp(17.62*temp/(243.12+temp))
+	return temp + 5.0/9*(vapourPressure-10)
+}
+
+// wetBulb returns the wet-bulb temperature in ºC for a temperature in ºC
+// and a relative humidity in %, following Stull's 2011 empirical formula,
+// within 1ºC between 5% and 99% relative humidity and -20ºC and 50ºC.
+func wetBulb(temp, humid float64) float64 {
+	return temp*math.Atan(0.151977*math.Sqrt(humid+8.313659)) +
+		math.Atan(temp+humid) - math.Atan(humid-1.676331) +
+		0.00391838*math.Pow(humid, 1.5)*math.Atan(0.023101*humid) - 4.686035
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHeatIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		tempF  float64
+		humid  float64
+		wantF  float64
+		within float64
+	}{
+		// Below 80ºF the simple formula is used as is.
+		{"simple formula", 68, 40, 66.38, 0.01},
+		// The rest are from the NWS heat index chart, which rounds to whole
+		// degrees.
+		{"regression", 90, 40, 91, 1},
+		{"regression humid", 90, 70, 106, 1},
+		{"regression hot", 100, 40, 109, 1},
+		{"high humidity adjustment", 85, 90, 102, 1},
+		{"boundary", 80, 40, 80, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := celsiusToFahrenheit(heatIndex((tt.tempF-32)*5/9, tt.humid))
+			if math.Abs(got-tt.wantF) > tt.within {
+				t.Errorf("heatIndex(%vºF, %v%%) = %.2fºF, want %vºF ± %v", tt.tempF, tt.humid, got, tt.wantF, tt.within)
+			}
+		})
+	}
+}
+
+func TestHumidex(t *testing.T) {
+	tests := []struct {
+		temp, humid, want float64
+	}{
+		// From Environment Canada's humidex table, which rounds to whole
+		// degrees.
+		{30, 70, 41},
+		{25, 50, 28},
+		{35, 40, 42},
+	}
+	for _, tt := range tests {
+		if got := humidex(tt.temp, tt.humid); math.Abs(got-tt.want) > 1 {
+			t.Errorf("humidex(%vºC, %v%%) = %.2f, want %v ± 1", tt.temp, tt.humid, got, tt.want)
+		}
+	}
+}
+
+func TestWetBulb(t *testing.T) {
+	tests := []struct {
+		temp, humid, want float64
+	}{
+		// Stull's own check value.
+		{20, 50, 13.7},
+		{30, 80, 27.1},
+		{25, 100, 25},
+	}
+	for _, tt := range tests {
+		if got := wetBulb(tt.temp, tt.humid); math.Abs(got-tt.want) > 0.5 {
+			t.Errorf("wetBulb(%vºC, %v%%) = %.2fºC, want %vºC ± 0.5", tt.temp, tt.humid, got, tt.want)
+		}
+	}
+}
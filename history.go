@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// HistoryBuffer is a ring buffer of the device's recent readings.
+type HistoryBuffer struct {
+	mu       sync.Mutex
+	readings []AwairStats
+	next     int
+	full     bool
+}
+
+func (b *HistoryBuffer) init(capacity int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.readings = make([]AwairStats, capacity)
+}
+
+func (b *HistoryBuffer) add(stats AwairStats) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.readings) == 0 {
+		return
+	}
+	b.readings[b.next] = stats
+	b.next = (b.next + 1) % len(b.readings)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// since returns the buffered readings taken after t, oldest first. The
+// buffer is in the order the readings were added, which differs for
+// backfilled ones.
+func (b *HistoryBuffer) since(t time.Time) []AwairStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ordered := b.readings[:b.next]
+	if b.full {
+		ordered = append(append([]AwairStats(nil), b.readings[b.next:]...), b.readings[:b.next]...)
+	}
+
+	result := []AwairStats{}
+	for _, stats := range ordered {
+		if readingTime(stats).After(t) {
+			result = append(result, stats)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return readingTime(result[i]).Before(readingTime(result[j]))
+	})
+	return result
+}
+
+// historyCapacity sizes a device's buffer to hold --history-buffer of
+// readings at its poll frequency.
+func (app *App) historyCapacity(device *Device) int {
+	if app.HistoryBuffer <= 0 {
+		return 0
+	}
+	return int(app.HistoryBuffer/app.pollFrequency(device)) + 1
+}
+
+type historyDevice struct {
+	Name     string       `json:"name"`
+	Readings []AwairStats `json:"readings"`
+}
+
+type historyReport struct {
+	Devices []historyDevice `json:"devices"`
+}
+
+// parseSince accepts an RFC 3339 time or a duration before now. It defaults
+// to the whole buffer.
+func parseSince(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), true
+	}
+	return time.Time{}, false
+}
+
+// historyHandler serves the buffered readings of every device, or of the one
+// named by the device query parameter, taken after the since parameter.
+func (app *App) historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	since, ok := parseSince(r.URL.Query().Get("since"))
+	if !ok {
+		http.Error(w, "since must be an RFC 3339 time or a duration", http.StatusBadRequest)
+		return
+	}
+
+	name := r.URL.Query().Get("device")
+	report := historyReport{Devices: []historyDevice{}}
+	for _, device := range app.devices() {
+		if name != "" && device.Name != name {
+			continue
+		}
+		report.Devices = append(report.Devices, historyDevice{
+			Name:     device.Name,
+			Readings: device.History.since(since),
+		})
+	}
+	if name != "" && len(report.Devices) == 0 {
+		http.Error(w, "unknown device", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		app.Logger.Error("Error writing history", zap.Error(err))
+	}
+}
+
+// readingStore is implemented by the sinks that keep past readings.
+type readingStore interface {
+	Readings(device string, from, to time.Time, fn func(AwairStats) error) error
+}
+
+// historyCSVHandler streams the device's readings from the history store
+// between the from and to query parameters as CSV, with one column per
+// field of the device's profile.
+func (app *App) historyCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := app.Sinks["history"].(readingStore)
+	if !ok {
+		http.Error(w, "the history store is not enabled, see --history-path", http.StatusNotFound)
+		return
+	}
+
+	name := r.URL.Query().Get("device")
+	if name == "" {
+		http.Error(w, "device is required", http.StatusBadRequest)
+		return
+	}
+	// The store is keyed by Unix nanoseconds, which the zero time is out of
+	// range of, so the whole history starts at the Unix epoch.
+	from := time.Unix(0, 0)
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, ok = parseSince(value); !ok {
+			http.Error(w, "from must be an RFC 3339 time or a duration", http.StatusBadRequest)
+			return
+		}
+	}
+	to := time.Now()
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, ok = parseSince(value); !ok {
+			http.Error(w, "to must be an RFC 3339 time or a duration", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Devices no longer configured keep their history, so export it with
+	// every field.
+	fields := knownFields.Fields
+	if device := app.device(name); device != nil {
+		profile, err := currentProfile(r.Context(), device)
+		if err != nil {
+			http.Error(w, "the device is being polled, try again", http.StatusServiceUnavailable)
+			return
+		}
+		if len(profile.Fields) > 0 {
+			fields = profile.Fields
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+
+	out := csv.NewWriter(w)
+	row := make([]string, len(fields)+1)
+	row[0] = "timestamp"
+	copy(row[1:], fields)
+	if err := out.Write(row); err != nil {
+		return
+	}
+
+	err := store.Readings(name, from, to, func(stats AwairStats) error {
+		row[0] = readingTime(stats).In(app.Location).Format(time.RFC3339)
+		for i, field := range fields {
+			row[i+1] = strconv.FormatFloat(fieldValue(stats, field), 'f', -1, 64)
+		}
+		return out.Write(row)
+	})
+	out.Flush()
+	if err == nil {
+		err = out.Error()
+	}
+	if err != nil {
+		// The header has been sent, so the error can only be logged.
+		app.Logger.Error("Error writing history CSV", zap.String("device", name), zap.Error(err))
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestHistoryBuffer(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	reading := func(i int) AwairStats {
+		return AwairStats{Timestamp: start.Add(time.Duration(i) * time.Minute), Score: i}
+	}
+
+	tests := []struct {
+		name      string
+		capacity  int
+		added     int
+		since     time.Time
+		wantScore []int
+	}{
+		{"disabled", 0, 3, time.Time{}, []int{}},
+		{"partly filled", 4, 3, time.Time{}, []int{0, 1, 2}},
+		{"exactly full", 3, 3, time.Time{}, []int{0, 1, 2}},
+		{"wrapped oldest first", 3, 5, time.Time{}, []int{2, 3, 4}},
+		{"since excludes older", 3, 5, start.Add(3 * time.Minute), []int{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &HistoryBuffer{}
+			b.init(tt.capacity)
+			for i := 0; i < tt.added; i++ {
+				b.add(reading(i))
+			}
+
+			got := b.since(tt.since)
+			scores := make([]int, len(got))
+			for i, stats := range got {
+				scores[i] = stats.Score
+			}
+			if len(scores) != len(tt.wantScore) {
+				t.Fatalf("since() scores = %v, want %v", scores, tt.wantScore)
+			}
+			for i := range scores {
+				if scores[i] != tt.wantScore[i] {
+					t.Fatalf("since() scores = %v, want %v", scores, tt.wantScore)
+				}
+			}
+		})
+	}
+}
+
+// memoryStore is a readingStore of fixed readings.
+type memoryStore struct {
+	readings []AwairStats
+}
+
+func (s memoryStore) Publish(ctx context.Context, device *Device, stats AwairStats) error {
+	return nil
+}
+
+func (s memoryStore) Close() error {
+	return nil
+}
+
+func (s memoryStore) Readings(device string, from, to time.Time, fn func(AwairStats) error) error {
+	for _, stats := range s.readings {
+		if err := fn(stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestHistoryCSVHandler(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	device := newDevice("office", "http://office")
+	device.Profile = deviceProfile{Fields: []string{"temp", "co2"}}
+	app := &App{
+		Logger:   zap.NewNop(),
+		Location: time.UTC,
+		Devices:  []*Device{device},
+		Sinks:    map[string]Sink{"history": memoryStore{readings: []AwairStats{{Timestamp: at, Temp: 21.5, Co2: 600}}}},
+	}
+
+	rec := httptest.NewRecorder()
+	app.historyCSVHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/history.csv?device=office", nil))
+	if want := "timestamp,temp,co2\n2024-01-02T03:04:05Z,21.5,600\n"; rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("historyCSVHandler() = %d %q, want 200 %q", rec.Code, rec.Body.String(), want)
+	}
+
+	// A poll in flight holds the profile until the request gives up.
+	device.pollLock <- struct{}{}
+	defer func() { <-device.pollLock }()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = httptest.NewRecorder()
+	app.historyCSVHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/history.csv?device=office", nil).WithContext(ctx))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("historyCSVHandler() during a poll = %d, want 503", rec.Code)
+	}
+}
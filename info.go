@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/epk/awair-local-prom-exporter/pkg/awair"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// uuidLabel is the device label added by --uuid-label.
+const uuidLabel = "uuid"
+
+func (app *App) initializeInfoMetrics() {
+	app.DeviceInfoGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "device",
+		Name:      "info",
+		Help:      "Device metadata from the local config endpoint, always 1",
+	}, app.infoLabelNames())
+
+	app.WifiRSSIGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "device",
+		Name:      "wifi_rssi_dbm",
+		Help:      "Wi-Fi signal strength of the device from the local config endpoint",
+	}, app.deviceLabelNames())
+}
+
+// infoLabelNames returns the labels of the device info series, which
+// already has the uuid label with --uuid-label.
+func (app *App) infoLabelNames() []string {
+	names := app.deviceLabelNames()
+	if !app.UUIDLabel {
+		names = append(names, uuidLabel)
+	}
+	return append(names, "firmware", "type", "display", "led_mode")
+}
+
+// extraLabelNames returns the extra label names of the devices, adding the
+// uuid label with --uuid-label and the cloud labels with
+// --awair-cloud-inventory.
+func (app *App) extraLabelNames(devices []*Device) []string {
+	names := extraLabelNames(devices)
+	if app.UUIDLabel {
+		names = append(names, uuidLabel)
+	}
+	if app.CloudInventoryOnly {
+		seen := map[string]bool{}
+		for _, name := range names {
+			seen[name] = true
+		}
+		for _, name := range []string{cloudNameLabel, cloudRoomLabel} {
+			if !seen[name] {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// relabelDevice moves the device's series to its current labels once the
+// labels derived from the device UUID change, i.e. when the UUID is first
+// fetched. The climate series are restored from the last reading, while
+// the derived series come back with the next sample and counters start
+// over.
+func (app *App) relabelDevice(ctx context.Context, device *Device) error {
+	labels := app.deviceLabels(device)
+	if reflect.DeepEqual(labels, device.Labels) {
+		return nil
+	}
+
+	select {
+	case device.pollLock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-device.pollLock }()
+
+	app.deleteDeviceSeries(device)
+	device.infoLabels = nil
+	app.devicesMu.Lock()
+	device.Labels = labels
+	app.devicesMu.Unlock()
+	app.initializeDeviceSeries(device)
+
+	if latest, _ := device.Status.Latest(); latest != nil && !device.climateExpired {
+		app.setClimateGauges(device, *latest)
+	}
+
+	app.Logger.Info("Relabelled device series", zap.String("device", device.Name), zap.Any("labels", labels))
+	return nil
+}
+
+// deviceConfigAddress returns the config endpoint next to the device's
+// air-data URL.
+func deviceConfigAddress(address string) (string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	u.Path = strings.TrimSuffix(u.Path, awair.LatestPath) + awair.ConfigPath
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// recordDeviceInfo fetches the device metadata now and then every
+// --device-info-interval.
+func (app *App) recordDeviceInfo(ctx context.Context, device *Device) {
+	ticker := time.NewTicker(app.DeviceInfoInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := app.getDeviceInfo(ctx, device); err != nil {
+			app.Logger.Warn("Error getting device info", zap.String("device", device.Name), zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fetchDeviceConfig fetches the device's metadata from its config endpoint.
+func (app *App) fetchDeviceConfig(ctx context.Context, device *Device) (awair.DeviceConfig, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
+	defer cancel()
+
+	config := awair.DeviceConfig{}
+	address, err := deviceConfigAddress(device.Address)
+	if err != nil {
+		return config, err
+	}
+
+	req, err := app.newDeviceRequest(ctx, address)
+	if err != nil {
+		return config, err
+	}
+
+	resp, err := app.Client.Do(req)
+	if err != nil {
+		return config, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return config, fmt.Errorf("unexpected status %s from %s", resp.Status, address)
+	}
+
+	body, err := app.readDeviceBody(resp.Body)
+	if err != nil {
+		return config, err
+	}
+
+	err = json.Unmarshal(body, &config)
+	return config, err
+}
+
+func (app *App) getDeviceInfo(ctx context.Context, device *Device) error {
+	config, err := app.fetchDeviceConfig(ctx, device)
+	if err != nil {
+		return err
+	}
+
+	device.uuid.Store(config.DeviceUUID)
+	if err := app.relabelDevice(ctx, device); err != nil {
+		return err
+	}
+
+	labels := prometheus.Labels{
+		uuidLabel:  config.DeviceUUID,
+		"firmware": config.FwVersion,
+		"type":     config.Model(),
+		"display":  config.Display,
+		"led_mode": config.LED.Mode,
+	}
+	for name, value := range device.Labels {
+		labels[name] = value
+	}
+
+	if device.infoLabels != nil {
+		app.DeviceInfoGauge.Delete(device.infoLabels)
+	}
+	app.DeviceInfoGauge.With(labels).Set(1)
+	device.infoLabels = labels
+
+	if config.RSSI != nil {
+		app.WifiRSSIGauge.With(device.Labels).Set(*config.RSSI)
+	} else {
+		app.WifiRSSIGauge.Delete(device.Labels)
+	}
+
+	return nil
+}
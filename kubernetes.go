@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/epk/awair-local-prom-exporter/pkg/awair"
+	"go.uber.org/zap"
+)
+
+const (
+	// kubernetesServiceAccount holds the token, CA and namespace mounted into
+	// every pod.
+	kubernetesServiceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// awairDevicesPath lists the AwairDevice resources of a namespace, see
+	// kubernetes/awairdevice.yaml for the definition.
+	awairDevicesPath         = "/apis/awair.epk.github.io/v1alpha1/namespaces/%s/awairdevices"
+	kubernetesRequestTimeout = time.Second * 10
+)
+
+// awairDeviceList is the list of AwairDevice resources returned by the
+// Kubernetes API.
+type awairDeviceList struct {
+	Items []awairDevice `json:"items"`
+}
+
+type awairDevice struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Address string            `json:"address"`
+		Labels  map[string]string `json:"labels"`
+		// PollFrequency is a duration such as "1m", overriding
+		// --poll-frequency for the device.
+		PollFrequency string `json:"pollFrequency"`
+	} `json:"spec"`
+}
+
+// kubernetesClient reaches the Kubernetes API from within a pod with its
+// service account.
+type kubernetesClient struct {
+	address   string
+	tokenFile string
+	namespace string
+	client    *http.Client
+}
+
+// newKubernetesClient builds the client from the service account mounted
+// into the pod. The namespace defaults to the pod's own.
+func newKubernetesClient(namespace string) (*kubernetesClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("kubernetes-devices requires running in a Kubernetes pod")
+	}
+
+	pem, err := os.ReadFile(kubernetesServiceAccount + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in the service account CA")
+	}
+
+	if namespace == "" {
+		data, err := os.ReadFile(kubernetesServiceAccount + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the pod namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	return &kubernetesClient{
+		address:   "https://" + net.JoinHostPort(host, port),
+		tokenFile: kubernetesServiceAccount + "/token",
+		namespace: namespace,
+		client: &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}},
+	}, nil
+}
+
+// awairDevices lists the AwairDevice resources of the namespace.
+func (k *kubernetesClient) awairDevices(ctx context.Context) ([]awairDevice, error) {
+	ctx, cancel := context.WithTimeout(ctx, kubernetesRequestTimeout)
+	defer cancel()
+
+	// The token is rotated by the kubelet, so it is read for every request.
+	token, err := os.ReadFile(k.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account token: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.address+fmt.Sprintf(awairDevicesPath, k.namespace), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list AwairDevices: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list AwairDevices: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	list := awairDeviceList{}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse AwairDevices: %w", err)
+	}
+	return list.Items, nil
+}
+
+// airDataAddress returns the air-data URL of a device's address, adding
+// /air-data/latest to a base URL such as http://192.168.1.20.
+func airDataAddress(address string) string {
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return address
+	}
+	u.Path = awair.LatestPath
+	return u.String()
+}
+
+// awairDeviceConfigs converts the resources into device configs, skipping
+// the invalid ones so a single bad resource does not stop the others from
+// being polled.
+func awairDeviceConfigs(items []awairDevice) ([]DeviceConfig, []error) {
+	configs := make([]DeviceConfig, 0, len(items))
+	var errs []error
+	for _, item := range items {
+		config := DeviceConfig{
+			Name:    item.Metadata.Name,
+			Address: airDataAddress(item.Spec.Address),
+			Labels:  item.Spec.Labels,
+		}
+		if item.Spec.PollFrequency != "" {
+			frequency, err := time.ParseDuration(item.Spec.PollFrequency)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid AwairDevice %q: invalid pollFrequency: %w", item.Metadata.Name, err))
+				continue
+			}
+			config.PollFrequency = &frequency
+		}
+		if _, err := configDevices([]DeviceConfig{config}); err != nil {
+			errs = append(errs, fmt.Errorf("invalid AwairDevice %q: %w", item.Metadata.Name, err))
+			continue
+		}
+		configs = append(configs, config)
+	}
+	return configs, errs
+}
+
+// kubernetesDevices lists the devices of the AwairDevice resources.
+func (app *App) kubernetesDevices(ctx context.Context) ([]*Device, error) {
+	items, err := app.kubernetes.awairDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	configs, errs := awairDeviceConfigs(items)
+	for _, err := range errs {
+		app.Logger.Warn("Skipping AwairDevice", zap.Error(err))
+	}
+	return configDevices(configs)
+}
+
+// withKnownLabels returns the devices whose labels are all among the label
+// names the series were registered with at start. The others are skipped,
+// as their labels need a restart, without holding up the rest.
+func (app *App) withKnownLabels(devices []*Device) []*Device {
+	known := map[string]bool{}
+	for _, name := range app.ExtraLabelNames {
+		known[name] = true
+	}
+
+	kept := make([]*Device, 0, len(devices))
+	for _, device := range devices {
+		var unknown []string
+		for name := range device.ExtraLabels {
+			if !known[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			app.Logger.Error("Skipping AwairDevice with new label names, restart the exporter to apply them", zap.String("device", device.Name), zap.Strings("labels", unknown))
+			continue
+		}
+		kept = append(kept, device)
+	}
+	return kept
+}
+
+// watchKubernetesDevices lists the AwairDevice resources every
+// --kubernetes-resync and reconciles the polled devices with them, like a
+// config reload.
+func (app *App) watchKubernetesDevices(ctx context.Context) {
+	ticker := time.NewTicker(app.KubernetesResync)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		devices, err := app.kubernetesDevices(ctx)
+		if err != nil {
+			app.Logger.Error("Error listing AwairDevices", zap.Error(err))
+			continue
+		}
+		devices = app.withKnownLabels(devices)
+
+		app.reloadMu.Lock()
+		app.reconcileDevices(ctx, devices)
+		app.reloadMu.Unlock()
+	}
+}
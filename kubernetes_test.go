@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestAwairDeviceConfigs(t *testing.T) {
+	device := func(name, address, frequency string) awairDevice {
+		item := awairDevice{}
+		item.Metadata.Name = name
+		item.Spec.Address = address
+		item.Spec.PollFrequency = frequency
+		return item
+	}
+
+	configs, errs := awairDeviceConfigs([]awairDevice{
+		device("office", "http://192.168.1.20", "1m"),
+		device("bedroom", "http://192.168.1.21/air-data/latest", ""),
+		device("hallway", "http://192.168.1.22", "soon"),
+		device("garage", "http://192.168.1.23", "-1m"),
+		device("attic", "://", ""),
+	})
+	if len(errs) != 3 {
+		t.Errorf("awairDeviceConfigs() returned %d errors, want 3: %v", len(errs), errs)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("awairDeviceConfigs() returned %d configs, want 2", len(configs))
+	}
+	if configs[0].Name != "office" || configs[0].Address != "http://192.168.1.20/air-data/latest" || configs[0].PollFrequency == nil || *configs[0].PollFrequency != time.Minute {
+		t.Errorf("configs[0] = %+v, want office at /air-data/latest polled every minute", configs[0])
+	}
+	if configs[1].Name != "bedroom" || configs[1].Address != "http://192.168.1.21/air-data/latest" || configs[1].PollFrequency != nil {
+		t.Errorf("configs[1] = %+v, want bedroom at the default frequency", configs[1])
+	}
+}
+
+func TestKubernetesAwairDevices(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/awair.epk.github.io/v1alpha1/namespaces/home/awairdevices" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"items":[{"metadata":{"name":"office"},"spec":{"address":"http://192.168.1.20","labels":{"room":"office"}}}]}`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client := &kubernetesClient{address: server.URL, tokenFile: tokenFile, namespace: "home", client: server.Client()}
+
+	items, err := client.awairDevices(context.Background())
+	if err != nil {
+		t.Fatalf("awairDevices() error = %v", err)
+	}
+	if len(items) != 1 || items[0].Metadata.Name != "office" || items[0].Spec.Labels["room"] != "office" {
+		t.Errorf("awairDevices() = %+v, want the office device", items)
+	}
+
+	client.namespace = "work"
+	if _, err := client.awairDevices(context.Background()); err == nil {
+		t.Error("awairDevices() of a missing namespace succeeded, want an error")
+	}
+}
+
+func TestWithKnownLabels(t *testing.T) {
+	app := &App{Logger: zap.NewNop(), ExtraLabelNames: []string{"room"}}
+	device := func(name string, labels map[string]string) *Device {
+		d := newDevice(name, "http://"+name)
+		d.ExtraLabels = labels
+		return d
+	}
+
+	devices := app.withKnownLabels([]*Device{
+		device("office", map[string]string{"room": "office"}),
+		device("bedroom", nil),
+		device("garage", map[string]string{"room": "garage", "floor": "0"}),
+	})
+	var names []string
+	for _, d := range devices {
+		names = append(names, d.Name)
+	}
+	if got := strings.Join(names, ","); got != "office,bedroom" {
+		t.Errorf("withKnownLabels() = %s, want office,bedroom", got)
+	}
+}
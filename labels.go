@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// reservedLabelNames are the labels the exporter sets on its own series,
+// which the device labels of the config file must not clash with.
+var reservedLabelNames = map[string]bool{
+	"device":    true,
+	uuidLabel:   true,
+	"firmware":  true,
+	"type":      true,
+	"display":   true,
+	"led_mode":  true,
+	"sensor":    true,
+	"threshold": true,
+	"window":    true,
+	"stat":      true,
+	"factor":    true,
+	"code":      true,
+}
+
+// validateDeviceLabelName checks a label name from the config file.
+func validateDeviceLabelName(name string) error {
+	if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+		return fmt.Errorf("invalid label name %q", name)
+	}
+	if reservedLabelNames[name] {
+		return fmt.Errorf("label name %q is reserved by the exporter", name)
+	}
+	return nil
+}
+
+// parseStaticLabels parses the name=value --label values, sorted by name.
+func parseStaticLabels(values []string) ([]*dto.LabelPair, error) {
+	seen := map[string]bool{}
+	labels := make([]*dto.LabelPair, 0, len(values))
+	for _, value := range values {
+		name, labelValue, found := strings.Cut(value, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid label %q, must be name=value", value)
+		}
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") || name == "device" {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate label %q", name)
+		}
+		seen[name] = true
+		labels = append(labels, &dto.LabelPair{Name: &name, Value: &labelValue})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+	return labels, nil
+}
+
+// labelFlags turns the labels of the config file into --label values.
+func labelFlags(labels map[string]string) []string {
+	values := make([]string, 0, len(labels))
+	for name, value := range labels {
+		values = append(values, name+"="+value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// gatherer returns the gatherer of the exported series, with the --label
+// labels added to every series.
+func (app *App) gatherer() prometheus.Gatherer {
+	if len(app.StaticLabels) == 0 {
+		return prometheus.DefaultGatherer
+	}
+	return staticLabelGatherer{Gatherer: prometheus.DefaultGatherer, labels: app.StaticLabels}
+}
+
+// staticLabelGatherer adds constant labels to every series. Labels a series
+// already has, such as a device's labels from the config file, are kept.
+type staticLabelGatherer struct {
+	prometheus.Gatherer
+	labels []*dto.LabelPair
+}
+
+func (g staticLabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			existing := map[string]bool{}
+			for _, label := range metric.Label {
+				existing[label.GetName()] = true
+			}
+			added := false
+			for _, label := range g.labels {
+				if !existing[label.GetName()] {
+					metric.Label = append(metric.Label, label)
+					added = true
+				}
+			}
+			if added {
+				sort.Slice(metric.Label, func(i, j int) bool { return metric.Label[i].GetName() < metric.Label[j].GetName() })
+			}
+		}
+	}
+
+	return families, err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// descRecorder is a prometheus.Registerer keeping the descriptions of the
+// collectors registered with it.
+type descRecorder struct {
+	descs []*prometheus.Desc
+}
+
+func (r *descRecorder) Register(c prometheus.Collector) error {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	for desc := range ch {
+		r.descs = append(r.descs, desc)
+	}
+	return nil
+}
+
+func (r *descRecorder) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		r.Register(c)
+	}
+}
+
+func (r *descRecorder) Unregister(prometheus.Collector) bool {
+	return true
+}
+
+var variableLabelsPattern = regexp.MustCompile(`variableLabels: \[([^\]]*)\]`)
+
+// TestReservedLabelNames checks that every label the exporter adds to the
+// device labels of its series is reserved, so a device label of the same
+// name is rejected rather than failing the registration.
+func TestReservedLabelNames(t *testing.T) {
+	recorder := &descRecorder{}
+	defaultRegisterer := prometheus.DefaultRegisterer
+	prometheus.DefaultRegisterer = recorder
+	defer func() { prometheus.DefaultRegisterer = defaultRegisterer }()
+
+	app := &App{Logger: zap.NewNop()}
+	app.registerFlags(pflag.NewFlagSet("test", pflag.ContinueOnError))
+	app.initializeMetrics()
+
+	for _, desc := range recorder.descs {
+		match := variableLabelsPattern.FindStringSubmatch(desc.String())
+		if match == nil {
+			continue
+		}
+		labels := strings.Fields(match[1])
+		if len(labels) == 0 || labels[0] != "device" {
+			continue
+		}
+		for _, label := range labels[1:] {
+			if !reservedLabelNames[label] {
+				t.Errorf("label %q of %s is not in reservedLabelNames", label, desc)
+			}
+		}
+	}
+	if len(recorder.descs) == 0 {
+		t.Fatal("no metrics were registered")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type landingLink struct {
+	Path        string
+	Description string
+}
+
+type landingDevice struct {
+	deviceDiagnostics
+	LastSuccessAgo string
+}
+
+type landingPage struct {
+	Version string
+	Links   []landingLink
+	Devices []landingDevice
+}
+
+func (app *App) landingPage() landingPage {
+	page := landingPage{
+		Version: currentBuildInfo().Version,
+		Links: []landingLink{
+			{app.TelemetryPath, "Prometheus metrics"},
+			{"/healthz", "Liveness"},
+			{"/readyz", "Readiness"},
+			{"/api/v1/latest", "Latest reading of every device as JSON"},
+			{"/api/v1/history", "Readings kept in memory as JSON"},
+			{"/api/v1/diagnostics", "Device reachability, sink backlogs and runtime stats as JSON"},
+			{"/api/v1/events", "Server-sent events of each new reading"},
+			{"/reports/", "Report of the last days' readings"},
+			{"/probe?target=", "Climate metrics of the device at ?target="},
+		},
+	}
+
+	now := time.Now()
+	for _, device := range app.devices() {
+		diagnostics := device.diagnostics()
+		entry := landingDevice{deviceDiagnostics: diagnostics}
+		if diagnostics.LastSuccess != nil {
+			entry.LastSuccessAgo = now.Sub(*diagnostics.LastSuccess).Round(time.Second).String() + " ago"
+		}
+		page.Devices = append(page.Devices, entry)
+	}
+	return page
+}
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Awair Exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+.down { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Awair Exporter</h1>
+<p>Version {{.Version}}.</p>
+<ul>
+{{range .Links}}<li><a href="{{.Path}}">{{.Path}}</a>: {{.Description}}</li>
+{{end}}</ul>
+<h2>Devices</h2>
+<table>
+<tr><th>Device</th><th>Address</th><th>Status</th><th>Last successful poll</th><th>Last error</th></tr>
+{{range .Devices}}<tr><td>{{.Name}}</td><td>{{.Address}}</td><td>{{if .Reachable}}up{{else if .LastAttempt}}<span class="down">down, {{.ConsecutiveFailures}} failed polls</span>{{else}}not polled yet{{end}}</td><td>{{.LastSuccessAgo}}</td><td>{{.LastError}}</td></tr>
+{{else}}<tr><td colspan="5">No devices.</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// landingHandler serves an index of the endpoints and the devices' poll
+// status at /.
+func (app *App) landingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := landingTemplate.Execute(w, app.landingPage()); err != nil {
+		app.Logger.Error("Error writing landing page", zap.Error(err))
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type latestReading struct {
+	Name     string      `json:"name"`
+	Address  string      `json:"address"`
+	PolledAt *time.Time  `json:"polled_at,omitempty"`
+	Data     *AwairStats `json:"data"`
+}
+
+type latestReport struct {
+	Devices []latestReading `json:"devices"`
+}
+
+// latestHandler serves the most recent reading of every device, or of the
+// one named by the device query parameter, without polling the devices.
+// Devices that have not been polled successfully yet have null data.
+func (app *App) latestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("device")
+	report := latestReport{Devices: []latestReading{}}
+	for _, device := range app.devices() {
+		if name != "" && device.Name != name {
+			continue
+		}
+		stats, polledAt := device.Status.Latest()
+		report.Devices = append(report.Devices, latestReading{
+			Name:     device.Name,
+			Address:  device.Address,
+			PolledAt: optionalTime(polledAt),
+			Data:     stats,
+		})
+	}
+	if name != "" && len(report.Devices) == 0 {
+		http.Error(w, "unknown device", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		app.Logger.Error("Error writing latest readings", zap.Error(err))
+	}
+}
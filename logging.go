@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	logFormatJSON    = "json"
+	logFormatConsole = "console"
+)
+
+// newLogger builds the logger for --log-level and --log-format. The console
+// format is meant for reading logs on the terminal or in journald.
+func newLogger(level, format string) (*zap.Logger, error) {
+	atomicLevel, err := zap.ParseAtomicLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	config := zap.NewProductionConfig()
+	config.Level = atomicLevel
+	switch format {
+	case logFormatJSON:
+	case logFormatConsole:
+		config.Encoding = logFormatConsole
+		config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		config.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be %s or %s", format, logFormatJSON, logFormatConsole)
+	}
+
+	return config.Build()
+}
+
+// pollSummary counts the polls since the last --log-summary-interval line.
+type pollSummary struct {
+	ok     atomic.Int64
+	failed atomic.Int64
+}
+
+func (s *pollSummary) record(err error) {
+	if err != nil {
+		s.failed.Add(1)
+	} else {
+		s.ok.Add(1)
+	}
+}
+
+// logPollSummaries logs the number of successful and failed polls every
+// --log-summary-interval, so successful polls can stay at debug level
+// without the logs going quiet. Failed polls are still logged as they
+// happen.
+func (app *App) logPollSummaries(ctx context.Context) {
+	ticker := time.NewTicker(app.LogSummaryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ok, failed := app.pollSummary.ok.Swap(0), app.pollSummary.failed.Swap(0)
+			app.Logger.Info(fmt.Sprintf("%d polls ok, %d failed in the last %s", ok, failed, formatWindow(app.LogSummaryInterval)),
+				zap.Int64("polls_ok", ok),
+				zap.Int64("polls_failed", failed),
+			)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// newTestApp returns an App with the default options and its metrics
+// registered with a registry of its own, which replaces the default one
+// until the test ends.
+func newTestApp(t *testing.T, args ...string) *App {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	defaultRegisterer, defaultGatherer := prometheus.DefaultRegisterer, prometheus.DefaultGatherer
+	prometheus.DefaultRegisterer, prometheus.DefaultGatherer = registry, registry
+	t.Cleanup(func() {
+		prometheus.DefaultRegisterer, prometheus.DefaultGatherer = defaultRegisterer, defaultGatherer
+	})
+
+	app := &App{Logger: zap.NewNop(), Location: time.UTC, Client: &http.Client{}}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	app.registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	if app.MaxBodyBytes, err = parseByteSize(app.MaxBodySize); err != nil {
+		t.Fatal(err)
+	}
+	if app.SmoothingAlphas, err = parseSmoothing(app.Smoothing); err != nil {
+		t.Fatal(err)
+	}
+	if app.SpikeLimits, err = parseSpikeLimits(app.SpikeLimit); err != nil {
+		t.Fatal(err)
+	}
+	app.initializeMetrics()
+	if err := app.initializeSinks(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// addTestDevice sets up the series of a device polled from address, like
+// startDevice without its background tasks.
+func addTestDevice(app *App, name, address string) *Device {
+	device := newDevice(name, address)
+	device.Labels = app.deviceLabels(device)
+	app.initializeProfile(device)
+	app.initializeDeviceSeries(device)
+	device.History.init(app.historyCapacity(device))
+	device.firstReading = make(chan time.Time, 1)
+
+	app.devicesMu.Lock()
+	app.Devices = append(app.Devices, device)
+	app.devicesMu.Unlock()
+	return device
+}
+
+// fakeDevice serves the readings of an Element at /air-data/latest, each
+// one a second after the previous, and counts the polls.
+type fakeDevice struct {
+	*httptest.Server
+	polls  atomic.Int32
+	status atomic.Int32
+}
+
+func newFakeDevice(t *testing.T) *fakeDevice {
+	t.Helper()
+
+	d := &fakeDevice{}
+	d.status.Store(http.StatusOK)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	d.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := d.polls.Add(1)
+		if status := int(d.status.Load()); status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		timestamp := start.Add(time.Duration(n) * time.Second).Format(time.RFC3339)
+		w.Write([]byte(`{"timestamp":"` + timestamp + `","score":90,"dew_point":9.8,"temp":21.5,"humid":45,"abs_humid":8.6,"co2":600,"co2_est":400,"co2_est_baseline":35000,"voc":120,"voc_baseline":38000,"voc_h2_raw":26,"voc_ethanol_raw":37,"pm25":4,"pm10_est":5}`))
+	}))
+	t.Cleanup(d.Close)
+	return d
+}
+
+// address returns the air-data URL of the device.
+func (d *fakeDevice) address() string {
+	return d.URL + "/air-data/latest"
+}
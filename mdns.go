@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DNS record types used when browsing for services.
+const (
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeSRV = 33
+	dnsClassIN = 1
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+var errMalformedDNS = errors.New("malformed DNS message")
+
+// mdnsService is a service instance found by browsing.
+type mdnsService struct {
+	Instance string
+	Host     string
+	IP       net.IP
+	Port     uint16
+}
+
+// dnsRecord is a resource record with its RDATA decoded for the types the
+// browser understands.
+type dnsRecord struct {
+	Name   string
+	Type   uint16
+	Target string // PTR and SRV
+	Port   uint16 // SRV
+	IP     net.IP // A
+}
+
+// encodeDNSName writes name as a sequence of length-prefixed labels.
+func encodeDNSName(name string) []byte {
+	buf := []byte{}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0)
+}
+
+// encodeDNSQuery builds a query with a single question.
+func encodeDNSQuery(name string, qtype uint16) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[4:], 1) // QDCOUNT
+	msg = append(msg, encodeDNSName(name)...)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	return binary.BigEndian.AppendUint16(msg, dnsClassIN)
+}
+
+// decodeDNSName reads a possibly compressed name starting at off and
+// returns it along with the offset just past it.
+func decodeDNSName(msg []byte, off int) (string, int, error) {
+	labels := []string{}
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errMalformedDNS
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 16 {
+				return "", 0, errMalformedDNS
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, errMalformedDNS
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+// decodeDNSRecords returns every answer, authority and additional record in
+// a response.
+func decodeDNSRecords(msg []byte) ([]dnsRecord, error) {
+	if len(msg) < 12 {
+		return nil, errMalformedDNS
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	records := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := decodeDNSName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next + 4
+	}
+
+	result := make([]dnsRecord, 0, records)
+	for i := 0; i < records; i++ {
+		name, next, err := decodeDNSName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errMalformedDNS
+		}
+		record := dnsRecord{Name: name, Type: binary.BigEndian.Uint16(msg[next:])}
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		data := next + 10
+		if data+length > len(msg) {
+			return nil, errMalformedDNS
+		}
+
+		switch record.Type {
+		case dnsTypeA:
+			if length == net.IPv4len {
+				record.IP = net.IP(append([]byte(nil), msg[data:data+length]...))
+			}
+		case dnsTypePTR:
+			if record.Target, _, err = decodeDNSName(msg, data); err != nil {
+				return nil, err
+			}
+		case dnsTypeSRV:
+			if length < 7 {
+				return nil, errMalformedDNS
+			}
+			record.Port = binary.BigEndian.Uint16(msg[data+4:])
+			if record.Target, _, err = decodeDNSName(msg, data+6); err != nil {
+				return nil, err
+			}
+		}
+
+		result = append(result, record)
+		off = data + length
+	}
+
+	return result, nil
+}
+
+// browseMDNS sends a one-shot mDNS query for service (e.g. "_http._tcp.local.")
+// and collects the instances that answer within timeout. Queries are sent
+// from an ephemeral port, so responders answer by unicast (RFC 6762 §6.7).
+func browseMDNS(ctx context.Context, service string, timeout time.Duration) ([]mdnsService, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mDNS socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.WriteToUDP(encodeDNSQuery(service, dnsTypePTR), mdnsGroup); err != nil {
+		return nil, fmt.Errorf("failed to send mDNS query: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	instances := map[string]bool{}
+	srv := map[string]dnsRecord{}
+	hosts := map[string]net.IP{}
+
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("failed to read mDNS response: %w", err)
+		}
+
+		records, err := decodeDNSRecords(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, record := range records {
+			switch record.Type {
+			case dnsTypePTR:
+				if strings.EqualFold(record.Name, service) {
+					instances[record.Target] = true
+				}
+			case dnsTypeSRV:
+				srv[strings.ToLower(record.Name)] = record
+			case dnsTypeA:
+				hosts[strings.ToLower(record.Name)] = record.IP
+			}
+		}
+	}
+
+	services := []mdnsService{}
+	for instance := range instances {
+		record, ok := srv[strings.ToLower(instance)]
+		if !ok {
+			continue
+		}
+		ip, ok := hosts[strings.ToLower(record.Target)]
+		if !ok {
+			continue
+		}
+		services = append(services, mdnsService{
+			Instance: instance,
+			Host:     record.Target,
+			IP:       ip,
+			Port:     record.Port,
+		})
+	}
+
+	return services, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// dnsResponse builds a response holding the given records, each as its
+// encoded name followed by type, class, TTL and RDATA.
+func dnsResponse(records ...[]byte) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[2:], 0x8400)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(records)))
+	for _, record := range records {
+		msg = append(msg, record...)
+	}
+	return msg
+}
+
+func dnsRR(name []byte, qtype uint16, data []byte) []byte {
+	record := append([]byte(nil), name...)
+	record = binary.BigEndian.AppendUint16(record, qtype)
+	record = binary.BigEndian.AppendUint16(record, dnsClassIN)
+	record = binary.BigEndian.AppendUint32(record, 120)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(data)))
+	return append(record, data...)
+}
+
+func TestDecodeDNSRecords(t *testing.T) {
+	// The PTR name starts right after the header, so later records point
+	// back to it at offset 12.
+	service := encodeDNSName("_http._tcp.local.")
+	pointer := []byte{0xc0, 12}
+	instance := append([]byte{12}, "awair-elem-1"...)
+	instance = append(instance, pointer...)
+
+	srv := []byte{0, 0, 0, 0, 0, 80}
+	srv = append(srv, encodeDNSName("awair-elem-1.local.")...)
+
+	msg := dnsResponse(
+		dnsRR(service, dnsTypePTR, instance),
+		dnsRR(append(append([]byte{12}, "awair-elem-1"...), pointer...), dnsTypeSRV, srv),
+		dnsRR(encodeDNSName("awair-elem-1.local."), dnsTypeA, []byte{192, 168, 1, 20}),
+	)
+
+	records, err := decodeDNSRecords(msg)
+	if err != nil {
+		t.Fatalf("decodeDNSRecords() error = %v", err)
+	}
+	want := []dnsRecord{
+		{Name: "_http._tcp.local.", Type: dnsTypePTR, Target: "awair-elem-1._http._tcp.local."},
+		{Name: "awair-elem-1._http._tcp.local.", Type: dnsTypeSRV, Target: "awair-elem-1.local.", Port: 80},
+		{Name: "awair-elem-1.local.", Type: dnsTypeA, IP: net.IP{192, 168, 1, 20}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("decodeDNSRecords() = %+v, want %+v", records, want)
+	}
+}
+
+func TestDecodeDNSRecordsMalformed(t *testing.T) {
+	valid := dnsResponse(dnsRR(encodeDNSName("awair.local."), dnsTypeA, []byte{10, 0, 0, 1}))
+
+	tests := []struct {
+		name string
+		msg  []byte
+	}{
+		{"short header", valid[:11]},
+		{"truncated name", valid[:15]},
+		{"truncated record header", valid[:len(valid)-8]},
+		{"truncated data", valid[:len(valid)-1]},
+		{"pointer loop", dnsResponse(dnsRR([]byte{0xc0, 12}, dnsTypeA, nil))},
+		{"pointer past the end", dnsResponse(dnsRR([]byte{0xc0, 0xff}, dnsTypeA, nil))},
+		{"short SRV", dnsResponse(dnsRR(encodeDNSName("a.local."), dnsTypeSRV, []byte{0, 0, 0}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeDNSRecords(tt.msg); !errors.Is(err, errMalformedDNS) {
+				t.Errorf("decodeDNSRecords() error = %v, want %v", err, errMalformedDNS)
+			}
+		})
+	}
+}
+
+func TestDNSNameRoundTrip(t *testing.T) {
+	for _, name := range []string{"local.", "_http._tcp.local.", "awair-elem-1._http._tcp.local."} {
+		got, end, err := decodeDNSName(encodeDNSName(name), 0)
+		if err != nil || got != name || end != len(encodeDNSName(name)) {
+			t.Errorf("decodeDNSName(encodeDNSName(%q)) = %q, %d, %v", name, got, end, err)
+		}
+	}
+}
+
+func TestDiscoveredAddress(t *testing.T) {
+	tests := []struct {
+		service mdnsService
+		want    string
+	}{
+		{mdnsService{IP: net.IP{192, 168, 1, 20}, Port: 80}, "http://192.168.1.20/air-data/latest"},
+		{mdnsService{IP: net.IP{192, 168, 1, 20}, Port: 8080}, "http://192.168.1.20:8080/air-data/latest"},
+	}
+	for _, tt := range tests {
+		if got := discoveredAddress(tt.service); got != tt.want {
+			t.Errorf("discoveredAddress(%+v) = %q, want %q", tt.service, got, tt.want)
+		}
+	}
+}
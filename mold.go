@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// moldRiskHumidity, moldRiskMinTemp and moldRiskMaxTemp bound the
+	// conditions mold grows in on most building materials.
+	moldRiskHumidity = 70
+	moldRiskMinTemp  = 20
+	moldRiskMaxTemp  = 30
+	// moldRiskWindow is the window of the share of time at risk. Mold needs
+	// favourable conditions for most of a day, not a shower's worth.
+	moldRiskWindow = 24 * time.Hour
+)
+
+// moldFavourable reports whether a temperature in ºC and a relative
+// humidity in % favour mold growth.
+func moldFavourable(temp, humid float64) bool {
+	return humid >= moldRiskHumidity && temp >= moldRiskMinTemp && temp <= moldRiskMaxTemp
+}
+
+type moldSpan struct {
+	end      time.Time
+	duration time.Duration
+}
+
+// MoldRisk keeps the device's time at risk of mold growth over
+// moldRiskWindow.
+type MoldRisk struct {
+	mu       sync.Mutex
+	last     time.Time
+	lastRisk bool
+	spans    []moldSpan
+}
+
+// add records a reading, returning the time at risk since the previous
+// one. The time between readings counts at risk when the previous reading
+// was, for at most maxGap so an outage is not counted.
+func (m *MoldRisk) add(t time.Time, risky bool, maxGap time.Duration) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var atRisk time.Duration
+	if m.lastRisk && t.After(m.last) {
+		atRisk = t.Sub(m.last)
+		if atRisk > maxGap {
+			atRisk = maxGap
+		}
+		m.spans = append(m.spans, moldSpan{end: t, duration: atRisk})
+	}
+	if !t.Before(m.last) {
+		m.last = t
+		m.lastRisk = risky
+	}
+
+	cutoff := t.Add(-moldRiskWindow)
+	for len(m.spans) > 0 && !m.spans[0].end.After(cutoff) {
+		m.spans = m.spans[1:]
+	}
+	return atRisk
+}
+
+// share returns the share of moldRiskWindow spent at risk, from 0 to 1.
+func (m *MoldRisk) share() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var total time.Duration
+	for _, span := range m.spans {
+		total += span.duration
+	}
+	return total.Seconds() / moldRiskWindow.Seconds()
+}
+
+func (app *App) initializeMoldMetrics() {
+	app.MoldRiskGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: app.MetricSubsystem,
+		Name:      "mold_risk",
+		Help:      "Share of the last 24 hours spent at 70% relative humidity or more between 20 and 30ºC, favouring mold growth (0 to 1)",
+	}, app.deviceLabelNames())
+
+	app.MoldRiskHoursCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: app.MetricSubsystem,
+		Name:      "mold_risk_hours_total",
+		Help:      "Hours spent at 70% relative humidity or more between 20 and 30ºC, favouring mold growth",
+	}, app.deviceLabelNames())
+}
+
+// recordMoldRisk adds a reading to the device's time at risk of mold
+// growth.
+func (app *App) recordMoldRisk(device *Device, stats AwairStats) {
+	if !device.Profile.has("temp") || !device.Profile.has("humid") || !hasField(stats, "temp") || !hasField(stats, "humid") {
+		return
+	}
+
+	risky := moldFavourable(stats.Temp, stats.Humid)
+	atRisk := device.MoldRisk.add(readingTime(stats), risky, 2*app.pollFrequency(device))
+	app.MoldRiskHoursCounter.With(device.Labels).Add(atRisk.Hours())
+	app.MoldRiskGauge.With(device.Labels).Set(device.MoldRisk.share())
+}
+
+func (app *App) deleteMoldRisk(device *Device) {
+	app.MoldRiskGauge.Delete(device.Labels)
+	app.MoldRiskHoursCounter.Delete(device.Labels)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMoldFavourable(t *testing.T) {
+	tests := []struct {
+		temp, humid float64
+		want        bool
+	}{
+		{22, 75, true},
+		{20, 70, true},
+		{22, 65, false},
+		{15, 85, false},
+		{32, 80, false},
+	}
+	for _, tt := range tests {
+		if got := moldFavourable(tt.temp, tt.humid); got != tt.want {
+			t.Errorf("moldFavourable(%vºC, %v%%) = %v, want %v", tt.temp, tt.humid, got, tt.want)
+		}
+	}
+}
+
+func TestMoldRisk(t *testing.T) {
+	risk := &MoldRisk{}
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	readings := []struct {
+		at    time.Duration
+		risky bool
+		want  time.Duration
+	}{
+		// The first reading has nothing before it to count.
+		{0, true, 0},
+		{10 * time.Minute, true, 10 * time.Minute},
+		// The time up to a reading counts at risk when the previous one was.
+		{20 * time.Minute, false, 10 * time.Minute},
+		{30 * time.Minute, true, 0},
+		// An outage counts for at most maxGap.
+		{3 * time.Hour, true, 15 * time.Minute},
+	}
+	for i, r := range readings {
+		if got := risk.add(start.Add(r.at), r.risky, 15*time.Minute); got != r.want {
+			t.Errorf("add() of reading %d = %v, want %v", i, got, r.want)
+		}
+	}
+	if got, want := risk.share(), (35*time.Minute).Hours()/24; got != want {
+		t.Errorf("share() = %v, want %v", got, want)
+	}
+
+	// A day later the earlier spans have left the window, leaving the
+	// capped time since the last reading at risk.
+	risk.add(start.Add(27*time.Hour), false, 15*time.Minute)
+	if got, want := risk.share(), (15*time.Minute).Hours()/24; got != want {
+		t.Errorf("share() a day later = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// validateMetricNaming checks that --metric-prefix, --metric-namespace and
+// --metric-subsystem form valid metric names. Any of them may be empty.
+func validateMetricNaming(prefix, namespace, subsystem string) error {
+	for flag, value := range map[string]string{
+		"metric-prefix":    prefix,
+		"metric-namespace": namespace,
+		"metric-subsystem": subsystem,
+	} {
+		if value != "" && (!model.IsValidMetricName(model.LabelValue(value)) || strings.Contains(value, ":")) {
+			return fmt.Errorf("invalid %s %q, must match [a-zA-Z_][a-zA-Z0-9_]*", flag, value)
+		}
+	}
+	return nil
+}
+
+// joinMetricName joins the non-empty parts of a metric name with
+// underscores, like prometheus.BuildFQName.
+func joinMetricName(parts ...string) string {
+	nonEmpty := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, "_")
+}
+
+// metricNamespace returns the namespace of every metric: --metric-namespace
+// behind the optional --metric-prefix.
+func (app *App) metricNamespace() string {
+	return joinMetricName(app.MetricPrefix, app.MetricNamespace)
+}
+
+// climatePrefix returns the start of every climate metric name, awair_climate_
+// by default.
+func (app *App) climatePrefix() string {
+	if prefix := joinMetricName(app.metricNamespace(), app.MetricSubsystem); prefix != "" {
+		return prefix + "_"
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// webhookTimeout bounds the delivery of a notification to a webhook.
+const webhookTimeout = 5 * time.Second
+
+// WebhookConfig is a webhook from the config file notified when a threshold
+// is breached or recovers. Body is a text/template executed with the
+// ThresholdEvent; the event is sent as JSON when it is empty.
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`
+	Body    string            `yaml:"body"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+type webhook struct {
+	config   WebhookConfig
+	template *template.Template
+}
+
+// ThresholdEvent describes a threshold crossing.
+type ThresholdEvent struct {
+	Device    string            `json:"device"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Sensor    string            `json:"sensor"`
+	Threshold string            `json:"threshold"`
+	Value     float64           `json:"value"`
+	Breached  bool              `json:"breached"`
+	Time      time.Time         `json:"time"`
+}
+
+func newWebhooks(configs []WebhookConfig) ([]webhook, error) {
+	webhooks := make([]webhook, 0, len(configs))
+	for _, config := range configs {
+		if config.URL == "" {
+			return nil, fmt.Errorf("webhook url is required")
+		}
+		hook := webhook{config: config}
+		if config.Body != "" {
+			t, err := template.New(config.URL).Parse(config.Body)
+			if err != nil {
+				return nil, fmt.Errorf("invalid body template for webhook %s: %w", config.URL, err)
+			}
+			hook.template = t
+		}
+		webhooks = append(webhooks, hook)
+	}
+	return webhooks, nil
+}
+
+func (h webhook) body(event ThresholdEvent) ([]byte, string, error) {
+	if h.template == nil {
+		body, err := json.Marshal(event)
+		return body, "application/json", err
+	}
+
+	var buf bytes.Buffer
+	if err := h.template.Execute(&buf, event); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "", nil
+}
+
+func (h webhook) send(ctx context.Context, event ThresholdEvent) error {
+	body, contentType, err := h.body(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for key, value := range h.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// notifyThreshold posts a threshold crossing to every webhook in the
+// background so slow webhooks do not delay polling.
+func (app *App) notifyThreshold(event ThresholdEvent) {
+	for _, hook := range app.Webhooks {
+		app.pollers.Add(1)
+		go func(hook webhook) {
+			defer app.pollers.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+			defer cancel()
+			if err := hook.send(ctx, event); err != nil {
+				app.Logger.Error("Error notifying webhook", zap.String("url", hook.config.URL), zap.String("device", event.Device), zap.Error(err))
+			}
+		}(hook)
+	}
+}
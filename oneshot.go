@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+func init() {
+	registerCommand("poll", command{
+		Usage: "Poll the devices at the given addresses once and print their readings, exiting 1 when a poll fails.\nAn address is a device's air-data URL or its host, http://<host>/air-data/latest being assumed.",
+		Run:   runPoll,
+	})
+}
+
+// polledReading is a reading printed by the poll command.
+type polledReading struct {
+	Address   string             `json:"address"`
+	Timestamp *time.Time         `json:"timestamp,omitempty"`
+	Profile   string             `json:"profile,omitempty"`
+	Readings  map[string]float64 `json:"readings,omitempty"`
+	Error     string             `json:"error,omitempty"`
+
+	fields []string
+}
+
+func runPoll(fs *pflag.FlagSet, args []string) int {
+	asJSON := fs.Bool("json", false, "Print the readings as JSON")
+	timeout := fs.Duration("timeout", 5*time.Second, "Time to wait for each device")
+	caFile := fs.String("awair-ca-file", "", "PEM file of CA certificates to trust when polling devices over HTTPS")
+	insecureSkipVerify := fs.Bool("awair-insecure-skip-verify", false, "Skip verifying the device's TLS certificate")
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	client, err := newDeviceClient(*caFile, *insecureSkipVerify, "", false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	app := &App{Logger: zap.NewNop(), Client: client, TemperatureUnit: temperatureCelsius}
+
+	exitCode := 0
+	readings := make([]polledReading, 0, fs.NArg())
+	for _, target := range fs.Args() {
+		reading := app.pollOnce(target, *timeout)
+		if reading.Error != "" {
+			exitCode = 1
+		}
+		readings = append(readings, reading)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(readings); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return exitCode
+	}
+	printReadings(os.Stdout, readings)
+	return exitCode
+}
+
+// pollOnce fetches a reading from the target like a /probe.
+func (app *App) pollOnce(target string, timeout time.Duration) polledReading {
+	address, err := probeAddress(target)
+	if err != nil {
+		return polledReading{Address: target, Error: err.Error()}
+	}
+	reading := polledReading{Address: address}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stats, profile, err := app.probe(ctx, &probeModule{}, address)
+	if err != nil {
+		reading.Error = err.Error()
+		return reading
+	}
+
+	if !stats.Timestamp.IsZero() {
+		reading.Timestamp = &stats.Timestamp
+	}
+	reading.Profile = profile.Name
+	reading.Readings = map[string]float64{}
+	for _, field := range app.climateFields(profile) {
+		if !hasField(stats, field) {
+			continue
+		}
+		reading.Readings[field] = fieldValue(stats, field)
+		reading.fields = append(reading.fields, field)
+	}
+	return reading
+}
+
+// printReadings prints the readings as a table per device, the fields
+// named after their climate gauges to give their units.
+func printReadings(out io.Writer, readings []polledReading) {
+	for i, reading := range readings {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintln(out, reading.Address)
+		if reading.Error != "" {
+			fmt.Fprintf(out, "  error: %s\n", reading.Error)
+			continue
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "  profile\t%s\n", reading.Profile)
+		if reading.Timestamp != nil {
+			fmt.Fprintf(w, "  timestamp\t%s\n", reading.Timestamp.Local().Format(time.RFC3339))
+		}
+		for _, field := range reading.fields {
+			name, ok := climateMetricNames[field]
+			if !ok {
+				name = derivedMetricNames[field]
+			}
+			// Derived values carry float noise.
+			fmt.Fprintf(w, "  %s\t%g\n", name, math.Round(reading.Readings[field]*100)/100)
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestPollOnce(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"timestamp":"2024-01-02T03:04:05.000Z","temp":21.5,"humid":40,"occupancy":1}`))
+	}))
+	defer device.Close()
+
+	app := &App{Logger: zap.NewNop(), Client: device.Client(), TemperatureUnit: temperatureCelsius}
+	readings := []polledReading{
+		app.pollOnce(device.URL+"/air-data/latest", time.Second),
+		app.pollOnce("http://127.0.0.1:1/air-data/latest", time.Second),
+	}
+
+	if got := readings[0].Readings["heat_index"]; got < 20 || got > 22 {
+		t.Errorf("heat index = %v, want about 21", got)
+	}
+	if readings[1].Error == "" {
+		t.Error("poll of an unreachable device succeeded")
+	}
+
+	out := &bytes.Buffer{}
+	printReadings(out, readings)
+	for _, want := range []string{"temp_c             21.5\n", "occupancy          1\n", "heat_index_c       20.", "error: Get"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("printReadings() output is missing %q:\n%s", want, out)
+		}
+	}
+}
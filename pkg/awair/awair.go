@@ -0,0 +1,286 @@
+// Package awair is a client of the local API of Awair air quality monitors,
+// enabled per device in the Awair Home app.
+package awair
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// LatestPath serves the device's latest reading.
+	LatestPath = "/air-data/latest"
+	// ConfigPath serves the device's metadata.
+	ConfigPath = "/settings/config/data"
+
+	// maxBodySize bounds the responses read, far above the ~1 KiB the
+	// devices send.
+	maxBodySize = 1 << 20
+)
+
+// Fields are the payload fields of the readings, in the order of the
+// richest model's payload.
+var Fields = []string{
+	"temp", "humid", "co2", "voc", "pm25", "score", "dew_point", "abs_humid",
+	"co2_est", "co2_est_baseline", "voc_baseline", "voc_h2_raw", "voc_ethanol_raw", "pm10_est",
+	"lux", "spl_a", "occupancy",
+}
+
+// AirData is a reading of /air-data/latest. Models only send the fields of
+// their sensors, which Has tells apart from zero readings. A decoded reading
+// records the Fields it lacks, while every field of a literal is present.
+type AirData struct {
+	Timestamp time.Time `json:"timestamp"`
+
+	Score          int     `json:"score"`
+	DewPoint       float64 `json:"dew_point"`
+	Temp           float64 `json:"temp"`
+	Humid          float64 `json:"humid"`
+	AbsHumid       float64 `json:"abs_humid"`
+	Co2            int     `json:"co2"`
+	Co2Est         int     `json:"co2_est"`
+	Co2EstBaseline int     `json:"co2_est_baseline"`
+	Voc            int     `json:"voc"`
+	VocBaseline    int     `json:"voc_baseline"`
+	VocH2Raw       int     `json:"voc_h2_raw"`
+	VocEthanolRaw  int     `json:"voc_ethanol_raw"`
+	Pm25           int     `json:"pm25"`
+	Pm10Est        int     `json:"pm10_est"`
+	Lux            float64 `json:"lux"`
+	SplA           float64 `json:"spl_a"`
+	// Occupancy is 1 while the Glow C's motion sensor detects someone.
+	Occupancy float64 `json:"occupancy"`
+
+	// missing holds the Fields the payload lacked, as bits of their index,
+	// keeping readings comparable.
+	missing uint32
+}
+
+// fieldBit returns the bit of a field in AirData.missing, or 0 for a field
+// not in Fields.
+func fieldBit(field string) uint32 {
+	for i, f := range Fields {
+		if f == field {
+			return 1 << i
+		}
+	}
+	return 0
+}
+
+func (d *AirData) UnmarshalJSON(data []byte) error {
+	type airData AirData
+	if err := json.Unmarshal(data, (*airData)(d)); err != nil {
+		return err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	d.missing = 0
+	for _, field := range Fields {
+		if value, ok := fields[field]; !ok || string(value) == "null" {
+			d.missing |= fieldBit(field)
+		}
+	}
+	return nil
+}
+
+// Has reports whether the reading has one of the Fields.
+func (d AirData) Has(field string) bool {
+	bit := fieldBit(field)
+	return bit != 0 && d.missing&bit == 0
+}
+
+// Drop marks a field missing, e.g. a reading the sensor cannot take.
+func (d *AirData) Drop(field string) {
+	d.missing |= fieldBit(field)
+}
+
+// Value returns the value of a payload field, and whether the payload had
+// it.
+func (d AirData) Value(field string) (float64, bool) {
+	var value float64
+	switch field {
+	case "temp":
+		value = d.Temp
+	case "humid":
+		value = d.Humid
+	case "co2":
+		value = float64(d.Co2)
+	case "voc":
+		value = float64(d.Voc)
+	case "pm25":
+		value = float64(d.Pm25)
+	case "score":
+		value = float64(d.Score)
+	case "dew_point":
+		value = d.DewPoint
+	case "abs_humid":
+		value = d.AbsHumid
+	case "co2_est":
+		value = float64(d.Co2Est)
+	case "co2_est_baseline":
+		value = float64(d.Co2EstBaseline)
+	case "voc_baseline":
+		value = float64(d.VocBaseline)
+	case "voc_h2_raw":
+		value = float64(d.VocH2Raw)
+	case "voc_ethanol_raw":
+		value = float64(d.VocEthanolRaw)
+	case "pm10_est":
+		value = float64(d.Pm10Est)
+	case "lux":
+		value = d.Lux
+	case "spl_a":
+		value = d.SplA
+	case "occupancy":
+		value = d.Occupancy
+	default:
+		return 0, false
+	}
+	return value, d.Has(field)
+}
+
+// SetValue sets one of the Fields, rounding the value of the integer fields.
+// It panics on a field not in Fields.
+func (d *AirData) SetValue(field string, value float64) {
+	rounded := int(math.Round(value))
+	switch field {
+	case "temp":
+		d.Temp = value
+	case "humid":
+		d.Humid = value
+	case "co2":
+		d.Co2 = rounded
+	case "voc":
+		d.Voc = rounded
+	case "pm25":
+		d.Pm25 = rounded
+	case "score":
+		d.Score = rounded
+	case "dew_point":
+		d.DewPoint = value
+	case "abs_humid":
+		d.AbsHumid = value
+	case "co2_est":
+		d.Co2Est = rounded
+	case "co2_est_baseline":
+		d.Co2EstBaseline = rounded
+	case "voc_baseline":
+		d.VocBaseline = rounded
+	case "voc_h2_raw":
+		d.VocH2Raw = rounded
+	case "voc_ethanol_raw":
+		d.VocEthanolRaw = rounded
+	case "pm10_est":
+		d.Pm10Est = rounded
+	case "lux":
+		d.Lux = value
+	case "spl_a":
+		d.SplA = value
+	case "occupancy":
+		d.Occupancy = value
+	default:
+		panic(fmt.Sprintf("unknown payload field %q", field))
+	}
+}
+
+// DeviceConfig is the subset of /settings/config/data describing the
+// device. Display and LED settings are missing on models without a display.
+type DeviceConfig struct {
+	DeviceUUID string `json:"device_uuid"`
+	FwVersion  string `json:"fw_version"`
+	Display    string `json:"display"`
+	LED        struct {
+		Mode string `json:"mode"`
+	} `json:"led"`
+	// RSSI is the Wi-Fi signal strength in dBm, missing on older firmware.
+	RSSI *float64 `json:"rssi"`
+}
+
+// Model derives the model from the UUID, e.g. "awair-element" from
+// "awair-element_12345".
+func (c DeviceConfig) Model() string {
+	model, _, _ := strings.Cut(c.DeviceUUID, "_")
+	return model
+}
+
+// StatusError is returned for responses other than 200 OK.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected status " + e.Status
+}
+
+// Client reads a device's local API.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient returns a client of the device at address, its base URL such as
+// http://192.168.1.20 or its /air-data/latest URL. A nil httpClient uses
+// http.DefaultClient.
+func NewClient(address string, httpClient *http.Client) (*Client, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid address %q, must be an http:// or https:// URL", address)
+	}
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, LatestPath), "/")
+	u.RawQuery = ""
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: u.String(), httpClient: httpClient}, nil
+}
+
+// Latest returns the device's latest reading.
+func (c *Client) Latest(ctx context.Context) (AirData, error) {
+	data := AirData{}
+	err := c.get(ctx, LatestPath, &data)
+	return data, err
+}
+
+// Config returns the device's metadata.
+func (c *Client) Config(ctx context.Context) (DeviceConfig, error) {
+	config := DeviceConfig{}
+	err := c.get(ctx, ConfigPath, &config)
+	return config, err
+}
+
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package awair
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{"http://10.0.0.5", "http://10.0.0.5", false},
+		{"http://10.0.0.5/", "http://10.0.0.5", false},
+		{"http://10.0.0.5/air-data/latest", "http://10.0.0.5", false},
+		{"https://awair.lan:8443/sim-2/air-data/latest", "https://awair.lan:8443/sim-2", false},
+		{"10.0.0.5", "", true},
+		{"ftp://10.0.0.5", "", true},
+	}
+	for _, tt := range tests {
+		client, err := NewClient(tt.address, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewClient(%q) error = %v, want error %v", tt.address, err, tt.wantErr)
+			continue
+		}
+		if err == nil && client.baseURL != tt.want {
+			t.Errorf("NewClient(%q) base URL = %q, want %q", tt.address, client.baseURL, tt.want)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case LatestPath:
+			// A Mint, without a CO2 sensor.
+			w.Write([]byte(`{"timestamp":"2024-01-02T03:04:05.000Z","score":90,"temp":21.5,"humid":40,"voc":0,"pm25":3,"lux":12}`))
+		case ConfigPath:
+			w.Write([]byte(`{"device_uuid":"awair-mint_1","fw_version":"1.2.3"}`))
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer device.Close()
+
+	client, err := NewClient(device.URL, device.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := client.Latest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := data.Value("temp"); !ok || value != 21.5 {
+		t.Errorf("Value(temp) = %v, %v, want 21.5, true", value, ok)
+	}
+	if value, ok := data.Value("voc"); !ok || value != 0 {
+		t.Errorf("Value(voc) = %v, %v, want 0, true", value, ok)
+	}
+	if _, ok := data.Value("co2"); ok {
+		t.Error("Value(co2) is present, want missing")
+	}
+
+	config, err := client.Config(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Model() != "awair-mint" || config.FwVersion != "1.2.3" {
+		t.Errorf("Config() = %+v, want an awair-mint on 1.2.3", config)
+	}
+
+	missing, err := NewClient(device.URL+"/missing", device.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = missing.Latest(context.Background())
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Latest() error = %v, want a 404 StatusError", err)
+	}
+}
+
+func TestAirDataFields(t *testing.T) {
+	data := AirData{}
+	if err := json.Unmarshal([]byte(`{"temp":21.5,"humid":null}`), &data); err != nil {
+		t.Fatal(err)
+	}
+	if !data.Has("temp") || data.Has("humid") || data.Has("co2") || data.Has("unknown") {
+		t.Errorf("Has(temp, humid, co2, unknown) = %v, %v, %v, %v, want true, false, false, false", data.Has("temp"), data.Has("humid"), data.Has("co2"), data.Has("unknown"))
+	}
+
+	data.SetValue("co2", 612.4)
+	data.Drop("temp")
+	if data.Co2 != 612 || data.Has("temp") {
+		t.Errorf("after SetValue(co2, 612.4) and Drop(temp), co2 = %d, Has(temp) = %v, want 612, false", data.Co2, data.Has("temp"))
+	}
+
+	// Every field of a reading not decoded from a payload is present.
+	if !(AirData{}).Has("co2") {
+		t.Error("Has(co2) of a literal = false, want true")
+	}
+}
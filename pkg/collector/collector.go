@@ -0,0 +1,125 @@
+// Package collector exports the readings of an Awair device as a
+// prometheus.Collector, polling the device on every scrape. Register one per
+// device, told apart with a device constant label:
+//
+//	client, _ := awair.NewClient("http://192.168.1.20", nil)
+//	prometheus.MustRegister(collector.New(client, collector.Options{
+//		ConstLabels: prometheus.Labels{"device": "office"},
+//	}))
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/epk/awair-local-prom-exporter/pkg/awair"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metric describes the gauge of a payload field.
+type Metric struct {
+	// Name is the gauge name without the namespace and subsystem.
+	Name string
+	Help string
+}
+
+// Metrics are the gauges of the awair.Fields, which the exporter exports
+// too.
+var Metrics = map[string]Metric{
+	"temp":             {"temp_c", "Dry bulb temperature (ºC)"},
+	"humid":            {"relative_humidity", "Relative Humidity (%)"},
+	"co2":              {"co2_ppm", "Carbon Dioxide (ppm)"},
+	"voc":              {"voc_ppb", "Total Volatile Organic Compounds (ppb)"},
+	"pm25":             {"pm25_ug_m3", "Particulate matter less than 2.5 microns in diameter (µg/m³)"},
+	"score":            {"score", "Awair Score (0-100)"},
+	"dew_point":        {"dew_point_c", "The temperature at which water will condense and form into dew (ºC)"},
+	"abs_humid":        {"absolute_humidity", "Absolute Humidity (g/m³)"},
+	"co2_est":          {"co2_estimate", "Estimated Carbon Dioxide (ppm - calculated by the TVOC sensor)"},
+	"co2_est_baseline": {"co2_estimate_baselines", "A unitless value that represents the baseline from which the TVOC sensor partially derives its estimated (e)CO₂output."},
+	"voc_baseline":     {"voc_baseline", "A unitless value that represents the baseline from which the TVOC sensor partially derives its TVOC output."},
+	"voc_h2_raw":       {"voc_h2_raw", "A unitless value that represents the Hydrogen gas signal from which the TVOC sensor partially derives its TVOC output."},
+	"voc_ethanol_raw":  {"voc_ethanol_raw", "A unitless value that represents the Ethanol gas signal from which the TVOC sensor partially derives its TVOC output."},
+	"pm10_est":         {"pm10_estimate", "Estimated particulate matter less than 10 microns in diameter (µg/m³ - calculated by the PM2.5 sensor)"},
+	"lux":              {"illuminance_lux", "Illuminance (lux)"},
+	"spl_a":            {"sound_level_dba", "A-weighted sound pressure level (dBA)"},
+	"occupancy":        {"occupancy", "Whether the motion sensor detects someone (1) or not (0)"},
+}
+
+// Options configure a Collector.
+type Options struct {
+	// Namespace and Subsystem prefix the climate gauges, awair_climate_ by
+	// default. Namespace also prefixes the up and scrape duration gauges.
+	Namespace string
+	Subsystem string
+	// ConstLabels are added to every series.
+	ConstLabels prometheus.Labels
+	// Timeout bounds polling the device, 5s by default.
+	Timeout time.Duration
+}
+
+// Collector polls an Awair device when collected.
+type Collector struct {
+	client  *awair.Client
+	timeout time.Duration
+
+	fields   map[string]*prometheus.Desc
+	up       *prometheus.Desc
+	duration *prometheus.Desc
+}
+
+// New returns a collector of the device read by client.
+func New(client *awair.Client, opts Options) *Collector {
+	if opts.Namespace == "" {
+		opts.Namespace = "awair"
+	}
+	if opts.Subsystem == "" {
+		opts.Subsystem = "climate"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	c := &Collector{
+		client:  client,
+		timeout: opts.Timeout,
+		fields:  map[string]*prometheus.Desc{},
+		up: prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, "", "up"),
+			"Whether the last poll of the device succeeded (1) or not (0)", nil, opts.ConstLabels),
+		duration: prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, "", "scrape_duration_seconds"),
+			"Time taken by the device to answer the poll", nil, opts.ConstLabels),
+	}
+	for field, m := range Metrics {
+		c.fields[field] = prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, m.Name), m.Help, nil, opts.ConstLabels)
+	}
+	return c
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.duration
+	for _, desc := range c.fields {
+		ch <- desc
+	}
+}
+
+// Collect polls the device, exporting the fields of its reading. Fields
+// missing from the payload, e.g. co2 on a Mint, are not exported.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	data, err := c.client.Latest(ctx)
+	ch <- prometheus.MustNewConstMetric(c.duration, prometheus.GaugeValue, time.Since(start).Seconds())
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+
+	for _, field := range awair.Fields {
+		if value, ok := data.Value(field); ok {
+			ch <- prometheus.MustNewConstMetric(c.fields[field], prometheus.GaugeValue, value)
+		}
+	}
+}
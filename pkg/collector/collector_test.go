@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/epk/awair-local-prom-exporter/pkg/awair"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"timestamp":"2024-01-02T03:04:05.000Z","score":90,"temp":21.5,"humid":40}`))
+	}))
+	defer device.Close()
+
+	client, err := awair.NewClient(device.URL, device.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(client, Options{ConstLabels: prometheus.Labels{"device": "office"}})
+
+	want := `
+# HELP awair_climate_relative_humidity Relative Humidity (%)
+# TYPE awair_climate_relative_humidity gauge
+awair_climate_relative_humidity{device="office"} 40
+# HELP awair_climate_score Awair Score (0-100)
+# TYPE awair_climate_score gauge
+awair_climate_score{device="office"} 90
+# HELP awair_climate_temp_c Dry bulb temperature (ºC)
+# TYPE awair_climate_temp_c gauge
+awair_climate_temp_c{device="office"} 21.5
+# HELP awair_up Whether the last poll of the device succeeded (1) or not (0)
+# TYPE awair_up gauge
+awair_up{device="office"} 1
+`
+	names := []string{"awair_climate_relative_humidity", "awair_climate_score", "awair_climate_temp_c", "awair_climate_co2_ppm", "awair_up"}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+
+	device.Close()
+	want = `
+# HELP awair_up Whether the last poll of the device succeeded (1) or not (0)
+# TYPE awair_up gauge
+awair_up{device="office"} 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+}
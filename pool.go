@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var errPollPanicked = errors.New("poll panicked")
+
+// pollJob is a poll run by a worker of the pool.
+type pollJob struct {
+	ctx    context.Context
+	device *Device
+	fn     func(ctx context.Context) error
+	done   chan error
+}
+
+func (app *App) initializePoolMetrics() {
+	app.PollWorkersBusyGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "exporter",
+		Name:      "poll_workers_busy",
+		Help:      "Number of --poll-workers currently polling a device",
+	})
+}
+
+// startPollWorkers starts --poll-workers workers running the polls of every
+// device until ctx is done. Each device keeps its own schedule, so a slow
+// device only holds up one worker. Without workers every device is polled
+// from its own goroutine.
+func (app *App) startPollWorkers(ctx context.Context) {
+	if app.PollWorkers <= 0 {
+		return
+	}
+
+	// Unbuffered, so a job is only handed over once a worker is free and
+	// devices waiting for one are not polled late from a stale queue.
+	app.pollJobs = make(chan pollJob)
+	for i := 0; i < app.PollWorkers; i++ {
+		app.pollers.Add(1)
+		go func() {
+			defer app.pollers.Done()
+			for {
+				select {
+				case job := <-app.pollJobs:
+					app.runPollJob(job)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (app *App) runPollJob(job pollJob) {
+	app.PollWorkersBusyGauge.Inc()
+	defer app.PollWorkersBusyGauge.Dec()
+
+	var err error
+	panicked := app.runRecovered(job.ctx, "poll:"+job.device.Name, func(ctx context.Context) {
+		err = job.fn(ctx)
+	})
+	if panicked {
+		err = errPollPanicked
+	}
+	job.done <- err
+}
+
+// withPollWorker runs fn on a worker of the pool, waiting for one to be free
+// unless ctx is done first, and returns its error.
+func (app *App) withPollWorker(ctx context.Context, device *Device, fn func(ctx context.Context) error) error {
+	if app.pollJobs == nil {
+		return fn(ctx)
+	}
+
+	job := pollJob{ctx: ctx, device: device, fn: fn, done: make(chan error, 1)}
+	select {
+	case app.pollJobs <- job:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-job.done
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// startTestPollWorkers starts the app's poll workers until the test ends.
+func startTestPollWorkers(t *testing.T, app *App) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.startPollWorkers(ctx)
+	t.Cleanup(func() {
+		cancel()
+		app.pollers.Wait()
+	})
+}
+
+func TestWithPollWorkerBound(t *testing.T) {
+	app := newTestApp(t, "--poll-workers=2")
+	startTestPollWorkers(t, app)
+	device := addTestDevice(app, "office", "http://office")
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := app.withPollWorker(context.Background(), device, func(ctx context.Context) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("withPollWorker() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got != 2 {
+		t.Errorf("polls run at once = %d, want --poll-workers", got)
+	}
+	if got := testutil.ToFloat64(app.PollWorkersBusyGauge); got != 0 {
+		t.Errorf("poll_workers_busy once idle = %v, want 0", got)
+	}
+}
+
+func TestWithPollWorkerErrors(t *testing.T) {
+	app := newTestApp(t, "--poll-workers=1")
+	startTestPollWorkers(t, app)
+	device := addTestDevice(app, "office", "http://office")
+	ctx := context.Background()
+
+	errFailed := errors.New("failed")
+	if err := app.withPollWorker(ctx, device, func(context.Context) error { return errFailed }); err != errFailed {
+		t.Errorf("withPollWorker() error = %v, want %v", err, errFailed)
+	}
+	if err := app.withPollWorker(ctx, device, func(context.Context) error { panic("boom") }); err != errPollPanicked {
+		t.Errorf("withPollWorker() of a panicking poll error = %v, want %v", err, errPollPanicked)
+	}
+
+	// The worker survives the panic.
+	if err := app.withPollWorker(ctx, device, func(context.Context) error { return nil }); err != nil {
+		t.Errorf("withPollWorker() after a panic error = %v", err)
+	}
+}
+
+func TestWithPollWorkerCancelled(t *testing.T) {
+	app := newTestApp(t, "--poll-workers=1")
+	startTestPollWorkers(t, app)
+	device := addTestDevice(app, "office", "http://office")
+
+	// Hold the only worker.
+	release := make(chan struct{})
+	busy := make(chan struct{})
+	go app.withPollWorker(context.Background(), device, func(context.Context) error {
+		close(busy)
+		<-release
+		return nil
+	})
+	<-busy
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ran := false
+	err := app.withPollWorker(ctx, device, func(context.Context) error {
+		ran = true
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("withPollWorker() waiting for a worker error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if ran {
+		t.Error("poll ran after its context was done")
+	}
+}
+
+func TestWithPollWorkerDisabled(t *testing.T) {
+	app := newTestApp(t)
+	startTestPollWorkers(t, app)
+	device := addTestDevice(app, "office", "http://office")
+
+	if app.pollJobs != nil {
+		t.Fatal("poll workers started with --poll-workers=0")
+	}
+	ran := false
+	app.withPollWorker(context.Background(), device, func(context.Context) error {
+		ran = true
+		return nil
+	})
+	if !ran {
+		t.Error("poll did not run without workers")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/epk/awair-local-prom-exporter/pkg/awair"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// probeTimeoutOffset is kept from Prometheus' scrape timeout to send the
+// probe's response in.
+const probeTimeoutOffset = time.Millisecond * 500
+
+// probeModule configures the probes of a ?module=.
+type probeModule struct {
+	timeout time.Duration
+	client  *http.Client
+	labels  prometheus.Labels
+	// profile lists the exported fields, detected from the payload when
+	// empty.
+	profile deviceProfile
+}
+
+// newProbeModules builds the probe modules of the config file. Their
+// clients go through the same proxy as the polled devices.
+func newProbeModules(configs map[string]ProbeModuleConfig, proxy string, proxyFromEnv bool) (map[string]*probeModule, error) {
+	modules := make(map[string]*probeModule, len(configs))
+	for name, config := range configs {
+		if config.Timeout < 0 {
+			return nil, fmt.Errorf("invalid probe module %q: timeout must not be negative", name)
+		}
+		for label := range config.Labels {
+			if err := validateDeviceLabelName(label); err != nil {
+				return nil, fmt.Errorf("invalid probe module %q: %w", name, err)
+			}
+		}
+		if err := validateForceSensors(config.Sensors); err != nil {
+			return nil, fmt.Errorf("invalid probe module %q: %w", name, err)
+		}
+		client, err := newDeviceClient(config.CAFile, config.InsecureSkipVerify, proxy, proxyFromEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid probe module %q: %w", name, err)
+		}
+
+		module := &probeModule{
+			timeout: config.Timeout,
+			client:  client,
+			labels:  prometheus.Labels(config.Labels),
+		}
+		if len(config.Sensors) > 0 {
+			module.profile = deviceProfile{Name: name, Fields: config.Sensors}
+		}
+		modules[name] = module
+	}
+	return modules, nil
+}
+
+// probeAddress returns the air-data URL of a /probe target, either a URL or a
+// bare host[:port] of a device's local API.
+func probeAddress(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		u, err = url.Parse("http://" + target + awair.LatestPath)
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid target %q", target)
+		}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid target %q, must be an http:// or https:// URL", target)
+	}
+	return u.String(), nil
+}
+
+// probeTimeout returns how long a probe may take: Prometheus' scrape timeout
+// less probeTimeoutOffset, up to the module's timeout or pollTimeout.
+func probeTimeout(r *http.Request, module *probeModule) time.Duration {
+	limit := pollTimeout
+	if module.timeout > 0 {
+		limit = module.timeout
+	}
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || seconds <= 0 {
+		return limit
+	}
+	timeout := time.Duration(seconds*float64(time.Second)) - probeTimeoutOffset
+	if timeout <= 0 || timeout > limit {
+		return limit
+	}
+	return timeout
+}
+
+// probe fetches a reading from the address and the profile of its payload,
+// or the module's.
+func (app *App) probe(ctx context.Context, module *probeModule, address string) (AwairStats, deviceProfile, error) {
+	req, err := app.newDeviceRequest(ctx, address)
+	if err != nil {
+		return AwairStats{}, deviceProfile{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	client := module.client
+	if client == nil {
+		client = app.Client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return AwairStats{}, deviceProfile{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return AwairStats{}, deviceProfile{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := app.readDeviceBody(resp.Body)
+	if err != nil {
+		return AwairStats{}, deviceProfile{}, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	stats := AwairStats{}
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return AwairStats{}, deviceProfile{}, fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+	if len(module.profile.Fields) > 0 {
+		return stats, module.profile, nil
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return AwairStats{}, deviceProfile{}, fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+	profile, _ := matchProfile(fields)
+	return stats, profile, nil
+}
+
+// probeHandler polls the device given by ?target= and serves its climate
+// gauges, labelled by the ?module= labels only, with the probe's outcome,
+// like the blackbox exporter. Devices are then picked by the Prometheus
+// scrape config alone.
+func (app *App) probeHandler(w http.ResponseWriter, r *http.Request) {
+	module := &probeModule{}
+	if name := r.URL.Query().Get("module"); name != "" {
+		var ok bool
+		module, ok = app.ProbeModules[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown module %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	address, err := probeAddress(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	success := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   app.metricNamespace(),
+		Subsystem:   "probe",
+		Name:        "success",
+		Help:        "Whether the target answered with a reading (1) or not (0)",
+		ConstLabels: module.labels,
+	})
+	duration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   app.metricNamespace(),
+		Subsystem:   "probe",
+		Name:        "duration_seconds",
+		Help:        "Time taken by the target to answer the probe",
+		ConstLabels: module.labels,
+	})
+	registry.MustRegister(success, duration)
+
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout(r, module))
+	defer cancel()
+	start := time.Now()
+	stats, profile, err := app.probe(ctx, module, address)
+	duration.Set(time.Since(start).Seconds())
+	if err != nil {
+		app.Logger.Warn("Probe failed", zap.String("target", address), zap.Error(err))
+	} else {
+		success.Set(1)
+		for _, field := range app.climateFields(profile) {
+			if !hasField(stats, field) {
+				continue
+			}
+			name, ok := climateMetricNames[field]
+			if !ok {
+				name = derivedMetricNames[field]
+			}
+			gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+				Name:        app.climatePrefix() + name,
+				Help:        fmt.Sprintf("Reading of the target's %s field", field),
+				ConstLabels: module.labels,
+			})
+			gauge.Set(fieldValue(stats, field))
+			registry.MustRegister(gauge)
+		}
+	}
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestProbeAddress(t *testing.T) {
+	tests := []struct {
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{"http://10.0.0.5/air-data/latest", "http://10.0.0.5/air-data/latest", false},
+		{"https://awair.lan:8443/air-data/latest", "https://awair.lan:8443/air-data/latest", false},
+		{"10.0.0.5", "http://10.0.0.5/air-data/latest", false},
+		{"10.0.0.5:8080", "http://10.0.0.5:8080/air-data/latest", false},
+		{"ftp://10.0.0.5/air-data", "", true},
+		{"%zz", "", true},
+	}
+	for _, tt := range tests {
+		got, err := probeAddress(tt.target)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("probeAddress(%q) = %q, %v, want %q, error %v", tt.target, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestProbeHandler(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"timestamp":"2024-01-02T03:04:05.000Z","score":90,"temp":21.5,"humid":40,"dew_point":7.4,"abs_humid":7.5,"lux":12,"spl_a":40,"co2":600,"voc":100,"pm25":3}`))
+	}))
+	defer device.Close()
+
+	app := &App{Logger: zap.NewNop(), Client: device.Client(), MetricNamespace: "awair", MetricSubsystem: "climate", TemperatureUnit: temperatureCelsius}
+	var err error
+	rec := httptest.NewRecorder()
+	app.probeHandler(rec, httptest.NewRequest(http.MethodGet, "/probe?target="+device.URL+"/air-data/latest", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{"awair_probe_success 1", "awair_climate_temp_c 21.5", "awair_climate_co2_ppm 600", "awair_climate_heat_index_c"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("probe response is missing %q:\n%s", want, body)
+		}
+	}
+	// Only the fields in the payload are exported.
+	if strings.Contains(body, "occupancy") {
+		t.Errorf("probe response has a field outside the payload:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	app.probeHandler(rec, httptest.NewRequest(http.MethodGet, "/probe?target=http://127.0.0.1:1/air-data/latest", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "awair_probe_success 0") || strings.Contains(body, "climate") {
+		t.Errorf("failed probe response:\n%s", body)
+	}
+
+	app.ProbeModules, err = newProbeModules(map[string]ProbeModuleConfig{
+		"glow": {Labels: map[string]string{"model": "glow"}, Sensors: []string{"temp"}},
+	}, "", false)
+	if err != nil {
+		t.Fatalf("newProbeModules() error = %v", err)
+	}
+	rec = httptest.NewRecorder()
+	app.probeHandler(rec, httptest.NewRequest(http.MethodGet, "/probe?module=glow&target="+device.URL, nil))
+	body = rec.Body.String()
+	if !strings.Contains(body, `awair_climate_temp_c{model="glow"} 21.5`) || !strings.Contains(body, `awair_probe_success{model="glow"} 1`) || strings.Contains(body, "co2") {
+		t.Errorf("probe response of the glow module:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	app.probeHandler(rec, httptest.NewRequest(http.MethodGet, "/probe?module=omni&target="+device.URL, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("probe of an unknown module status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = httptest.NewRecorder()
+	app.probeHandler(rec, httptest.NewRequest(http.MethodGet, "/probe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("probe without a target status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestNewProbeModulesInvalid(t *testing.T) {
+	tests := map[string]ProbeModuleConfig{
+		"negative timeout": {Timeout: -time.Second},
+		"reserved label":   {Labels: map[string]string{"device": "x"}},
+		"unknown sensor":   {Sensors: []string{"radon"}},
+		"missing CA file":  {CAFile: "/nonexistent/ca.pem"},
+	}
+	for name, config := range tests {
+		if _, err := newProbeModules(map[string]ProbeModuleConfig{"m": config}, "", false); err == nil {
+			t.Errorf("newProbeModules() with a %s succeeded", name)
+		}
+	}
+}
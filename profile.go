@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/epk/awair-local-prom-exporter/pkg/awair"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// profileAuto picks the device profile from the fields of the first payload.
+const profileAuto = "auto"
+
+// deviceProfile describes the payload fields reported by an Awair model.
+// Climate gauges for fields outside the profile are not exported, so
+// models without a sensor don't report it as zero.
+type deviceProfile struct {
+	Name   string
+	Fields []string
+}
+
+// knownFields lists every payload field the exporter knows of.
+var knownFields = deviceProfile{
+	Name:   "all",
+	Fields: awair.Fields,
+}
+
+// deviceProfiles is ordered from the richest to the most reduced sensor set,
+// which is the order auto-detection tries them in.
+var deviceProfiles = []deviceProfile{
+	{
+		// The Omni adds light and sound sensors to the Element's set.
+		Name: "omni",
+		Fields: []string{
+			"temp", "humid", "co2", "voc", "pm25", "score", "dew_point", "abs_humid",
+			"co2_est", "co2_est_baseline", "voc_baseline", "voc_h2_raw", "voc_ethanol_raw", "pm10_est",
+			"lux", "spl_a",
+		},
+	},
+	{
+		Name: "element",
+		Fields: []string{
+			"temp", "humid", "co2", "voc", "pm25", "score", "dew_point", "abs_humid",
+			"co2_est", "co2_est_baseline", "voc_baseline", "voc_h2_raw", "voc_ethanol_raw", "pm10_est",
+		},
+	},
+	{
+		// The Mint has no CO2 sensor, only the TVOC sensor's estimate.
+		Name: "mint",
+		Fields: []string{
+			"temp", "humid", "voc", "pm25", "score", "dew_point", "abs_humid",
+			"co2_est", "co2_est_baseline", "voc_baseline", "voc_h2_raw", "voc_ethanol_raw", "pm10_est",
+		},
+	},
+	{
+		// The Glow C only has temperature and humidity sensors, and a motion
+		// sensor reporting occupancy.
+		Name:   "glow-c",
+		Fields: []string{"temp", "humid", "dew_point", "abs_humid", "occupancy"},
+	},
+}
+
+func (p deviceProfile) has(field string) bool {
+	for _, f := range p.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func findDeviceProfile(name string) (deviceProfile, bool) {
+	for _, profile := range deviceProfiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return deviceProfile{}, false
+}
+
+func validateDeviceProfile(name string) error {
+	if name == profileAuto {
+		return nil
+	}
+	if _, ok := findDeviceProfile(name); ok {
+		return nil
+	}
+
+	names := []string{profileAuto}
+	for _, profile := range deviceProfiles {
+		names = append(names, profile.Name)
+	}
+	return fmt.Errorf("invalid device profile %q, must be one of %s", name, strings.Join(names, ", "))
+}
+
+// climateGaugeForField returns the gauge populated from a payload field.
+func (app *App) climateGaugeForField(field string) *prometheus.GaugeVec {
+	switch field {
+	case "temp":
+		return app.TempGauge
+	case "humid":
+		return app.HumidityGauge
+	case "co2":
+		return app.Co2Gauge
+	case "voc":
+		return app.VOCGauge
+	case "pm25":
+		return app.PM25Gauge
+	case "score":
+		return app.ScoreGauge
+	case "dew_point":
+		return app.DewPointGauge
+	case "abs_humid":
+		return app.AbsoluteHumidityGauge
+	case "co2_est":
+		return app.Co2EstimateGauge
+	case "co2_est_baseline":
+		return app.Co2EstimateBaselinesGauge
+	case "voc_baseline":
+		return app.VOCBaselineGauge
+	case "voc_h2_raw":
+		return app.VOCH2RawGauge
+	case "voc_ethanol_raw":
+		return app.VocEthanolRawGauge
+	case "pm10_est":
+		return app.Pm10EstimateGauge
+	case "lux":
+		return app.IlluminanceGauge
+	case "spl_a":
+		return app.SoundLevelGauge
+	case "occupancy":
+		return app.OccupancyGauge
+	case "temp_f":
+		return app.TempFahrenheitGauge
+	case "dew_point_f":
+		return app.DewPointFahrenheitGauge
+	case "heat_index":
+		return app.HeatIndexGauge
+	case "heat_index_f":
+		return app.HeatIndexFahrenheitGauge
+	case "humidex":
+		return app.HumidexGauge
+	case "wet_bulb":
+		return app.WetBulbGauge
+	case "wet_bulb_f":
+		return app.WetBulbFahrenheitGauge
+	default:
+		panic(fmt.Sprintf("no climate gauge for field %q", field))
+	}
+}
+
+// fieldValue returns the value of a payload field from a reading.
+func fieldValue(stats AwairStats, field string) float64 {
+	switch field {
+	case "temp_f":
+		return celsiusToFahrenheit(stats.Temp)
+	case "dew_point_f":
+		return celsiusToFahrenheit(stats.DewPoint)
+	case "heat_index":
+		return heatIndex(stats.Temp, stats.Humid)
+	case "heat_index_f":
+		return celsiusToFahrenheit(heatIndex(stats.Temp, stats.Humid))
+	case "humidex":
+		return humidex(stats.Temp, stats.Humid)
+	case "wet_bulb":
+		return wetBulb(stats.Temp, stats.Humid)
+	case "wet_bulb_f":
+		return celsiusToFahrenheit(wetBulb(stats.Temp, stats.Humid))
+	}
+	if !knownFields.has(field) {
+		panic(fmt.Sprintf("unknown payload field %q", field))
+	}
+	value, _ := stats.Value(field)
+	return value
+}
+
+// hasField reports whether the reading has a payload field, or the fields
+// a derived series is computed from. A Mint omits co2, and odd firmware
+// may omit more, which must not be exported as zeros. Readings not decoded
+// from a payload have every field.
+func hasField(stats AwairStats, field string) bool {
+	switch field {
+	case "temp_f":
+		return stats.Has("temp")
+	case "dew_point_f":
+		return stats.Has("dew_point")
+	case "heat_index", "heat_index_f", "humidex", "wet_bulb", "wet_bulb_f":
+		return stats.Has("temp") && stats.Has("humid")
+	}
+	return stats.Has(field)
+}
+
+// setClimateGauges sets the device's climate gauges from a reading,
+// removing the series of the fields the reading lacks rather than leaving
+// their last value.
+func (app *App) setClimateGauges(device *Device, stats AwairStats) {
+	for _, field := range app.climateFields(device.Profile) {
+		if hasField(stats, field) {
+			app.climateGaugeForField(field).With(device.Labels).Set(fieldValue(stats, field))
+		} else {
+			app.climateGaugeForField(field).Delete(device.Labels)
+		}
+	}
+}
+
+// validateForceSensors checks that every forced sensor is a known payload
+// field.
+func validateForceSensors(fields []string) error {
+	for _, field := range fields {
+		if !knownFields.has(field) {
+			return fmt.Errorf("invalid sensor %q, must be one of %s", field, strings.Join(knownFields.Fields, ", "))
+		}
+	}
+	return nil
+}
+
+// initializeProfile applies --force-sensors or the configured device
+// profile. With the auto profile no climate gauges are exported until the
+// first payload shows which sensors the device has.
+func (app *App) initializeProfile(device *Device) {
+	device.Profile = deviceProfile{}
+	switch {
+	case len(app.ForceSensors) > 0:
+		device.Profile = deviceProfile{Name: "forced", Fields: app.ForceSensors}
+	case app.DeviceProfile != profileAuto:
+		device.Profile, _ = findDeviceProfile(app.DeviceProfile)
+	default:
+		return
+	}
+	device.profileDetected = true
+}
+
+// detectProfile picks the richest profile whose fields are all present in
+// the payload. It only runs once, on the first successful poll.
+func (app *App) detectProfile(device *Device, body []byte) error {
+	if device.profileDetected {
+		return nil
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+
+	// The cloud API only reports the sensors a device has, but not the
+	// local-only fields the profiles are told apart by.
+	if device.Cloud {
+		profile := presentFieldsProfile("cloud", fields)
+		app.setProfile(device, profile)
+		device.profileDetected = true
+		app.Logger.Info("Detected device profile", zap.String("device", device.Name), zap.String("profile", profile.Name), zap.Strings("fields", profile.Fields))
+		return nil
+	}
+
+	profile, known := matchProfile(fields)
+	app.setProfile(device, profile)
+	device.profileDetected = true
+	if known {
+		app.Logger.Info("Detected device profile", zap.String("device", device.Name), zap.String("profile", profile.Name))
+	} else {
+		app.Logger.Warn("Device payload does not match a known profile, exporting the fields present", zap.String("device", device.Name), zap.Strings("fields", profile.Fields))
+	}
+	return nil
+}
+
+// matchProfile returns the richest profile whose fields the payload has, or
+// a profile of the known fields present when none matches.
+func matchProfile(fields map[string]json.RawMessage) (profile deviceProfile, known bool) {
+	for _, profile := range deviceProfiles {
+		if hasFields(fields, profile.Fields) {
+			return profile, true
+		}
+	}
+	return presentFieldsProfile("custom", fields), false
+}
+
+func hasFields(fields map[string]json.RawMessage, names []string) bool {
+	for _, name := range names {
+		if _, ok := fields[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// currentProfile returns the device profile outside of a poll, waiting for
+// any poll in flight that may be switching it until ctx is done.
+func currentProfile(ctx context.Context, device *Device) (deviceProfile, error) {
+	select {
+	case device.pollLock <- struct{}{}:
+	case <-ctx.Done():
+		return deviceProfile{}, ctx.Err()
+	}
+	defer func() { <-device.pollLock }()
+
+	return device.Profile, nil
+}
+
+// setProfile switches the device profile, removing the climate series it
+// does not report.
+func (app *App) setProfile(device *Device, profile deviceProfile) {
+	exported := deviceProfile{Fields: app.climateFields(profile)}
+	for _, field := range app.climateFields(device.Profile) {
+		if !exported.has(field) {
+			app.climateGaugeForField(field).Delete(device.Labels)
+		}
+	}
+
+	device.Profile = profile
+}
+
+// presentFieldsProfile returns a profile of the known fields in the payload.
+func presentFieldsProfile(name string, fields map[string]json.RawMessage) deviceProfile {
+	profile := deviceProfile{Name: name}
+	for _, field := range knownFields.Fields {
+		if _, ok := fields[field]; ok {
+			profile.Fields = append(profile.Fields, field)
+		}
+	}
+	return profile
+}
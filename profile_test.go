@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAwairStatsHasField(t *testing.T) {
+	stats := AwairStats{}
+	// A Mint payload, without co2, and odd firmware sending a null humidity.
+	if err := json.Unmarshal([]byte(`{"temp":21.5,"humid":null,"voc":0,"dew_point":7.4}`), &stats); err != nil {
+		t.Fatal(err)
+	}
+	for field, want := range map[string]bool{
+		"temp":        true,
+		"voc":         true,
+		"co2":         false,
+		"humid":       false,
+		"temp_f":      true,
+		"dew_point_f": true,
+		"heat_index":  false,
+	} {
+		if got := hasField(stats, field); got != want {
+			t.Errorf("hasField(%q) = %v, want %v", field, got, want)
+		}
+	}
+
+	if !hasField(AwairStats{}, "co2") {
+		t.Error("hasField(co2) of a reading not decoded from a payload = false, want true")
+	}
+}
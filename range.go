@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+const (
+	// rangePolicyDrop leaves out of range readings out of the reading, as if
+	// the device had not sent them.
+	rangePolicyDrop = "drop"
+	// rangePolicyClamp exports out of range readings as the nearest bound.
+	rangePolicyClamp = "clamp"
+	// rangePolicyKeep exports out of range readings unchanged, only counting
+	// them.
+	rangePolicyKeep = "keep"
+)
+
+func validateRangePolicy(policy string) error {
+	switch policy {
+	case rangePolicyDrop, rangePolicyClamp, rangePolicyKeep:
+		return nil
+	default:
+		return fmt.Errorf("invalid range policy %q, must be one of %s, %s or %s", policy, rangePolicyDrop, rangePolicyClamp, rangePolicyKeep)
+	}
+}
+
+type sensorRange struct {
+	min float64
+	max float64
+}
+
+// sensorRanges are the physically plausible readings of the sensors, well
+// beyond what the devices are rated for. Readings outside them come from
+// failing hardware or corrupted payloads. The unitless baselines and raw
+// gas signals have no meaningful range.
+var sensorRanges = map[string]sensorRange{
+	"temp":      {-40, 80},
+	"humid":     {0, 100},
+	"co2":       {0, 10000},
+	"voc":       {0, 60000},
+	"pm25":      {0, 1000},
+	"pm10_est":  {0, 1000},
+	"score":     {0, 100},
+	"dew_point": {-60, 80},
+	"abs_humid": {0, 300},
+	"lux":       {0, 100000},
+	"spl_a":     {0, 140},
+	"occupancy": {0, 1},
+}
+
+// clamp returns the nearest value in the range, and whether value was in
+// it.
+func (r sensorRange) clamp(value float64) (float64, bool) {
+	if value < r.min {
+		return r.min, false
+	}
+	if value > r.max {
+		return r.max, false
+	}
+	return value, true
+}
+
+func (app *App) initializeRangeMetrics() {
+	app.RangeViolationsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "exporter",
+		Name:      "range_violations_total",
+		Help:      "Number of readings of the sensor outside its plausible physical range, a sign of failing hardware",
+	}, append(app.deviceLabelNames(), "sensor"))
+}
+
+func rangeLabels(device *Device, sensor string) prometheus.Labels {
+	labels := prometheus.Labels{"sensor": sensor}
+	for name, value := range device.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// checkRanges counts the readings outside their sensor's range, dropping
+// or clamping them as --range-policy says. Samples the device repeats until
+// its next one are counted once.
+func (app *App) checkRanges(device *Device, stats AwairStats) AwairStats {
+	repeated := app.isDuplicateSample(device, stats)
+	for field, r := range sensorRanges {
+		if !hasField(stats, field) {
+			continue
+		}
+		// Export the counter at zero from the sensor's first reading.
+		counter := app.RangeViolationsCounter.With(rangeLabels(device, field))
+		value := fieldValue(stats, field)
+		clamped, ok := r.clamp(value)
+		if ok {
+			continue
+		}
+		if !repeated {
+			counter.Inc()
+		}
+		app.Logger.Debug("Device reading out of range", zap.String("device", device.Name), zap.String("sensor", field), zap.Float64("value", value), zap.String("policy", app.RangePolicy))
+		switch app.RangePolicy {
+		case rangePolicyDrop:
+			stats.Drop(field)
+		case rangePolicyClamp:
+			stats.SetValue(field, clamped)
+		}
+	}
+	return stats
+}
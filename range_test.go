@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestValidateRangePolicy(t *testing.T) {
+	for _, policy := range []string{"drop", "clamp", "keep"} {
+		if err := validateRangePolicy(policy); err != nil {
+			t.Errorf("validateRangePolicy(%q) = %v", policy, err)
+		}
+	}
+	if err := validateRangePolicy("ignore"); err == nil {
+		t.Error("validateRangePolicy(\"ignore\") = nil, want error")
+	}
+}
+
+func TestCheckRanges(t *testing.T) {
+	tests := []struct {
+		policy    string
+		wantHas   bool
+		wantHumid float64
+	}{
+		{rangePolicyDrop, false, 0},
+		{rangePolicyClamp, true, 100},
+		{rangePolicyKeep, true, 180},
+	}
+	for _, tt := range tests {
+		app := &App{
+			Logger:                 zap.NewNop(),
+			RangePolicy:            tt.policy,
+			RangeViolationsCounter: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "range_violations_total"}, []string{"device", "sensor"}),
+		}
+		device := newDevice("office", "http://office")
+		device.Labels = prometheus.Labels{"device": "office"}
+
+		got := app.checkRanges(device, AwairStats{Temp: 21.5, Humid: 180, Co2: 600})
+		if hasField(got, "humid") != tt.wantHas || (tt.wantHas && got.Humid != tt.wantHumid) || got.Temp != 21.5 {
+			t.Errorf("%s: checkRanges() = humid %v, has humid %v, temp %v, want %v, %v, 21.5", tt.policy, got.Humid, hasField(got, "humid"), got.Temp, tt.wantHumid, tt.wantHas)
+		}
+
+		if v := testutil.ToFloat64(app.RangeViolationsCounter.With(rangeLabels(device, "humid"))); v != 1 {
+			t.Errorf("%s: humid violations = %v, want 1", tt.policy, v)
+		}
+		if v := testutil.ToFloat64(app.RangeViolationsCounter.With(rangeLabels(device, "co2"))); v != 0 {
+			t.Errorf("%s: co2 violations = %v, want 0", tt.policy, v)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// rateSensors are the payload fields exported with their rate of change.
+var rateSensors = []string{"co2", "pm25"}
+
+// RateTracker keeps the previous sample of each rate sensor.
+type RateTracker struct {
+	mu   sync.Mutex
+	last map[string]rollingSample
+}
+
+// rate records a sample and returns the change per minute since the
+// previous one, and false for the first sample or a repeat of the previous
+// sample.
+func (r *RateTracker) rate(field string, t time.Time, value float64) (float64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last == nil {
+		r.last = map[string]rollingSample{}
+	}
+
+	previous, ok := r.last[field]
+	if ok && !t.After(previous.time) {
+		return 0, false
+	}
+	r.last[field] = rollingSample{time: t, value: value}
+	if !ok {
+		return 0, false
+	}
+
+	return (value - previous.value) / t.Sub(previous.time).Minutes(), true
+}
+
+func (app *App) initializeRateMetrics() {
+	app.RateGauges = map[string]*prometheus.GaugeVec{}
+	for _, field := range rateSensors {
+		app.RateGauges[field] = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: app.metricNamespace(),
+			Subsystem: app.MetricSubsystem,
+			Name:      climateMetricNames[field] + "_rate_per_min",
+			Help:      "Change of the " + field + " reading per minute between the last two samples",
+		}, app.deviceLabelNames())
+	}
+}
+
+// recordRates refreshes the rate of change metrics from a reading. Readings
+// without a device timestamp are timed by when they were polled.
+func (app *App) recordRates(device *Device, stats AwairStats) {
+	for field, gauge := range app.RateGauges {
+		if !device.Profile.has(field) || !hasField(stats, field) {
+			continue
+		}
+		if rate, ok := device.Rates.rate(field, readingTime(stats), fieldValue(stats, field)); ok {
+			gauge.With(device.Labels).Set(rate)
+		}
+	}
+}
+
+func (app *App) deleteRates(device *Device) {
+	for _, gauge := range app.RateGauges {
+		gauge.Delete(device.Labels)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// initializeRawMetrics registers the _raw gauges of the payload fields that
+// calibration, smoothing or spike rejection may change. The calibration
+// sensors are registered even without a calibration, which a reload or a
+// calibrate run can add.
+func (app *App) initializeRawMetrics() {
+	fields := map[string]bool{"dew_point": true}
+	for _, field := range calibrationSensors {
+		fields[field] = true
+	}
+	for field := range app.SmoothingAlphas {
+		fields[field] = true
+	}
+	for field := range app.SpikeLimits {
+		fields[field] = true
+	}
+
+	app.RawGauges = map[string]*prometheus.GaugeVec{}
+	for field := range fields {
+		app.RawGauges[field] = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: app.metricNamespace(),
+			Subsystem: app.MetricSubsystem,
+			Name:      climateMetricNames[field] + "_raw",
+			Help:      "The " + field + " reading as sent by the device, before calibration, smoothing and spike rejection",
+		}, app.deviceLabelNames())
+	}
+}
+
+// correctedFields returns the payload fields of the device's readings that
+// are changed before being exported. The dew point is recomputed from a
+// calibrated temperature or humidity.
+func (app *App) correctedFields(device *Device) map[string]bool {
+	fields := map[string]bool{}
+	for field := range app.SmoothingAlphas {
+		fields[field] = true
+	}
+	for field := range app.SpikeLimits {
+		fields[field] = true
+	}
+	for field := range app.deviceOffsets(device) {
+		fields[field] = true
+	}
+	for field := range app.deviceScales(device) {
+		fields[field] = true
+	}
+	if fields["temp"] || fields["humid"] {
+		fields["dew_point"] = true
+	}
+	return fields
+}
+
+// rawGauges returns the _raw gauges of the device's corrected fields that
+// its profile reports.
+func (app *App) rawGauges(device *Device) map[string]*prometheus.GaugeVec {
+	gauges := map[string]*prometheus.GaugeVec{}
+	for field := range app.correctedFields(device) {
+		if gauge, ok := app.RawGauges[field]; ok && device.Profile.has(field) {
+			gauges[field] = gauge
+		}
+	}
+	return gauges
+}
+
+// recordRawValues exports the device's values of its corrected fields, so
+// the corrections can be audited and undone in queries. The series of
+// fields no longer corrected, e.g. after a reload, are removed.
+func (app *App) recordRawValues(device *Device, raw AwairStats) {
+	gauges := app.rawGauges(device)
+	for field, gauge := range app.RawGauges {
+		if _, ok := gauges[field]; ok && hasField(raw, field) {
+			gauge.With(device.Labels).Set(fieldValue(raw, field))
+		} else {
+			gauge.Delete(device.Labels)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordRawValues(t *testing.T) {
+	app := &App{
+		SmoothingAlphas: map[string]float64{"pm25": 0.3},
+		RawGauges:       map[string]*prometheus.GaugeVec{},
+	}
+	for _, field := range []string{"temp", "humid", "dew_point", "pm25", "co2"} {
+		app.RawGauges[field] = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: field + "_raw"}, []string{"device"})
+	}
+	device := newDevice("office", "http://office")
+	device.Labels = prometheus.Labels{"device": "office"}
+	device.Profile = knownFields
+	device.Offsets = map[string]float64{"temp": -1.5}
+
+	app.recordRawValues(device, AwairStats{Temp: 21.5, Humid: 40, DewPoint: 7.3, Pm25: 12, Co2: 600})
+
+	want := map[string]float64{"temp": 21.5, "dew_point": 7.3, "pm25": 12}
+	for field, gauge := range app.RawGauges {
+		value, ok := want[field]
+		if !ok {
+			if n := testutil.CollectAndCount(gauge); n != 0 {
+				t.Errorf("%s_raw series = %d, want 0", field, n)
+			}
+			continue
+		}
+		if got := testutil.ToFloat64(gauge.With(device.Labels)); got != value {
+			t.Errorf("%s_raw = %v, want %v", field, got, value)
+		}
+	}
+
+	// Without the offset the temperature is no longer corrected.
+	device.Offsets = nil
+	app.recordRawValues(device, AwairStats{Temp: 21.5, Pm25: 12})
+	if n := testutil.CollectAndCount(app.RawGauges["temp"]); n != 0 {
+		t.Errorf("temp_raw series after removing the offset = %d, want 0", n)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// handleReloads reloads the config file on every signal received on hup.
+func (app *App) handleReloads(ctx context.Context, hup <-chan os.Signal) {
+	for {
+		select {
+		case <-hup:
+			if err := app.reloadConfig(ctx); err != nil {
+				app.Logger.Error("Failed to reload configuration", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reloadHandler reloads the config file on POST /-/reload, answering with
+// the error when the new config is rejected. Like Prometheus it is disabled
+// unless --web.enable-lifecycle is set, and like every other endpoint it
+// requires the basic auth users of --web.config.file when set.
+func (app *App) reloadHandler(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.EnableLifecycle {
+			http.Error(w, "lifecycle API is not enabled, see --web.enable-lifecycle", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := app.reloadConfig(ctx); err != nil {
+			app.Logger.Error("Failed to reload configuration", zap.Error(err))
+			http.Error(w, "failed to reload configuration: "+err.Error(), http.StatusBadRequest)
+		}
+	}
+}
+
+// reloadConfig re-reads --config, starting and stopping device pollers to
+// match its device list and applying poll frequency changes. Other options
+// only take effect on restart.
+func (app *App) reloadConfig(ctx context.Context) error {
+	app.reloadMu.Lock()
+	defer app.reloadMu.Unlock()
+
+	if app.ConfigFile == "" {
+		return errors.New("no --config file to reload")
+	}
+
+	config, err := loadConfig(app.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	// Validate everything before applying anything, with the same checks
+	// as on startup.
+	reloadFrequency := config.PollFrequency != nil && !pflag.CommandLine.Changed("poll-frequency")
+	if reloadFrequency {
+		if err := validatePollFrequency(*config.PollFrequency); err != nil {
+			return err
+		}
+	}
+
+	var devices []*Device
+	if app.devicesFromConfig {
+		devices, err = configDevices(config.Devices)
+		if err != nil {
+			return err
+		}
+		if names := app.extraLabelNames(devices); !reflect.DeepEqual(names, app.ExtraLabelNames) {
+			return errors.New("device label names changed, restart the exporter to apply them")
+		}
+	}
+
+	if reloadFrequency {
+		app.devicesMu.Lock()
+		app.TimeBetweenChecks = *config.PollFrequency
+		app.devicesMu.Unlock()
+	}
+
+	if app.devicesFromConfig {
+		app.reconcileDevices(ctx, devices)
+	}
+
+	app.Logger.Info("Reloaded configuration", zap.String("config", app.ConfigFile))
+	return nil
+}
+
+// reconcileDevices stops configured devices that are gone or whose address
+// or labels changed, starts new ones, and updates poll frequencies and
+// calibrations in place.
+// Discovered devices are left alone.
+func (app *App) reconcileDevices(ctx context.Context, devices []*Device) {
+	wanted := map[string]*Device{}
+	for _, device := range devices {
+		wanted[device.Name] = device
+	}
+
+	running := map[string]bool{}
+	for _, current := range app.devices() {
+		if current.Discovered {
+			running[current.Name] = true
+			continue
+		}
+
+		// The labels of a running device change once its UUID is fetched.
+		app.devicesMu.RLock()
+		labels := current.Labels
+		app.devicesMu.RUnlock()
+
+		next, ok := wanted[current.Name]
+		if !ok || next.Address != current.Address || !reflect.DeepEqual(app.reloadedLabels(next, current), labels) {
+			app.stopDevice(current)
+			app.Logger.Info("Stopped polling device", zap.String("device", current.Name))
+			continue
+		}
+
+		running[current.Name] = true
+		app.devicesMu.Lock()
+		current.PollFrequency = next.PollFrequency
+		current.Offsets = next.Offsets
+		current.Scales = next.Scales
+		app.devicesMu.Unlock()
+		app.recordCalibrationMetrics(current)
+	}
+
+	for _, device := range devices {
+		if running[device.Name] {
+			continue
+		}
+		app.startDevice(ctx, device)
+		app.Logger.Info("Started polling device", zap.String("device", device.Name), zap.String("awair_address", device.Address))
+	}
+}
+
+// reloadedLabels returns the labels of a device from the reloaded config,
+// keeping the UUID of the running device for --uuid-label.
+func (app *App) reloadedLabels(next, current *Device) prometheus.Labels {
+	next.uuid.Store(current.UUID())
+	return app.deviceLabels(next)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestConfig writes a config file to path.
+func writeTestConfig(t *testing.T, path, config string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newReloadTestApp returns an App reloading its devices from a config file
+// at path, stopping them when the test ends.
+func newReloadTestApp(t *testing.T, path string) *App {
+	t.Helper()
+
+	app := newTestApp(t, "--scrape-on-collect")
+	app.ConfigFile = path
+	app.devicesFromConfig = true
+	app.ExtraLabelNames = app.extraLabelNames(nil)
+	t.Cleanup(func() {
+		for _, device := range app.devices() {
+			app.stopDevice(device)
+		}
+	})
+	return app
+}
+
+func deviceNames(app *App) []string {
+	var names []string
+	for _, device := range app.devices() {
+		names = append(names, device.Name)
+	}
+	return names
+}
+
+func TestReloadConfig(t *testing.T) {
+	office, kitchen := newFakeDevice(t), newFakeDevice(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, path, `
+devices:
+  - name: office
+    address: `+office.address()+`
+  - name: kitchen
+    address: `+kitchen.address()+`
+`)
+	app := newReloadTestApp(t, path)
+	ctx := context.Background()
+
+	if err := app.reloadConfig(ctx); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+	if got := deviceNames(app); len(got) != 2 {
+		t.Fatalf("devices after the first reload = %v, want [office kitchen]", got)
+	}
+	running := app.devices()[0]
+
+	writeTestConfig(t, path, `
+poll_frequency: 30s
+devices:
+  - name: office
+    address: `+office.address()+`
+    poll_frequency: 2m
+`)
+	if err := app.reloadConfig(ctx); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+
+	devices := app.devices()
+	if len(devices) != 1 || devices[0] != running {
+		t.Fatalf("devices after removing kitchen = %v, want the running office", deviceNames(app))
+	}
+	if got := devices[0].PollFrequency; got != 2*time.Minute {
+		t.Errorf("office poll frequency = %v, want 2m", got)
+	}
+	if app.TimeBetweenChecks != 30*time.Second {
+		t.Errorf("poll frequency = %s, want 30s", app.TimeBetweenChecks)
+	}
+}
+
+func TestReloadConfigInvalid(t *testing.T) {
+	office := newFakeDevice(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, path, `
+devices:
+  - name: office
+    address: `+office.address()+`
+`)
+	app := newReloadTestApp(t, path)
+	ctx := context.Background()
+	if err := app.reloadConfig(ctx); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+	frequency := app.TimeBetweenChecks
+
+	for name, config := range map[string]string{
+		"zero poll frequency": `
+poll_frequency: 0s
+devices:
+  - name: kitchen
+    address: http://kitchen/air-data/latest
+`,
+		"new label name": `
+devices:
+  - name: kitchen
+    address: http://kitchen/air-data/latest
+    labels:
+      floor: "1"
+`,
+		"malformed": "devices: [",
+	} {
+		t.Run(name, func(t *testing.T) {
+			writeTestConfig(t, path, config)
+			if err := app.reloadConfig(ctx); err == nil {
+				t.Fatal("reloadConfig() succeeded")
+			}
+			if got := deviceNames(app); len(got) != 1 || got[0] != "office" {
+				t.Errorf("devices after a rejected reload = %v, want [office]", got)
+			}
+			if app.TimeBetweenChecks != frequency {
+				t.Errorf("poll frequency after a rejected reload = %s, want %s", app.TimeBetweenChecks, frequency)
+			}
+		})
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	office := newFakeDevice(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, path, `
+devices:
+  - name: office
+    address: `+office.address()+`
+`)
+
+	tests := []struct {
+		name       string
+		lifecycle  bool
+		method     string
+		config     string
+		wantStatus int
+	}{
+		{"lifecycle disabled", false, http.MethodPost, path, http.StatusForbidden},
+		{"get", true, http.MethodGet, path, http.StatusMethodNotAllowed},
+		{"reloaded", true, http.MethodPost, path, http.StatusOK},
+		{"no config file", true, http.MethodPost, "", http.StatusBadRequest},
+		{"missing config file", true, http.MethodPost, path + ".missing", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newReloadTestApp(t, tt.config)
+			app.EnableLifecycle = tt.lifecycle
+
+			rec := httptest.NewRecorder()
+			app.reloadHandler(context.Background())(rec, httptest.NewRequest(tt.method, "/-/reload", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			wantDevices := 0
+			if tt.wantStatus == http.StatusOK {
+				wantDevices = 1
+			}
+			if got := len(app.devices()); got != wantDevices {
+				t.Errorf("devices = %d, want %d", got, wantDevices)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// reportDays is how many days of summaries are kept for the weekly
+	// report.
+	reportDays = 7
+	// reportDayEvents is how many threshold events of a day are listed.
+	reportDayEvents = 50
+)
+
+// reportSensor is a reading summarised in the reports. Time above Threshold
+// is reported when it is non-zero.
+type reportSensor struct {
+	Field     string
+	Label     string
+	Unit      string
+	Threshold float64
+}
+
+var reportSensors = []reportSensor{
+	{Field: "score", Label: "Awair Score"},
+	{Field: "temp", Label: "Temperature", Unit: "ºC"},
+	{Field: "humid", Label: "Relative Humidity", Unit: "%"},
+	{Field: "co2", Label: "CO₂", Unit: "ppm", Threshold: 1000},
+	{Field: "voc", Label: "TVOC", Unit: "ppb", Threshold: 1000},
+	{Field: "pm25", Label: "PM2.5", Unit: "µg/m³", Threshold: 35},
+}
+
+// sensorSummary aggregates the readings of one sensor.
+type sensorSummary struct {
+	Min, Max, Sum float64
+	Count         int
+	Above         time.Duration
+}
+
+func (s *sensorSummary) add(value float64, threshold float64, weight time.Duration) {
+	if s.Count == 0 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 0 || value > s.Max {
+		s.Max = value
+	}
+	s.Sum += value
+	s.Count++
+	if threshold > 0 && value > threshold {
+		s.Above += weight
+	}
+}
+
+func (s *sensorSummary) merge(other sensorSummary) {
+	if other.Count == 0 {
+		return
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Sum += other.Sum
+	s.Count += other.Count
+	s.Above += other.Above
+}
+
+// daySummary aggregates every reading taken on one day.
+type daySummary struct {
+	Day     time.Time
+	Sensors map[string]*sensorSummary
+	// AQI is the time spent in each of the aqiCategories, from the PM2.5
+	// AQI of each reading.
+	AQI []time.Duration
+	// Events are the day's first threshold crossings, followed by the
+	// count of those not kept.
+	Events        []ThresholdEvent
+	DroppedEvents int
+}
+
+// day returns the summary of a day, adding it in order. h.mu must be held.
+func (h *ReportHistory) day(day time.Time) *daySummary {
+	// A backfilled reading may belong to a day before the latest one.
+	i := sort.Search(len(h.days), func(i int) bool { return !h.days[i].Day.Before(day) })
+	if i == len(h.days) || !h.days[i].Day.Equal(day) {
+		h.days = append(h.days, nil)
+		copy(h.days[i+1:], h.days[i:])
+		h.days[i] = &daySummary{Day: day, Sensors: map[string]*sensorSummary{}, AQI: make([]time.Duration, len(aqiCategories))}
+	}
+	summary := h.days[i]
+	if excess := len(h.days) - reportDays; excess > 0 {
+		h.days = h.days[excess:]
+	}
+	return summary
+}
+
+// reportDay returns the midnight in --timezone starting the day of t.
+func (app *App) reportDay(t time.Time) time.Time {
+	t = t.In(app.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, app.Location)
+}
+
+// ReportHistory keeps per-day summaries for the reports.
+type ReportHistory struct {
+	mu   sync.Mutex
+	days []*daySummary
+}
+
+// recordReport adds a reading to the summary of the day it was taken on in
+// --timezone. Each reading accounts for one poll interval of time above
+// thresholds and in its AQI category.
+func (app *App) recordReport(device *Device, stats AwairStats) {
+	h := &device.Reports
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	current := h.day(app.reportDay(readingTime(stats)))
+	weight := app.pollFrequency(device)
+
+	for _, sensor := range reportSensors {
+		if !device.Profile.has(sensor.Field) || !hasField(stats, sensor.Field) {
+			continue
+		}
+		summary, ok := current.Sensors[sensor.Field]
+		if !ok {
+			summary = &sensorSummary{}
+			current.Sensors[sensor.Field] = summary
+		}
+		summary.add(fieldValue(stats, sensor.Field), sensor.Threshold, weight)
+	}
+
+	if device.Profile.has("pm25") && hasField(stats, "pm25") {
+		current.AQI[aqiCategoryIndex(pm25AQI(float64(stats.Pm25)))] += weight
+	}
+}
+
+// recordReportEvent adds a threshold crossing to the summary of the day it
+// happened on in --timezone.
+func (app *App) recordReportEvent(device *Device, event ThresholdEvent) {
+	h := &device.Reports
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	day := h.day(app.reportDay(event.Time))
+	if len(day.Events) >= reportDayEvents {
+		day.DroppedEvents++
+		return
+	}
+	event.Time = event.Time.In(app.Location)
+	day.Events = append(day.Events, event)
+}
+
+type reportRow struct {
+	Label, Unit   string
+	Min, Max, Avg float64
+	HasThreshold  bool
+	Threshold     float64
+	Above         time.Duration
+}
+
+type reportAQIRow struct {
+	Category string
+	Time     time.Duration
+	Percent  float64
+}
+
+type reportSection struct {
+	Title string
+	Rows  []reportRow
+	AQI   []reportAQIRow
+	// Events are the threshold crossings of a day, oldest first.
+	Events        []ThresholdEvent
+	DroppedEvents int
+}
+
+type reportDevice struct {
+	Name, Address string
+	Sections      []reportSection
+}
+
+type reportPage struct {
+	Generated time.Time
+	Devices   []reportDevice
+}
+
+func reportRows(sensors map[string]*sensorSummary) []reportRow {
+	rows := []reportRow{}
+	for _, sensor := range reportSensors {
+		summary, ok := sensors[sensor.Field]
+		if !ok || summary.Count == 0 {
+			continue
+		}
+		rows = append(rows, reportRow{
+			Label:        sensor.Label,
+			Unit:         sensor.Unit,
+			Min:          summary.Min,
+			Max:          summary.Max,
+			Avg:          summary.Sum / float64(summary.Count),
+			HasThreshold: sensor.Threshold > 0,
+			Threshold:    sensor.Threshold,
+			Above:        summary.Above.Round(time.Minute),
+		})
+	}
+	return rows
+}
+
+// reportAQIRows returns the time spent in each AQI category with any, or
+// nil without a PM2.5 reading.
+func reportAQIRows(times []time.Duration) []reportAQIRow {
+	var total time.Duration
+	for _, t := range times {
+		total += t
+	}
+	if total == 0 {
+		return nil
+	}
+
+	rows := []reportAQIRow{}
+	for i, t := range times {
+		if t == 0 {
+			continue
+		}
+		rows = append(rows, reportAQIRow{
+			Category: aqiCategories[i].Name,
+			Time:     t.Round(time.Minute),
+			Percent:  100 * t.Seconds() / total.Seconds(),
+		})
+	}
+	return rows
+}
+
+// reportForDevice builds the weekly summary of a device followed by one
+// section per day, newest first.
+func reportForDevice(device *Device) reportDevice {
+	h := &device.Reports
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	report := reportDevice{Name: device.Name, Address: device.Address}
+	if len(h.days) == 0 {
+		return report
+	}
+
+	week := map[string]*sensorSummary{}
+	weekAQI := make([]time.Duration, len(aqiCategories))
+	for _, day := range h.days {
+		for field, summary := range day.Sensors {
+			if _, ok := week[field]; !ok {
+				week[field] = &sensorSummary{}
+			}
+			week[field].merge(*summary)
+		}
+		for i, t := range day.AQI {
+			weekAQI[i] += t
+		}
+	}
+	report.Sections = append(report.Sections, reportSection{
+		Title: "Week from " + h.days[0].Day.Format("Mon 2 Jan 2006"),
+		Rows:  reportRows(week),
+		AQI:   reportAQIRows(weekAQI),
+	})
+
+	for i := len(h.days) - 1; i >= 0; i-- {
+		report.Sections = append(report.Sections, reportSection{
+			Title:         h.days[i].Day.Format("Mon 2 Jan 2006"),
+			Rows:          reportRows(h.days[i].Sensors),
+			AQI:           reportAQIRows(h.days[i].AQI),
+			Events:        append([]ThresholdEvent(nil), h.days[i].Events...),
+			DroppedEvents: h.days[i].DroppedEvents,
+		})
+	}
+
+	return report
+}
+
+func (app *App) reportPage() reportPage {
+	page := reportPage{Generated: time.Now()}
+	for _, device := range app.devices() {
+		page.Devices = append(page.Devices, reportForDevice(device))
+	}
+	return page
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Air quality report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>Air quality report</h1>
+<p>Generated {{.Generated.Format "2006-01-02 15:04 MST"}}.</p>
+{{range .Devices}}
+<h2>{{.Name}}</h2>
+<p>{{.Address}}</p>
+{{range .Sections}}
+<h3>{{.Title}}</h3>
+<table>
+<tr><th>Sensor</th><th>Min</th><th>Avg</th><th>Max</th><th>Time above threshold</th></tr>
+{{range .Rows}}<tr><td>{{.Label}}{{if .Unit}} ({{.Unit}}){{end}}</td><td>{{printf "%.1f" .Min}}</td><td>{{printf "%.1f" .Avg}}</td><td>{{printf "%.1f" .Max}}</td><td>{{if .HasThreshold}}{{.Above}} above {{.Threshold}}{{end}}</td></tr>
+{{end}}</table>
+{{if .AQI}}<table>
+<tr><th>PM2.5 AQI</th><th>Time</th><th>Share</th></tr>
+{{range .AQI}}<tr><td>{{.Category}}</td><td>{{.Time}}</td><td>{{printf "%.0f" .Percent}}%</td></tr>
+{{end}}</table>
+{{end}}{{if .Events}}<p>Threshold alerts:</p>
+<ul>
+{{range .Events}}<li>{{.Time.Format "15:04"}} {{.Sensor}} {{.Threshold}} {{if .Breached}}breached{{else}}recovered{{end}} at {{printf "%.1f" .Value}}</li>
+{{end}}{{if .DroppedEvents}}<li>{{.DroppedEvents}} more</li>
+{{end}}</ul>
+{{end}}{{else}}
+<p>No readings yet.</p>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func (app *App) reportsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path != "/reports/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := reportTemplate.Execute(w, app.reportPage()); err != nil {
+		app.Logger.Error("Error writing report", zap.Error(err))
+	}
+}
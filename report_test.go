@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestReportForDevice(t *testing.T) {
+	app := &App{Location: time.UTC, TimeBetweenChecks: time.Minute}
+	device := newDevice("office", "http://office")
+	device.Labels = prometheus.Labels{"device": "office"}
+	device.Profile = knownFields
+
+	start := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	for i, pm25 := range []int{5, 5, 5, 40} {
+		app.recordReport(device, AwairStats{Timestamp: start.Add(time.Duration(i) * time.Minute), Pm25: pm25, Co2: 600})
+	}
+	app.recordReportEvent(device, ThresholdEvent{Sensor: "pm25", Threshold: ">35", Value: 40, Breached: true, Time: start.Add(3 * time.Minute)})
+	// A backfilled reading of the day before.
+	app.recordReport(device, AwairStats{Timestamp: start.Add(-24 * time.Hour), Pm25: 5})
+
+	report := reportForDevice(device)
+	if len(report.Sections) != 3 {
+		t.Fatalf("report has %d sections, want the week and two days", len(report.Sections))
+	}
+
+	week, today, yesterday := report.Sections[0], report.Sections[1], report.Sections[2]
+	if !strings.HasPrefix(yesterday.Title, "Mon 1 Jan") || !strings.HasPrefix(today.Title, "Tue 2 Jan") {
+		t.Errorf("day sections = %q, %q, want newest first", today.Title, yesterday.Title)
+	}
+	want := []reportAQIRow{{"Good", 3 * time.Minute, 75}, {"Unhealthy for Sensitive Groups", time.Minute, 25}}
+	if len(today.AQI) != len(want) || today.AQI[0] != want[0] || today.AQI[1] != want[1] {
+		t.Errorf("AQI of the day = %+v, want %+v", today.AQI, want)
+	}
+	if len(week.AQI) != 2 || week.AQI[0].Time != 4*time.Minute {
+		t.Errorf("AQI of the week = %+v, want 4m Good and 1m Unhealthy for Sensitive Groups", week.AQI)
+	}
+	if len(today.Events) != 1 || !today.Events[0].Breached || len(yesterday.Events) != 0 {
+		t.Errorf("events = %+v and %+v, want the breach on the second day", today.Events, yesterday.Events)
+	}
+
+	var page strings.Builder
+	if err := reportTemplate.Execute(&page, reportPage{Devices: []reportDevice{report}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Unhealthy for Sensitive Groups", "10:03 pm25 &gt;35 breached at 40.0"} {
+		if !strings.Contains(page.String(), s) {
+			t.Errorf("report page lacks %q", s)
+		}
+	}
+}
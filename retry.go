@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pollTimeout bounds a single request to the device.
+const pollTimeout = time.Second
+
+func validateRetries(attempts int, initial, max time.Duration, jitter float64) error {
+	switch {
+	case attempts < 1:
+		return errors.New("retry-attempts must be at least 1")
+	case initial <= 0 || max < initial:
+		return errors.New("retry-initial-backoff must be positive and no greater than retry-max-backoff")
+	case jitter < 0 || jitter > 1:
+		return errors.New("retry-jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// retryBackoff returns the delay before the given retry, doubling from
+// --retry-initial-backoff up to --retry-max-backoff and randomly shortened
+// by up to --retry-jitter of itself.
+func (app *App) retryBackoff(retry int) time.Duration {
+	backoff := app.RetryMaxBackoff
+	if retry < 32 && app.RetryInitialBackoff<<(retry-1) < app.RetryMaxBackoff {
+		backoff = app.RetryInitialBackoff << (retry - 1)
+	}
+	return backoff - time.Duration(rand.Float64()*app.RetryJitter*float64(backoff))
+}
+
+// permanentError marks a failed request that would fail again if retried
+// within the same poll, such as a rejected token.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// fetchWithRetries fetches a reading from the device, retrying failed
+// requests with exponential backoff unless the device's circuit breaker is
+// open or the error is permanent. Retries stop once ctx is done or the next attempt would start after
+// the next scheduled poll.
+func (app *App) fetchWithRetries(ctx context.Context, device *Device) ([]byte, error) {
+	deadline := time.Now().Add(app.pollFrequency(device))
+
+	for attempt := 1; ; attempt++ {
+		body, err := app.fetchAttempt(ctx, device)
+		if err == nil {
+			return body, nil
+		}
+		if attempt >= app.RetryAttempts || ctx.Err() != nil || device.breakerOpen.Load() || errors.As(err, &permanentError{}) {
+			return nil, err
+		}
+
+		backoff := app.retryBackoff(attempt)
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, err
+		}
+		incWithExemplar(ctx, app.PollRetriesCounter.With(device.Labels))
+		app.Logger.Warn("Retrying poll", zap.String("device", device.Name), zap.Int("attempt", attempt+1), zap.Duration("backoff", backoff), zap.Error(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// fetchAttempt makes a single timed request to the device.
+func (app *App) fetchAttempt(ctx context.Context, device *Device) ([]byte, error) {
+	timeout := pollTimeout
+	if device.Cloud {
+		timeout = cloudRequestTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var req *http.Request
+	var err error
+	if device.Cloud {
+		req, err = app.cloudRequest(ctx, device.Address)
+	} else {
+		req, err = app.newDeviceRequest(ctx, device.Address)
+	}
+	if err != nil {
+		app.Logger.Error("Error creating request", zap.String("device", device.Name), zap.Error(err))
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	start := time.Now()
+	body, err := app.fetch(req, device)
+	observeWithExemplar(ctx, app.PollDuration.With(device.Labels), time.Since(start).Seconds())
+	return body, err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	app := &App{RetryInitialBackoff: 250 * time.Millisecond, RetryMaxBackoff: 5 * time.Second}
+
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{1, 250 * time.Millisecond},
+		{2, 500 * time.Millisecond},
+		{3, time.Second},
+		{5, 4 * time.Second},
+		{6, 5 * time.Second},
+		// Shifts past the width of a Duration must not wrap around.
+		{40, 5 * time.Second},
+		{100, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := app.retryBackoff(tt.retry); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %s, want %s", tt.retry, got, tt.want)
+		}
+	}
+}
+
+func TestRetryBackoffJitter(t *testing.T) {
+	app := &App{RetryInitialBackoff: time.Second, RetryMaxBackoff: time.Second, RetryJitter: 0.2}
+
+	for i := 0; i < 100; i++ {
+		if got := app.retryBackoff(1); got < 800*time.Millisecond || got > time.Second {
+			t.Fatalf("retryBackoff(1) = %s, want within [800ms, 1s]", got)
+		}
+	}
+}
+
+func TestCheckCloudResponse(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantErr   bool
+		permanent bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusTooManyRequests, true, true},
+		{http.StatusUnauthorized, true, true},
+		{http.StatusForbidden, true, true},
+		{http.StatusBadGateway, true, false},
+	}
+	for _, tt := range tests {
+		err := checkCloudResponse(&http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status)})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkCloudResponse(%d) error = %v, want error %v", tt.status, err, tt.wantErr)
+		}
+		if permanent := errors.As(err, &permanentError{}); permanent != tt.permanent {
+			t.Errorf("checkCloudResponse(%d) permanent = %v, want %v", tt.status, permanent, tt.permanent)
+		}
+	}
+}
+
+func TestCheckDeviceResponse(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantErr   bool
+		permanent bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusNotFound, true, true},
+		{http.StatusRequestTimeout, true, false},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusServiceUnavailable, true, false},
+	}
+	for _, tt := range tests {
+		err := checkDeviceResponse(&http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status)})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkDeviceResponse(%d) error = %v, want error %v", tt.status, err, tt.wantErr)
+		}
+		if permanent := errors.As(err, &permanentError{}); permanent != tt.permanent {
+			t.Errorf("checkDeviceResponse(%d) permanent = %v, want %v", tt.status, permanent, tt.permanent)
+		}
+	}
+}
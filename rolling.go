@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/epk/awair-local-prom-exporter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// climateMetricNames are the names of the climate gauges of the payload
+// fields, without the climate metric prefix.
+var climateMetricNames = func() map[string]string {
+	names := map[string]string{}
+	for field, metric := range collector.Metrics {
+		names[field] = metric.Name
+	}
+	return names
+}()
+
+// formatWindow formats a window for the window label, e.g. 5m or 24h.
+func formatWindow(window time.Duration) string {
+	switch {
+	case window%time.Hour == 0:
+		return fmt.Sprintf("%dh", window/time.Hour)
+	case window%time.Minute == 0:
+		return fmt.Sprintf("%dm", window/time.Minute)
+	}
+	return window.String()
+}
+
+func validateRolling(windows []time.Duration, sensors []string) error {
+	for _, window := range windows {
+		if window <= 0 {
+			return fmt.Errorf("invalid rolling window %s, must be positive", window)
+		}
+	}
+	if err := validateForceSensors(sensors); err != nil {
+		return fmt.Errorf("invalid rolling sensors: %w", err)
+	}
+	seen := map[string]bool{}
+	for _, sensor := range sensors {
+		if seen[sensor] {
+			return fmt.Errorf("rolling sensor %q listed twice", sensor)
+		}
+		seen[sensor] = true
+	}
+	return nil
+}
+
+type rollingSample struct {
+	time  time.Time
+	value float64
+}
+
+// RollingAverages keeps the readings of the --rolling-sensors over the
+// longest --rolling-windows.
+type RollingAverages struct {
+	mu      sync.Mutex
+	samples map[string][]rollingSample
+}
+
+// add records a reading and returns the mean over each window up to the
+// latest reading, which only covers the readings seen so far until the
+// history spans the window. A backfilled reading may be older than the
+// latest one.
+func (r *RollingAverages) add(field string, t time.Time, value float64, windows []time.Duration) []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.samples == nil {
+		r.samples = map[string][]rollingSample{}
+	}
+
+	longest := time.Duration(0)
+	for _, window := range windows {
+		if window > longest {
+			longest = window
+		}
+	}
+
+	samples := insertRollingSample(r.samples[field], rollingSample{time: t, value: value})
+	latest := samples[len(samples)-1].time
+	cutoff := latest.Add(-longest)
+	drop := 0
+	for drop < len(samples) && !samples[drop].time.After(cutoff) {
+		drop++
+	}
+	samples = samples[drop:]
+	r.samples[field] = samples
+
+	means := make([]float64, len(windows))
+	for i, window := range windows {
+		cutoff := latest.Add(-window)
+		sum, count := 0.0, 0
+		for j := len(samples) - 1; j >= 0 && samples[j].time.After(cutoff); j-- {
+			sum += samples[j].value
+			count++
+		}
+		means[i] = sum / float64(count)
+	}
+	return means
+}
+
+// insertRollingSample inserts a sample after those not taken later.
+func insertRollingSample(samples []rollingSample, sample rollingSample) []rollingSample {
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].time.After(sample.time) })
+	samples = append(samples, rollingSample{})
+	copy(samples[i+1:], samples[i:])
+	samples[i] = sample
+	return samples
+}
+
+// meanSince returns the mean of the readings of field taken after since, and
+// false when there are none.
+func (r *RollingAverages) meanSince(field string, since time.Time) (float64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sum, count := 0.0, 0
+	samples := r.samples[field]
+	for j := len(samples) - 1; j >= 0 && samples[j].time.After(since); j-- {
+		sum += samples[j].value
+		count++
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+func (app *App) initializeRollingMetrics() {
+	app.RollingAverageGauges = map[string]*prometheus.GaugeVec{}
+	if len(app.RollingWindows) == 0 {
+		return
+	}
+
+	for _, field := range app.RollingSensors {
+		app.RollingAverageGauges[field] = promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: app.metricNamespace(),
+			Subsystem: app.MetricSubsystem,
+			Name:      climateMetricNames[field] + "_avg",
+			Help:      "Mean of the " + field + " readings over the window",
+		}, append(app.deviceLabelNames(), "window"))
+	}
+}
+
+func windowLabels(device *Device, window time.Duration) prometheus.Labels {
+	labels := prometheus.Labels{"window": formatWindow(window)}
+	for name, value := range device.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// recordRollingAverages adds a reading to the rolling history and refreshes
+// the average metrics.
+func (app *App) recordRollingAverages(device *Device, stats AwairStats) {
+	for field, gauge := range app.RollingAverageGauges {
+		if !device.Profile.has(field) || !hasField(stats, field) {
+			continue
+		}
+		means := device.RollingAverages.add(field, readingTime(stats), fieldValue(stats, field), app.RollingWindows)
+		for i, window := range app.RollingWindows {
+			gauge.With(windowLabels(device, window)).Set(means[i])
+		}
+	}
+}
+
+func (app *App) deleteRollingAverages(device *Device) {
+	for _, gauge := range app.RollingAverageGauges {
+		for _, window := range app.RollingWindows {
+			gauge.Delete(windowLabels(device, window))
+		}
+	}
+}
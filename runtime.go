@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"go.uber.org/automaxprocs/maxprocs"
+	"go.uber.org/zap"
+)
+
+// tuneRuntime aligns GOMAXPROCS with the container CPU quota and applies the
+// soft memory limit, so the scheduler and GC respect cgroup limits rather
+// than the host's resources.
+func (app *App) tuneRuntime() error {
+	_, err := maxprocs.Set(maxprocs.Logger(app.Logger.Sugar().Infof))
+	if err != nil {
+		return fmt.Errorf("failed to set GOMAXPROCS: %w", err)
+	}
+
+	if app.MemoryLimit == "" {
+		return nil
+	}
+
+	limit, err := parseMemoryLimit(app.MemoryLimit)
+	if err != nil {
+		return err
+	}
+	debug.SetMemoryLimit(limit)
+	app.Logger.Info("Set soft memory limit", zap.Int64("bytes", limit))
+
+	return nil
+}
+
+// parseMemoryLimit parses a size using the same syntax as the GOMEMLIMIT
+// environment variable, e.g. "512MiB" or "1GiB".
+func parseMemoryLimit(s string) (int64, error) {
+	limit, err := parseByteSize(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit %q", s)
+	}
+	return limit, nil
+}
+
+// parseByteSize parses a positive size in bytes with an optional B, KiB,
+// MiB, GiB or TiB suffix.
+func parseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"TiB", 1 << 40},
+		{"GiB", 1 << 30},
+		{"MiB", 1 << 20},
+		{"KiB", 1 << 10},
+		{"B", 1},
+	}
+
+	scale := int64(1)
+	number := s
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			scale = unit.scale
+			number = strings.TrimSuffix(s, unit.suffix)
+			break
+		}
+	}
+
+	value, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || value <= 0 || value > math.MaxInt64/scale {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return value * scale, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+func validatePollFrequency(frequency time.Duration) error {
+	if frequency <= 0 {
+		return errors.New("poll-frequency must be positive")
+	}
+	return nil
+}
+
+func validatePollJitter(jitter float64) error {
+	// A jitter of 1 could schedule polls no time apart.
+	if jitter < 0 || jitter >= 1 {
+		return errors.New("poll-jitter must be at least 0 and less than 1")
+	}
+	return nil
+}
+
+// jitterInterval moves the interval randomly by up to --poll-jitter of
+// itself in either direction.
+func (app *App) jitterInterval(interval time.Duration) time.Duration {
+	return interval + time.Duration((rand.Float64()*2-1)*app.PollJitter*float64(interval))
+}
+
+// firstPollDelay returns how long a new poller waits before its first poll.
+// With --poll-jitter the first polls are spread over the interval so
+// devices started together are not polled in lockstep.
+func (app *App) firstPollDelay(interval time.Duration) time.Duration {
+	if app.PollJitter == 0 || interval <= 0 {
+		return interval
+	}
+	return time.Duration(rand.Int63n(int64(interval))) + 1
+}
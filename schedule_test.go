@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidatePollJitter(t *testing.T) {
+	for jitter, wantErr := range map[float64]bool{-0.1: true, 0: false, 0.5: false, 0.99: false, 1: true, 2: true} {
+		if err := validatePollJitter(jitter); (err != nil) != wantErr {
+			t.Errorf("validatePollJitter(%v) error = %v, want error %v", jitter, err, wantErr)
+		}
+	}
+}
+
+func TestJitterInterval(t *testing.T) {
+	const interval = 10 * time.Second
+
+	app := &App{}
+	if got := app.jitterInterval(interval); got != interval {
+		t.Errorf("jitterInterval() without jitter = %s, want %s", got, interval)
+	}
+
+	app.PollJitter = 0.2
+	spread := false
+	for i := 0; i < 1000; i++ {
+		got := app.jitterInterval(interval)
+		if got < 8*time.Second || got > 12*time.Second {
+			t.Fatalf("jitterInterval() = %s, want within 20%% of %s", got, interval)
+		}
+		spread = spread || got != interval
+	}
+	if !spread {
+		t.Error("jitterInterval() never moved the interval")
+	}
+}
+
+func TestFirstPollDelay(t *testing.T) {
+	const interval = 10 * time.Second
+
+	app := &App{}
+	if got := app.firstPollDelay(interval); got != interval {
+		t.Errorf("firstPollDelay() without jitter = %s, want %s", got, interval)
+	}
+
+	app.PollJitter = 0.1
+	for i := 0; i < 1000; i++ {
+		if got := app.firstPollDelay(interval); got <= 0 || got > interval {
+			t.Fatalf("firstPollDelay() = %s, want within (0, %s]", got, interval)
+		}
+	}
+	if got := app.firstPollDelay(0); got != 0 {
+		t.Errorf("firstPollDelay(0) = %s, want 0", got)
+	}
+}
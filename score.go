@@ -0,0 +1,80 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// scoreFactor is a sensor of the Awair score with the thresholds of its
+// index, as published for the Awair cloud API's indices.
+type scoreFactor struct {
+	field string
+	// high are the upper bounds of indices 0 to 3.
+	high []float64
+	// low are the lower bounds of indices 0 to -3 of the factors that can
+	// also be too low.
+	low []float64
+}
+
+var scoreFactors = []scoreFactor{
+	{field: "temp", high: []float64{25, 27, 29, 33}, low: []float64{18, 16, 14, 10}},
+	{field: "humid", high: []float64{50, 60, 65, 80}, low: []float64{40, 35, 20, 15}},
+	{field: "co2", high: []float64{600, 1000, 1500, 2500}},
+	{field: "voc", high: []float64{333, 1000, 3333, 8332}},
+	{field: "pm25", high: []float64{15, 35, 55, 75}},
+}
+
+// index returns the factor's index of a reading, from 0 (good) to 4 (bad),
+// or down to -4 for a temperature or humidity too low.
+func (f scoreFactor) index(value float64) int {
+	index := 0
+	for _, bound := range f.high {
+		if value > bound {
+			index++
+		}
+	}
+	if index > 0 {
+		return index
+	}
+	for _, bound := range f.low {
+		if value < bound {
+			index--
+		}
+	}
+	return index
+}
+
+func (app *App) initializeScoreComponentMetrics() {
+	app.ScoreComponentGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Name:      "score_component",
+		Help:      "Index of the factor of the Awair score, computed locally: 0 (good) to 4 (bad), negative for a temperature or humidity too low",
+	}, append(app.deviceLabelNames(), "factor"))
+}
+
+func scoreComponentLabels(device *Device, factor string) prometheus.Labels {
+	labels := prometheus.Labels{"factor": factor}
+	for name, value := range device.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// recordScoreComponents refreshes the index of each score factor the
+// reading has, so a dashboard can show which sensor dragged the score down.
+func (app *App) recordScoreComponents(device *Device, stats AwairStats) {
+	for _, f := range scoreFactors {
+		labels := scoreComponentLabels(device, f.field)
+		if !device.Profile.has(f.field) || !hasField(stats, f.field) {
+			app.ScoreComponentGauge.Delete(labels)
+			continue
+		}
+		app.ScoreComponentGauge.With(labels).Set(float64(f.index(fieldValue(stats, f.field))))
+	}
+}
+
+func (app *App) deleteScoreComponents(device *Device) {
+	for _, f := range scoreFactors {
+		app.ScoreComponentGauge.Delete(scoreComponentLabels(device, f.field))
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestScoreFactorIndex(t *testing.T) {
+	tests := []struct {
+		field string
+		value float64
+		want  int
+	}{
+		{"temp", 21, 0},
+		{"temp", 25, 0},
+		{"temp", 26, 1},
+		{"temp", 35, 4},
+		{"temp", 15, -2},
+		{"temp", 5, -4},
+		{"humid", 45, 0},
+		{"humid", 62, 2},
+		{"humid", 30, -2},
+		{"co2", 450, 0},
+		{"co2", 1200, 2},
+		{"co2", 3000, 4},
+		{"voc", 500, 1},
+		{"pm25", 60, 3},
+	}
+	for _, tt := range tests {
+		for _, f := range scoreFactors {
+			if f.field != tt.field {
+				continue
+			}
+			if got := f.index(tt.value); got != tt.want {
+				t.Errorf("index of %s %v = %d, want %d", tt.field, tt.value, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/epk/awair-local-prom-exporter/pkg/awair"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// Outage behaviour of simulated devices: each request has a small chance of
+// starting an outage during which the device answers with errors.
+const (
+	simulatedOutageChance      = 0.01
+	simulatedOutageMinDuration = time.Minute
+	simulatedOutageMaxDuration = 5 * time.Minute
+)
+
+// simulatedDevice produces readings following daily temperature, humidity,
+// occupancy CO2 and cooking PM2.5/VOC patterns, with sensor noise and
+// occasional outages.
+type simulatedDevice struct {
+	mu          sync.Mutex
+	rand        *rand.Rand
+	outageUntil time.Time
+
+	// profile lists the payload fields sent.
+	profile deviceProfile
+	// outageChance is the chance of a request starting an outage.
+	outageChance float64
+	// errorRate is the chance of a request failing outside outages.
+	errorRate float64
+	latency   time.Duration
+	// values replace the simulated readings of their fields.
+	values map[string]float64
+}
+
+func newSimulatedDevice(seed int64) *simulatedDevice {
+	profile, _ := findDeviceProfile("element")
+	return &simulatedDevice{
+		rand:         rand.New(rand.NewSource(seed)),
+		profile:      profile,
+		outageChance: simulatedOutageChance,
+	}
+}
+
+// hourOfDay returns the local time of day in fractional hours.
+func hourOfDay(t time.Time) float64 {
+	t = t.Local()
+	return float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+}
+
+// dailyWave is a sine wave over a day peaking at the given hour.
+func dailyWave(hour, peak float64) float64 {
+	return math.Cos(2 * math.Pi * (hour - peak) / 24)
+}
+
+// bump is a bell curve centred on hour with the given width in hours.
+func bump(hour, centre, width float64) float64 {
+	d := hour - centre
+	return math.Exp(-d * d / (2 * width * width))
+}
+
+// dewPoint uses the Magnus approximation.
+func dewPoint(temp, humid float64) float64 {
+	const b, c = 17.62, 243.12
+	gamma := math.Log(humid/100) + b*temp/(c+temp)
+	return c * gamma / (b - gamma)
+}
+
+// absoluteHumidity returns the water vapour density in g/m³.
+func absoluteHumidity(temp, humid float64) float64 {
+	saturation := 6.112 * math.Exp(17.67*temp/(temp+243.5))
+	return saturation * humid * 2.1674 / (273.15 + temp)
+}
+
+// simulatedScore roughly follows the Awair scoring bands.
+func simulatedScore(temp, humid float64, co2, voc, pm25 int) int {
+	score := 100.0
+	score -= math.Max(0, math.Abs(temp-21)-2) * 4
+	score -= math.Max(0, math.Abs(humid-45)-10) * 1.5
+	score -= math.Max(0, float64(co2-600)) / 40
+	score -= math.Max(0, float64(voc-333)) / 50
+	score -= math.Max(0, float64(pm25-12)) / 2
+	return int(math.Max(0, math.Min(100, score)))
+}
+
+func (d *simulatedDevice) noise(stddev float64) float64 {
+	return d.rand.NormFloat64() * stddev
+}
+
+func (d *simulatedDevice) reading(now time.Time) AwairStats {
+	hour := hourOfDay(now)
+
+	// Warmest mid-afternoon, more humid in the early morning.
+	temp := 21 + 2*dailyWave(hour, 15) + d.noise(0.1)
+	humid := 45 - 6*dailyWave(hour, 15) + d.noise(0.5)
+	// CO2 builds up overnight with people asleep and a window closed.
+	co2 := int(550 + 350*dailyWave(hour, 5) + d.noise(15))
+	// Cooking around breakfast and dinner drives PM2.5 and VOCs.
+	cooking := bump(hour, 7.5, 0.5) + 1.5*bump(hour, 18.5, 0.75)
+	pm25 := int(math.Max(0, 4+25*cooking+d.noise(1)))
+	voc := int(math.Max(0, 120+600*cooking+d.noise(20)))
+
+	return AwairStats{
+		Timestamp:      now.UTC(),
+		Score:          simulatedScore(temp, humid, co2, voc, pm25),
+		DewPoint:       dewPoint(temp, humid),
+		Temp:           temp,
+		Humid:          humid,
+		AbsHumid:       absoluteHumidity(temp, humid),
+		Co2:            co2,
+		Co2Est:         co2 + int(d.noise(40)),
+		Co2EstBaseline: 35000 + int(d.noise(50)),
+		Voc:            voc,
+		VocBaseline:    37000 + int(d.noise(50)),
+		VocH2Raw:       26 + int(d.noise(1)),
+		VocEthanolRaw:  38 + int(d.noise(1)),
+		Pm25:           pm25,
+		Pm10Est:        pm25 + 2 + int(math.Abs(d.noise(1))),
+	}
+}
+
+func (d *simulatedDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if d.latency > 0 {
+		time.Sleep(d.latency)
+	}
+
+	d.mu.Lock()
+	now := time.Now()
+	if now.After(d.outageUntil) && d.rand.Float64() < d.outageChance {
+		span := simulatedOutageMaxDuration - simulatedOutageMinDuration
+		d.outageUntil = now.Add(simulatedOutageMinDuration + time.Duration(d.rand.Int63n(int64(span))))
+	}
+	if now.Before(d.outageUntil) {
+		d.mu.Unlock()
+		http.Error(w, "simulated outage", http.StatusServiceUnavailable)
+		return
+	}
+	if d.rand.Float64() < d.errorRate {
+		d.mu.Unlock()
+		http.Error(w, "simulated error", http.StatusInternalServerError)
+		return
+	}
+	stats := d.reading(now)
+	d.mu.Unlock()
+
+	// Only send the profile's fields so the device is detected as one.
+	payload := map[string]interface{}{"timestamp": stats.Timestamp}
+	for _, field := range d.profile.Fields {
+		payload[field] = fieldValue(stats, field)
+		if value, ok := d.values[field]; ok {
+			payload[field] = value
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+// simulatedConfig serves fixed device metadata.
+func simulatedConfig(config awair.DeviceConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(config)
+	})
+}
+
+// mountSimulatedDevice serves the device's air-data and config endpoints
+// under prefix.
+func mountSimulatedDevice(mux *http.ServeMux, prefix string, i int, device *simulatedDevice) {
+	mux.Handle(prefix+awair.LatestPath, device)
+	mux.Handle(prefix+awair.ConfigPath, simulatedConfig(awair.DeviceConfig{
+		DeviceUUID: fmt.Sprintf("awair-%s_%d", device.profile.Name, i),
+		FwVersion:  "simulated",
+	}))
+}
+
+// startSimulator serves --simulate devices on a loopback listener so their
+// readings go through the same HTTP polling path as real hardware, and
+// returns them to be polled instead of the configured addresses.
+func (app *App) startSimulator(ctx context.Context, group *errgroup.Group) ([]*Device, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for simulated devices: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	seed := time.Now().UnixNano()
+	devices := []*Device{}
+	for i := 1; i <= app.Simulate; i++ {
+		name := fmt.Sprintf("sim-%d", i)
+		mountSimulatedDevice(mux, "/"+name, i, newSimulatedDevice(seed+int64(i)))
+		devices = append(devices, newDevice(name, fmt.Sprintf("http://%s/%s/air-data/latest", listener.Addr(), name)))
+	}
+	server := &http.Server{Handler: mux}
+
+	group.Go(func() error {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("simulated devices failed: %w", err)
+		}
+		return nil
+	})
+
+	group.Go(func() error {
+		<-ctx.Done()
+		return server.Close()
+	})
+
+	app.Logger.Warn("Polling simulated devices instead of real hardware", zap.Int("devices", app.Simulate))
+
+	return devices, nil
+}
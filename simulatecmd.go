@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	registerCommand("simulate", command{
+		Usage: "Serve simulated Awair devices, for integration tests and demos without hardware.\nThe first device answers at /air-data/latest, each device also at /sim-<n>/air-data/latest, with its metadata next to them.",
+		Run:   runSimulate,
+	})
+}
+
+// simulatorOptions are the options of the simulate command.
+type simulatorOptions struct {
+	Devices      int
+	Profile      string
+	Seed         int64
+	OutageChance float64
+	ErrorRate    float64
+	Latency      time.Duration
+	Values       map[string]string
+}
+
+// newSimulatorMux builds the devices of the options and serves them.
+func newSimulatorMux(options simulatorOptions) (*http.ServeMux, error) {
+	if options.Devices < 1 {
+		return nil, errors.New("devices must be positive")
+	}
+	profile, ok := findDeviceProfile(options.Profile)
+	if !ok {
+		return nil, fmt.Errorf("invalid profile %q, must be one of omni, element, mint or glow-c", options.Profile)
+	}
+	for name, chance := range map[string]float64{"outage-chance": options.OutageChance, "error-rate": options.ErrorRate} {
+		if chance < 0 || chance > 1 {
+			return nil, fmt.Errorf("%s must be between 0 and 1", name)
+		}
+	}
+	values := map[string]float64{}
+	for field, value := range options.Values {
+		if !profile.has(field) {
+			return nil, fmt.Errorf("invalid value of %q, not a field of the %s profile", field, profile.Name)
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %q: %w", field, err)
+		}
+		values[field] = parsed
+	}
+
+	mux := http.NewServeMux()
+	for i := 1; i <= options.Devices; i++ {
+		device := newSimulatedDevice(options.Seed + int64(i))
+		device.profile = profile
+		device.outageChance = options.OutageChance
+		device.errorRate = options.ErrorRate
+		device.latency = options.Latency
+		device.values = values
+		if i == 1 {
+			mountSimulatedDevice(mux, "", i, device)
+		}
+		mountSimulatedDevice(mux, fmt.Sprintf("/sim-%d", i), i, device)
+	}
+	return mux, nil
+}
+
+func runSimulate(fs *pflag.FlagSet, args []string) int {
+	options := simulatorOptions{}
+	listen := fs.String("listen", "127.0.0.1:8080", "Address to serve the devices on")
+	fs.IntVar(&options.Devices, "devices", 1, "Number of simulated devices")
+	fs.StringVar(&options.Profile, "profile", "element", "Sensor set of the devices: omni, element, mint or glow-c")
+	fs.Int64Var(&options.Seed, "seed", time.Now().UnixNano(), "Seed of the simulated readings, to repeat a run")
+	fs.Float64Var(&options.OutageChance, "outage-chance", simulatedOutageChance, "Chance of each request starting a 1 to 5 minute outage answered with 503s")
+	fs.Float64Var(&options.ErrorRate, "error-rate", 0, "Chance of each request outside outages being answered with a 500")
+	fs.DurationVar(&options.Latency, "latency", 0, "Delay before answering each request")
+	fs.StringToStringVar(&options.Values, "set", nil, "Fixed value of a payload field as field=value, e.g. co2=1500 (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	mux, err := newSimulatorMux(options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Serving %d simulated %s devices on http://%s/air-data/latest (seed %d)\n", options.Devices, options.Profile, listener.Addr(), options.Seed)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewSimulatorMux(t *testing.T) {
+	mux, err := newSimulatorMux(simulatorOptions{Devices: 2, Profile: "glow-c", Values: map[string]string{"temp": "30"}})
+	if err != nil {
+		t.Fatalf("newSimulatorMux() error = %v", err)
+	}
+	for _, path := range []string{"/air-data/latest", "/sim-2/air-data/latest"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		payload := map[string]interface{}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		if payload["temp"] != 30.0 {
+			t.Errorf("GET %s temp = %v, want 30", path, payload["temp"])
+		}
+		if _, ok := payload["co2"]; ok {
+			t.Errorf("GET %s sent co2 for a glow-c", path)
+		}
+	}
+
+	mux, err = newSimulatorMux(simulatorOptions{Devices: 1, Profile: "element", ErrorRate: 1})
+	if err != nil {
+		t.Fatalf("newSimulatorMux() error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/air-data/latest", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status with an error rate of 1 = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	for _, options := range []simulatorOptions{
+		{Devices: 0, Profile: "element"},
+		{Devices: 1, Profile: "auto"},
+		{Devices: 1, Profile: "element", ErrorRate: 2},
+		{Devices: 1, Profile: "mint", Values: map[string]string{"co2": "600"}},
+		{Devices: 1, Profile: "element", Values: map[string]string{"co2": "high"}},
+	} {
+		if _, err := newSimulatorMux(options); err == nil {
+			t.Errorf("newSimulatorMux(%+v) succeeded", options)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+//go:build !no_graphite
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type graphiteOptions struct {
+	Address  string
+	Template string
+}
+
+var graphiteConfig graphiteOptions
+
+func init() {
+	registerSink("graphite", sinkRegistration{
+		Flags: func(fs *pflag.FlagSet) {
+			fs.StringVar(&graphiteConfig.Address, "graphite-address", "", "Carbon host:port to send readings to with the plaintext protocol (disabled when empty)")
+			fs.StringVar(&graphiteConfig.Template, "graphite-template", "awair.{device}.{sensor}", "Metric path template; {device}, {sensor} and config file labels such as {room} are replaced")
+		},
+		New: func(app *App) (Sink, error) {
+			if graphiteConfig.Address == "" {
+				return nil, nil
+			}
+			return &graphiteSink{options: graphiteConfig}, nil
+		},
+	})
+}
+
+var (
+	graphitePlaceholder = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+	graphiteUnsafe      = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+)
+
+// graphiteSink writes readings over a TCP connection to Carbon, dialling
+// again on the next reading after the connection fails.
+type graphiteSink struct {
+	options graphiteOptions
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// graphitePath expands the template for a device's sensor. Placeholders
+// without a value are left empty.
+func graphitePath(template string, device *Device, field string) string {
+	return graphitePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		value := device.ExtraLabels[name]
+		switch name {
+		case "device":
+			value = device.Name
+		case "sensor":
+			value = field
+		}
+		return graphiteUnsafe.ReplaceAllString(value, "_")
+	})
+}
+
+func (s *graphiteSink) Publish(ctx context.Context, device *Device, stats AwairStats) error {
+	var lines strings.Builder
+	timestamp := readingTime(stats).Unix()
+	for _, field := range device.Profile.Fields {
+		if !hasField(stats, field) {
+			continue
+		}
+		fmt.Fprintf(&lines, "%s %s %d\n", graphitePath(s.options.Template, device, field), strconv.FormatFloat(fieldValue(stats, field), 'f', -1, 64), timestamp)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		dialer := net.Dialer{Timeout: 5 * time.Second}
+		conn, err := dialer.DialContext(ctx, "tcp", s.options.Address)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	if err := s.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	if _, err := s.conn.Write([]byte(lines.String())); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *graphiteSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
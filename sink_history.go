@@ -0,0 +1,202 @@
+//go:build !no_history
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/pflag"
+	bolt "go.etcd.io/bbolt"
+)
+
+// historyPruneInterval is how often readings past --history-retention are
+// deleted.
+const historyPruneInterval = time.Hour
+
+type historyOptions struct {
+	Path      string
+	Retention time.Duration
+}
+
+var historyConfig historyOptions
+
+func init() {
+	registerSink("history", sinkRegistration{
+		Flags: func(fs *pflag.FlagSet) {
+			fs.StringVar(&historyConfig.Path, "history-path", "", "Path of the on-disk store recording every reading (disabled when empty)")
+			fs.DurationVar(&historyConfig.Retention, "history-retention", 0, "Age after which readings are deleted from the history store (0 keeps them forever)")
+		},
+		New: func(app *App) (Sink, error) {
+			if historyConfig.Path == "" {
+				return nil, nil
+			}
+			return openHistoryStore(historyConfig)
+		},
+	})
+}
+
+var (
+	historyMetaBucket     = []byte("meta")
+	historyReadingsBucket = []byte("readings")
+	historySchemaKey      = []byte("schema_version")
+)
+
+// historyMigrations upgrade the store one schema version at a time. The
+// schema version is the number of migrations applied.
+var historyMigrations = []func(tx *bolt.Tx) error{
+	// 1: readings are stored per device bucket, keyed by big endian Unix
+	// nanoseconds of the sample time, as the JSON device payload.
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyReadingsBucket)
+		return err
+	},
+}
+
+// historyStore records every reading in a bbolt database.
+type historyStore struct {
+	db        *bolt.DB
+	retention time.Duration
+
+	mu         sync.Mutex
+	lastPruned time.Time
+	// pending counts the readings waiting for their write transaction,
+	// which bbolt runs one at a time.
+	pending atomic.Int64
+}
+
+func openHistoryStore(options historyOptions) (*historyStore, error) {
+	db, err := bolt.Open(options.Path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history store %s: %w", options.Path, err)
+	}
+
+	if err := db.Update(migrateHistory); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate history store %s: %w", options.Path, err)
+	}
+
+	return &historyStore{db: db, retention: options.Retention}, nil
+}
+
+func migrateHistory(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(historyMetaBucket)
+	if err != nil {
+		return err
+	}
+
+	version := 0
+	if value := meta.Get(historySchemaKey); value != nil {
+		version = int(binary.BigEndian.Uint64(value))
+	}
+	if version > len(historyMigrations) {
+		return fmt.Errorf("schema version %d is newer than this exporter supports", version)
+	}
+
+	for ; version < len(historyMigrations); version++ {
+		if err := historyMigrations[version](tx); err != nil {
+			return fmt.Errorf("migration to schema version %d failed: %w", version+1, err)
+		}
+	}
+	return meta.Put(historySchemaKey, binary.BigEndian.AppendUint64(nil, uint64(version)))
+}
+
+func historyKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+}
+
+func (s *historyStore) Publish(ctx context.Context, device *Device, stats AwairStats) error {
+	value, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	s.pending.Add(1)
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		readings, err := tx.Bucket(historyReadingsBucket).CreateBucketIfNotExists([]byte(device.Name))
+		if err != nil {
+			return err
+		}
+		return readings.Put(historyKey(readingTime(stats)), value)
+	})
+	s.pending.Add(-1)
+	if err != nil {
+		return err
+	}
+
+	return s.pruneIfDue()
+}
+
+// Readings calls fn with each of the device's readings taken between from
+// and to inclusive, oldest first, stopping at the first error.
+func (s *historyStore) Readings(device string, from, to time.Time, fn func(AwairStats) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		readings := tx.Bucket(historyReadingsBucket).Bucket([]byte(device))
+		if readings == nil {
+			return nil
+		}
+
+		end := historyKey(to)
+		cursor := readings.Cursor()
+		for key, value := cursor.Seek(historyKey(from)); key != nil && bytes.Compare(key, end) <= 0; key, value = cursor.Next() {
+			stats := AwairStats{}
+			if err := json.Unmarshal(value, &stats); err != nil {
+				return err
+			}
+			if err := fn(stats); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// pruneIfDue deletes the readings past the retention at most once per
+// historyPruneInterval.
+func (s *historyStore) pruneIfDue() error {
+	if s.retention <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	if time.Since(s.lastPruned) < historyPruneInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastPruned = time.Now()
+	s.mu.Unlock()
+
+	cutoff := historyKey(time.Now().Add(-s.retention))
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyReadingsBucket).ForEach(func(name, _ []byte) error {
+			readings := tx.Bucket(historyReadingsBucket).Bucket(name)
+			// Deleting while iterating skips keys, so collect them first.
+			expired := [][]byte{}
+			cursor := readings.Cursor()
+			for key, _ := cursor.First(); key != nil && bytes.Compare(key, cutoff) < 0; key, _ = cursor.Next() {
+				expired = append(expired, append([]byte(nil), key...))
+			}
+			for _, key := range expired {
+				if err := readings.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Backlog returns the number of readings not yet written to the store.
+func (s *historyStore) Backlog() int {
+	return int(s.pending.Load())
+}
+
+func (s *historyStore) Close() error {
+	return s.db.Close()
+}
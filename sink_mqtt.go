@@ -0,0 +1,123 @@
+//go:build !no_mqtt
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+type mqttOptions struct {
+	Broker      string
+	TopicPrefix string
+	ClientID    string
+	Username    string
+	Password    string
+	QoS         int
+	Retain      bool
+}
+
+var mqttConfig mqttOptions
+
+func init() {
+	registerSink("mqtt", sinkRegistration{
+		Flags: func(fs *pflag.FlagSet) {
+			fs.StringVar(&mqttConfig.Broker, "mqtt-broker", "", "MQTT broker URL to publish readings to, e.g. tcp://localhost:1883 (disabled when empty)")
+			fs.StringVar(&mqttConfig.TopicPrefix, "mqtt-topic-prefix", "awair", "Prefix of the <prefix>/<device>/<sensor> topics readings are published to")
+			fs.StringVar(&mqttConfig.ClientID, "mqtt-client-id", "awair-local-prom-exporter", "MQTT client identifier")
+			fs.StringVar(&mqttConfig.Username, "mqtt-username", "", "MQTT username")
+			fs.StringVar(&mqttConfig.Password, "mqtt-password", "", "MQTT password")
+			fs.IntVar(&mqttConfig.QoS, "mqtt-qos", 0, "MQTT quality of service level: 0, 1 or 2")
+			fs.BoolVar(&mqttConfig.Retain, "mqtt-retain", false, "Publish readings as retained messages")
+		},
+		New: func(app *App) (Sink, error) {
+			if mqttConfig.Broker == "" {
+				return nil, nil
+			}
+			return newMQTTSink(app.Logger, mqttConfig)
+		},
+	})
+}
+
+// mqttSink publishes each field of a reading as its own message.
+type mqttSink struct {
+	client  mqtt.Client
+	options mqttOptions
+	// pending counts the messages the broker has not acknowledged yet,
+	// including those queued while it is unreachable.
+	pending atomic.Int64
+}
+
+func newMQTTSink(logger *zap.Logger, options mqttOptions) (*mqttSink, error) {
+	if options.QoS < 0 || options.QoS > 2 {
+		return nil, fmt.Errorf("invalid mqtt-qos %d, must be 0, 1 or 2", options.QoS)
+	}
+
+	clientOptions := mqtt.NewClientOptions().
+		AddBroker(options.Broker).
+		SetClientID(options.ClientID).
+		SetUsername(options.Username).
+		SetPassword(options.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Warn("Lost connection to MQTT broker", zap.String("broker", options.Broker), zap.Error(err))
+		})
+
+	client := mqtt.NewClient(clientOptions)
+	// With connect retry enabled the client keeps trying in the background,
+	// so an unreachable broker does not stop the exporter from starting.
+	client.Connect()
+
+	return &mqttSink{client: client, options: options}, nil
+}
+
+func (s *mqttSink) Publish(ctx context.Context, device *Device, stats AwairStats) error {
+	prefix := strings.TrimSuffix(s.options.TopicPrefix, "/")
+	tokens := make([]mqtt.Token, 0, len(device.Profile.Fields))
+	for _, field := range device.Profile.Fields {
+		if !hasField(stats, field) {
+			continue
+		}
+		topic := fmt.Sprintf("%s/%s/%s", prefix, device.Name, field)
+		payload := strconv.FormatFloat(fieldValue(stats, field), 'f', -1, 64)
+		token := s.client.Publish(topic, byte(s.options.QoS), s.options.Retain, payload)
+		s.pending.Add(1)
+		go func() {
+			<-token.Done()
+			s.pending.Add(-1)
+		}()
+		tokens = append(tokens, token)
+	}
+
+	for _, token := range tokens {
+		select {
+		case <-token.Done():
+			if err := token.Error(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return errors.New("timed out publishing to MQTT broker")
+		}
+	}
+	return nil
+}
+
+// Backlog returns the number of messages awaiting delivery to the broker.
+func (s *mqttSink) Backlog() int {
+	return int(s.pending.Load())
+}
+
+func (s *mqttSink) Close() error {
+	s.client.Disconnect(uint(time.Second / time.Millisecond))
+	return nil
+}
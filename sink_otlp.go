@@ -0,0 +1,159 @@
+//go:build !no_otlp
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+type otlpOptions struct {
+	Endpoint string
+	Headers  map[string]string
+}
+
+var otlpConfig otlpOptions
+
+func init() {
+	registerSink("otlp", sinkRegistration{
+		Flags: func(fs *pflag.FlagSet) {
+			fs.StringVar(&otlpConfig.Endpoint, "otlp-endpoint", "", "OTLP/HTTP collector URL to export readings to, e.g. http://localhost:4318 (disabled when empty)")
+			fs.StringToStringVar(&otlpConfig.Headers, "otlp-header", nil, "Header sent with every OTLP export as key=value, e.g. for authentication (repeatable)")
+		},
+		New: func(app *App) (Sink, error) {
+			if otlpConfig.Endpoint == "" {
+				return nil, nil
+			}
+			return &otlpSink{
+				url:     strings.TrimSuffix(otlpConfig.Endpoint, "/") + "/v1/metrics",
+				headers: otlpConfig.Headers,
+			}, nil
+		},
+	})
+}
+
+// otlpUnits are the UCUM units of the payload fields that have one.
+var otlpUnits = map[string]string{
+	"temp":      "Cel",
+	"humid":     "%",
+	"co2":       "ppm",
+	"voc":       "ppb",
+	"pm25":      "ug/m3",
+	"dew_point": "Cel",
+	"abs_humid": "g/m3",
+	"co2_est":   "ppm",
+	"pm10_est":  "ug/m3",
+	"lux":       "lx",
+	"spl_a":     "dB",
+}
+
+// otlpSink exports every reading as OTLP gauges over HTTP using the JSON
+// encoding. The device name and its config file labels, such as room, are
+// sent as resource attributes.
+type otlpSink struct {
+	url     string
+	headers map[string]string
+}
+
+type otlpDataPoint struct {
+	TimeUnixNano string  `json:"timeUnixNano"`
+	AsDouble     float64 `json:"asDouble"`
+}
+
+type otlpMetric struct {
+	Name  string `json:"name"`
+	Unit  string `json:"unit,omitempty"`
+	Gauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+type otlpScopeMetrics struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+func otlpMetrics(device *Device, stats AwairStats) otlpRequest {
+	resource := otlpResourceMetrics{}
+	resource.Resource.Attributes = []otlpAttribute{
+		newOTLPAttribute("service.name", "awair-local-prom-exporter"),
+		newOTLPAttribute("device.id", device.Name),
+	}
+	names := make([]string, 0, len(device.ExtraLabels))
+	for name := range device.ExtraLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		resource.Resource.Attributes = append(resource.Resource.Attributes, newOTLPAttribute(name, device.ExtraLabels[name]))
+	}
+
+	scope := otlpScopeMetrics{}
+	scope.Scope.Name = "awair-local-prom-exporter"
+	timestamp := strconv.FormatInt(readingTime(stats).UnixNano(), 10)
+	for _, field := range device.Profile.Fields {
+		if !hasField(stats, field) {
+			continue
+		}
+		metric := otlpMetric{Name: "awair.climate." + field, Unit: otlpUnits[field]}
+		metric.Gauge.DataPoints = []otlpDataPoint{{TimeUnixNano: timestamp, AsDouble: fieldValue(stats, field)}}
+		scope.Metrics = append(scope.Metrics, metric)
+	}
+	resource.ScopeMetrics = []otlpScopeMetrics{scope}
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{resource}}
+}
+
+func (s *otlpSink) Publish(ctx context.Context, device *Device, stats AwairStats) error {
+	body, err := json.Marshal(otlpMetrics(device, stats))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, s.url)
+	}
+	return nil
+}
+
+func (s *otlpSink) Close() error {
+	return nil
+}
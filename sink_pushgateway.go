@@ -0,0 +1,109 @@
+//go:build !no_pushgateway
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/spf13/pflag"
+)
+
+type pushgatewayOptions struct {
+	URL      string
+	Job      string
+	Username string
+	Password string
+}
+
+var pushgatewayConfig pushgatewayOptions
+
+func init() {
+	registerSink("pushgateway", sinkRegistration{
+		Flags: func(fs *pflag.FlagSet) {
+			fs.StringVar(&pushgatewayConfig.URL, "pushgateway-url", "", "Pushgateway URL to push each device's metrics to after every poll (disabled when empty)")
+			fs.StringVar(&pushgatewayConfig.Job, "pushgateway-job", "awair", "Job name of the pushed metrics")
+			fs.StringVar(&pushgatewayConfig.Username, "pushgateway-username", "", "Pushgateway basic auth username")
+			fs.StringVar(&pushgatewayConfig.Password, "pushgateway-password", "", "Pushgateway basic auth password")
+		},
+		New: func(app *App) (Sink, error) {
+			if pushgatewayConfig.URL == "" {
+				return nil, nil
+			}
+			return &pushgatewaySink{options: pushgatewayConfig, gatherer: app.gatherer()}, nil
+		},
+	})
+}
+
+// pushgatewaySink replaces the device's group on the Pushgateway with its
+// current series after every poll. The group is keyed by the device label.
+type pushgatewaySink struct {
+	options  pushgatewayOptions
+	gatherer prometheus.Gatherer
+}
+
+func (s *pushgatewaySink) Publish(ctx context.Context, device *Device, stats AwairStats) error {
+	pusher := push.New(s.options.URL, s.options.Job).
+		Grouping("device", device.Name).
+		Gatherer(deviceGatherer{Gatherer: s.gatherer, device: device.Name}).
+		Client(contextDoer{ctx: ctx})
+	if s.options.Username != "" {
+		pusher = pusher.BasicAuth(s.options.Username, s.options.Password)
+	}
+	return pusher.Push()
+}
+
+func (s *pushgatewaySink) Close() error {
+	return nil
+}
+
+// deviceGatherer keeps only the series of one device, without the device
+// label since the Pushgateway adds it from the grouping key.
+type deviceGatherer struct {
+	prometheus.Gatherer
+	device string
+}
+
+func (g deviceGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []*dto.MetricFamily{}
+	for _, family := range families {
+		metrics := []*dto.Metric{}
+		for _, metric := range family.Metric {
+			labels := []*dto.LabelPair{}
+			matched := false
+			for _, label := range metric.Label {
+				if label.GetName() == "device" {
+					matched = label.GetValue() == g.device
+					continue
+				}
+				labels = append(labels, label)
+			}
+			if matched {
+				metric.Label = labels
+				metrics = append(metrics, metric)
+			}
+		}
+		if len(metrics) > 0 {
+			family.Metric = metrics
+			filtered = append(filtered, family)
+		}
+	}
+	return filtered, nil
+}
+
+// contextDoer sends the Pushgateway requests with the poll's context.
+type contextDoer struct {
+	ctx context.Context
+}
+
+func (d contextDoer) Do(req *http.Request) (*http.Response, error) {
+	return http.DefaultClient.Do(req.WithContext(d.ctx))
+}
@@ -0,0 +1,128 @@
+//go:build !no_statsd
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// StatsD tag formats.
+const (
+	statsdTagsNone     = "none"
+	statsdTagsDatadog  = "datadog"
+	statsdTagsTelegraf = "telegraf"
+)
+
+type statsdOptions struct {
+	Address   string
+	Prefix    string
+	TagFormat string
+}
+
+var statsdConfig statsdOptions
+
+func init() {
+	registerSink("statsd", sinkRegistration{
+		Flags: func(fs *pflag.FlagSet) {
+			fs.StringVar(&statsdConfig.Address, "statsd-address", "", "StatsD host:port to send readings to over UDP (disabled when empty)")
+			fs.StringVar(&statsdConfig.Prefix, "statsd-prefix", "awair.", "Prefix of the StatsD metric names")
+			fs.StringVar(&statsdConfig.TagFormat, "statsd-tag-format", statsdTagsDatadog, "How the device labels are sent: datadog, telegraf or none (device name in the metric name)")
+		},
+		New: func(app *App) (Sink, error) {
+			if statsdConfig.Address == "" {
+				return nil, nil
+			}
+			return newStatsdSink(statsdConfig)
+		},
+	})
+}
+
+// statsdSink sends every field of a reading as a gauge, one packet per
+// reading.
+type statsdSink struct {
+	conn    net.Conn
+	options statsdOptions
+}
+
+func newStatsdSink(options statsdOptions) (*statsdSink, error) {
+	switch options.TagFormat {
+	case statsdTagsNone, statsdTagsDatadog, statsdTagsTelegraf:
+	default:
+		return nil, fmt.Errorf("invalid statsd-tag-format %q, must be one of %s, %s or %s", options.TagFormat, statsdTagsDatadog, statsdTagsTelegraf, statsdTagsNone)
+	}
+
+	conn, err := net.Dial("udp", options.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdSink{conn: conn, options: options}, nil
+}
+
+// statsdTags returns the device name and its config file labels, sorted by
+// name.
+func statsdTags(device *Device) [][2]string {
+	tags := [][2]string{{"device", device.Name}}
+	names := make([]string, 0, len(device.ExtraLabels))
+	for name := range device.ExtraLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tags = append(tags, [2]string{name, device.ExtraLabels[name]})
+	}
+	return tags
+}
+
+// statsdLine formats a gauge in the sink's tag format.
+func (s *statsdSink) statsdLine(device *Device, field string, value float64) string {
+	name := s.options.Prefix + field
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+
+	switch s.options.TagFormat {
+	case statsdTagsDatadog:
+		tags := []string{}
+		for _, tag := range statsdTags(device) {
+			tags = append(tags, tag[0]+":"+tag[1])
+		}
+		return fmt.Sprintf("%s:%s|g|#%s", name, formatted, strings.Join(tags, ","))
+	case statsdTagsTelegraf:
+		for _, tag := range statsdTags(device) {
+			name += "," + tag[0] + "=" + tag[1]
+		}
+		return fmt.Sprintf("%s:%s|g", name, formatted)
+	default:
+		return fmt.Sprintf("%s%s.%s:%s|g", s.options.Prefix, device.Name, field, formatted)
+	}
+}
+
+func (s *statsdSink) Publish(ctx context.Context, device *Device, stats AwairStats) error {
+	lines := make([]string, 0, len(device.Profile.Fields))
+	for _, field := range device.Profile.Fields {
+		if !hasField(stats, field) {
+			continue
+		}
+		lines = append(lines, s.statsdLine(device, field, fieldValue(stats, field)))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := s.conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	_, err := s.conn.Write([]byte(strings.Join(lines, "\n")))
+	return err
+}
+
+func (s *statsdSink) Close() error {
+	return s.conn.Close()
+}
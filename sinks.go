@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// Sink receives every successful reading, along with the device it came
+// from, in addition to the Prometheus gauges. Sinks should only publish the
+// fields of the device's profile.
+//
+// Optional sinks live in their own sink_<name>.go file guarded by a
+// `//go:build !no_<name>` constraint and call registerSink from init, so a
+// minimal binary can be built with e.g. `go build -tags no_mqtt`.
+type Sink interface {
+	Publish(ctx context.Context, device *Device, stats AwairStats) error
+	Close() error
+}
+
+// sinkRegistration describes a sink compiled into the binary.
+type sinkRegistration struct {
+	// Flags registers the sink's command line options.
+	Flags func(fs *pflag.FlagSet)
+	// New builds the sink from the parsed options. It returns a nil Sink
+	// when the sink has not been configured.
+	New func(app *App) (Sink, error)
+}
+
+var sinkRegistry = map[string]sinkRegistration{}
+
+func registerSink(name string, registration sinkRegistration) {
+	if _, ok := sinkRegistry[name]; ok {
+		panic(fmt.Sprintf("sink %q registered twice", name))
+	}
+	sinkRegistry[name] = registration
+}
+
+// availableSinks returns the names of all sinks compiled into the binary.
+func availableSinks() []string {
+	names := make([]string, 0, len(sinkRegistry))
+	for name := range sinkRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func registerSinkFlags(fs *pflag.FlagSet) {
+	for _, name := range availableSinks() {
+		if flags := sinkRegistry[name].Flags; flags != nil {
+			flags(fs)
+		}
+	}
+}
+
+// initializeSinks builds every configured sink.
+func (app *App) initializeSinks() error {
+	app.Sinks = map[string]Sink{}
+	for _, name := range availableSinks() {
+		sink, err := sinkRegistry[name].New(app)
+		if err != nil {
+			return fmt.Errorf("failed to initialize %s sink: %w", name, err)
+		}
+		if sink == nil {
+			continue
+		}
+		app.Sinks[name] = sink
+		app.Logger.Info("Enabled sink", zap.String("sink", name))
+	}
+	return nil
+}
+
+func (app *App) publishToSinks(ctx context.Context, device *Device, stats AwairStats) {
+	for name, sink := range app.Sinks {
+		if err := sink.Publish(ctx, device, stats); err != nil {
+			app.Logger.Error("Error publishing to sink", zap.String("sink", name), zap.String("device", device.Name), zap.Error(err))
+		}
+	}
+}
+
+func (app *App) closeSinks() {
+	for name, sink := range app.Sinks {
+		if err := sink.Close(); err != nil {
+			app.Logger.Error("Error closing sink", zap.String("sink", name), zap.Error(err))
+		}
+	}
+}
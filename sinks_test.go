@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// recordingSink records the devices it is published readings of.
+type recordingSink struct {
+	devices []string
+	err     error
+	closed  bool
+}
+
+func (s *recordingSink) Publish(ctx context.Context, device *Device, stats AwairStats) error {
+	s.devices = append(s.devices, device.Name)
+	return s.err
+}
+
+func (s *recordingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+// registerTestSink registers a sink under name until the test ends.
+func registerTestSink(t *testing.T, name string, registration sinkRegistration) {
+	t.Helper()
+
+	registerSink(name, registration)
+	t.Cleanup(func() { delete(sinkRegistry, name) })
+}
+
+func TestAvailableSinks(t *testing.T) {
+	sinks := availableSinks()
+	if !sort.StringsAreSorted(sinks) {
+		t.Errorf("availableSinks() = %v, want sorted", sinks)
+	}
+	if len(sinks) != len(sinkRegistry) {
+		t.Errorf("availableSinks() = %v, want every registered sink", sinks)
+	}
+}
+
+func TestRegisterSinkTwice(t *testing.T) {
+	registerTestSink(t, "test", sinkRegistration{})
+	defer func() {
+		if recover() == nil {
+			t.Error("registerSink() of a sink registered already did not panic")
+		}
+	}()
+	registerSink("test", sinkRegistration{})
+}
+
+func TestInitializeSinks(t *testing.T) {
+	var enabled bool
+	configured := &recordingSink{}
+	registerTestSink(t, "test", sinkRegistration{
+		Flags: func(fs *pflag.FlagSet) { fs.BoolVar(&enabled, "test-sink", false, "") },
+		New: func(app *App) (Sink, error) {
+			if !enabled {
+				return nil, nil
+			}
+			return configured, nil
+		},
+	})
+
+	app := newTestApp(t)
+	if _, ok := app.Sinks["test"]; ok {
+		t.Error("unconfigured sink enabled")
+	}
+
+	app = newTestApp(t, "--test-sink")
+	if app.Sinks["test"] != configured {
+		t.Fatal("configured sink not enabled")
+	}
+	app.closeSinks()
+	if !configured.closed {
+		t.Error("closeSinks() did not close the sink")
+	}
+}
+
+func TestInitializeSinksError(t *testing.T) {
+	registerTestSink(t, "test", sinkRegistration{
+		New: func(app *App) (Sink, error) { return nil, errors.New("bad option") },
+	})
+
+	app := &App{Logger: zap.NewNop()}
+	if err := app.initializeSinks(); err == nil {
+		t.Error("initializeSinks() of a misconfigured sink succeeded")
+	}
+}
+
+func TestPublishToSinks(t *testing.T) {
+	app := newTestApp(t)
+	failing := &recordingSink{err: errors.New("unreachable")}
+	working := &recordingSink{}
+	app.Sinks = map[string]Sink{"failing": failing, "working": working}
+	device := addTestDevice(app, "office", "http://office")
+
+	app.publishToSinks(context.Background(), device, AwairStats{Temp: 21.5})
+
+	for name, sink := range map[string]*recordingSink{"failing": failing, "working": working} {
+		if len(sink.devices) != 1 || sink.devices[0] != "office" {
+			t.Errorf("%s sink published %v, want [office]", name, sink.devices)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseSmoothing parses the --smoothing field=alpha pairs. An alpha of 1
+// leaves the readings as they are, lower ones smooth them more.
+func parseSmoothing(values map[string]string) (map[string]float64, error) {
+	alphas := map[string]float64{}
+	for field, value := range values {
+		if !knownFields.has(field) || field == "occupancy" {
+			return nil, fmt.Errorf("invalid smoothing sensor %q, must be one of %s except occupancy", field, strings.Join(knownFields.Fields, ", "))
+		}
+		alpha, err := strconv.ParseFloat(value, 64)
+		if err != nil || alpha <= 0 || alpha > 1 {
+			return nil, fmt.Errorf("invalid smoothing of %s %q, must be a number above 0 and at most 1", field, value)
+		}
+		alphas[field] = alpha
+	}
+	return alphas, nil
+}
+
+// Smoothing holds a device's exponential moving averages of the
+// --smoothing fields.
+type Smoothing struct {
+	mu sync.Mutex
+	// last is the timestamp of the last reading averaged in.
+	last   time.Time
+	values map[string]float64
+}
+
+// smooth replaces the --smoothing fields of the reading with their
+// exponential moving average, seeded with the first reading. A sample the
+// device repeats, not updated since the previous poll, is not averaged in
+// again.
+func (app *App) smooth(device *Device, stats AwairStats) AwairStats {
+	if len(app.SmoothingAlphas) == 0 {
+		return stats
+	}
+
+	s := &device.Smoothing
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = map[string]float64{}
+	}
+	repeated := !stats.Timestamp.IsZero() && stats.Timestamp.Equal(s.last)
+	for field, alpha := range app.SmoothingAlphas {
+		if !hasField(stats, field) {
+			continue
+		}
+		value := fieldValue(stats, field)
+		if previous, ok := s.values[field]; ok {
+			if repeated {
+				value = previous
+			} else {
+				value = previous + alpha*(value-previous)
+			}
+		}
+		s.values[field] = value
+		stats.SetValue(field, value)
+	}
+	s.last = stats.Timestamp
+	return stats
+}
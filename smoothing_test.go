@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSmoothing(t *testing.T) {
+	tests := []struct {
+		values  map[string]string
+		wantErr bool
+	}{
+		{map[string]string{"pm25": "0.3", "co2": "1"}, false},
+		{map[string]string{"pm25": "0"}, true},
+		{map[string]string{"pm25": "1.5"}, true},
+		{map[string]string{"pm25": "high"}, true},
+		{map[string]string{"occupancy": "0.5"}, true},
+		{map[string]string{"heat_index": "0.5"}, true},
+	}
+	for _, tt := range tests {
+		if _, err := parseSmoothing(tt.values); (err != nil) != tt.wantErr {
+			t.Errorf("parseSmoothing(%v) error = %v, want error %v", tt.values, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	app := &App{SmoothingAlphas: map[string]float64{"pm25": 0.25, "temp": 0.5}}
+	device := newDevice("office", "")
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		at       time.Duration
+		pm25     int
+		temp     float64
+		wantPM25 int
+		wantTemp float64
+	}{
+		// The first reading seeds the averages.
+		{0, 4, 20, 4, 20},
+		{10 * time.Second, 40, 22, 13, 21},
+		// A sample repeated by the device is not averaged in again.
+		{10 * time.Second, 40, 22, 13, 21},
+		{20 * time.Second, 4, 21, 11, 21},
+	}
+	for i, tt := range tests {
+		got := app.smooth(device, AwairStats{Timestamp: start.Add(tt.at), Pm25: tt.pm25, Temp: tt.temp, Co2: 600})
+		if got.Pm25 != tt.wantPM25 || got.Temp != tt.wantTemp || got.Co2 != 600 {
+			t.Errorf("smooth() of reading %d = pm25 %d, temp %v, co2 %d, want %d, %v, 600", i, got.Pm25, got.Temp, got.Co2, tt.wantPM25, tt.wantTemp)
+		}
+	}
+}
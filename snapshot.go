@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// stateSnapshotVersion is bumped whenever the snapshot format changes, and
+// snapshots of another version are ignored.
+const stateSnapshotVersion = 1
+
+// stateSnapshot is the --state-file written on shutdown and restored on
+// start, so a restart does not reset the counters or re-fire alerts.
+type stateSnapshot struct {
+	Version int                       `json:"version"`
+	SavedAt time.Time                 `json:"saved_at"`
+	Devices map[string]deviceSnapshot `json:"devices"`
+}
+
+// deviceSnapshot is the state of one device, keyed by its name.
+type deviceSnapshot struct {
+	Counters map[string]float64 `json:"counters"`
+	// Thresholds holds the breach state of each threshold by its sensor
+	// and label, e.g. "co2 >1000", so editing the config keeps the states
+	// of the thresholds left unchanged.
+	Thresholds     map[string]bool                `json:"thresholds,omitempty"`
+	BaselineAlerts map[string]bool                `json:"baseline_alerts,omitempty"`
+	Baselines      map[string][]dailyMeanSnapshot `json:"baselines,omitempty"`
+	Rolling        map[string][]timedValue        `json:"rolling,omitempty"`
+	Scores         []timedValue                   `json:"scores,omitempty"`
+	PM25Hours      []dailyMeanSnapshot            `json:"pm25_hours,omitempty"`
+	Smoothed       map[string]float64             `json:"smoothed,omitempty"`
+	// MoldRisk holds the time at risk of mold growth, in seconds, of the
+	// spans ending at each time.
+	MoldRisk []timedValue `json:"mold_risk,omitempty"`
+}
+
+type timedValue struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// dailyMeanSnapshot is a running mean starting at Start, a day of baseline
+// readings or an hour of PM2.5 readings.
+type dailyMeanSnapshot struct {
+	Start time.Time `json:"start"`
+	Sum   float64   `json:"sum"`
+	Count int       `json:"count"`
+}
+
+// snapshotCounters returns the device's poll counters by name.
+func (app *App) snapshotCounters() map[string]*prometheus.CounterVec {
+	return map[string]*prometheus.CounterVec{
+		"polls":             app.PollsCounter,
+		"poll_errors":       app.PollErrorsCounter,
+		"poll_retries":      app.PollRetriesCounter,
+		"duplicate_samples": app.DuplicateSamplesCounter,
+		"mold_risk_hours":   app.MoldRiskHoursCounter,
+	}
+}
+
+func thresholdKey(t Threshold) string {
+	return t.Sensor + " " + t.Label()
+}
+
+// snapshotDevice captures the device's state. It must not run concurrently
+// with a poll of the device.
+func (app *App) snapshotDevice(device *Device) deviceSnapshot {
+	snapshot := deviceSnapshot{Counters: map[string]float64{}}
+
+	for name, counter := range app.snapshotCounters() {
+		metric := &dto.Metric{}
+		if err := counter.With(device.Labels).Write(metric); err == nil {
+			snapshot.Counters[name] = metric.GetCounter().GetValue()
+		}
+	}
+
+	device.Thresholds.mu.Lock()
+	for i, t := range app.Thresholds {
+		if breached, ok := device.Thresholds.breached[i]; ok {
+			if snapshot.Thresholds == nil {
+				snapshot.Thresholds = map[string]bool{}
+			}
+			snapshot.Thresholds[thresholdKey(t)] = breached
+		}
+	}
+	device.Thresholds.mu.Unlock()
+
+	device.Baselines.mu.Lock()
+	snapshot.BaselineAlerts = device.Baselines.alerted
+	snapshot.Baselines = map[string][]dailyMeanSnapshot{}
+	for sensor, history := range device.Baselines.history {
+		for _, day := range history.days {
+			snapshot.Baselines[sensor] = append(snapshot.Baselines[sensor], dailyMeanSnapshot{Start: day.day, Sum: day.sum, Count: day.count})
+		}
+	}
+	device.Baselines.mu.Unlock()
+
+	device.RollingAverages.mu.Lock()
+	snapshot.Rolling = map[string][]timedValue{}
+	for field, samples := range device.RollingAverages.samples {
+		for _, sample := range samples {
+			snapshot.Rolling[field] = append(snapshot.Rolling[field], timedValue{Time: sample.time, Value: sample.value})
+		}
+	}
+	device.RollingAverages.mu.Unlock()
+
+	device.ScoreHistory.mu.Lock()
+	for _, sample := range device.ScoreHistory.samples {
+		snapshot.Scores = append(snapshot.Scores, timedValue{Time: sample.time, Value: sample.score})
+	}
+	device.ScoreHistory.mu.Unlock()
+
+	device.AQIHistory.mu.Lock()
+	for _, hour := range device.AQIHistory.hours {
+		snapshot.PM25Hours = append(snapshot.PM25Hours, dailyMeanSnapshot{Start: hour.start, Sum: hour.sum, Count: hour.count})
+	}
+	device.AQIHistory.mu.Unlock()
+
+	device.Smoothing.mu.Lock()
+	for field, value := range device.Smoothing.values {
+		if snapshot.Smoothed == nil {
+			snapshot.Smoothed = map[string]float64{}
+		}
+		snapshot.Smoothed[field] = value
+	}
+	device.Smoothing.mu.Unlock()
+
+	device.MoldRisk.mu.Lock()
+	for _, span := range device.MoldRisk.spans {
+		snapshot.MoldRisk = append(snapshot.MoldRisk, timedValue{Time: span.end, Value: span.duration.Seconds()})
+	}
+	device.MoldRisk.mu.Unlock()
+
+	return snapshot
+}
+
+// restoreDevice applies the device's state from the snapshot loaded at
+// start, once, before the device is first polled.
+func (app *App) restoreDevice(device *Device) {
+	app.devicesMu.Lock()
+	snapshot, ok := app.restoredState[device.Name]
+	delete(app.restoredState, device.Name)
+	app.devicesMu.Unlock()
+	if !ok {
+		return
+	}
+
+	for name, counter := range app.snapshotCounters() {
+		if value := snapshot.Counters[name]; value > 0 {
+			counter.With(device.Labels).Add(value)
+		}
+	}
+
+	device.Thresholds.mu.Lock()
+	for i, t := range app.Thresholds {
+		if breached, ok := snapshot.Thresholds[thresholdKey(t)]; ok {
+			if device.Thresholds.breached == nil {
+				device.Thresholds.breached = map[int]bool{}
+			}
+			device.Thresholds.breached[i] = breached
+		}
+	}
+	device.Thresholds.mu.Unlock()
+
+	device.Baselines.mu.Lock()
+	for sensor, alerted := range snapshot.BaselineAlerts {
+		device.Baselines.alerted[sensor] = alerted
+	}
+	for sensor, days := range snapshot.Baselines {
+		history := &baselineHistory{}
+		for _, day := range days {
+			history.days = append(history.days, dailyMean{day: day.Start, sum: day.Sum, count: day.Count})
+		}
+		device.Baselines.history[sensor] = history
+	}
+	device.Baselines.mu.Unlock()
+
+	device.RollingAverages.mu.Lock()
+	for field, samples := range snapshot.Rolling {
+		if device.RollingAverages.samples == nil {
+			device.RollingAverages.samples = map[string][]rollingSample{}
+		}
+		for _, sample := range samples {
+			device.RollingAverages.samples[field] = append(device.RollingAverages.samples[field], rollingSample{time: sample.Time, value: sample.Value})
+		}
+	}
+	device.RollingAverages.mu.Unlock()
+
+	device.ScoreHistory.mu.Lock()
+	for _, sample := range snapshot.Scores {
+		device.ScoreHistory.samples = append(device.ScoreHistory.samples, scoreSample{time: sample.Time, score: sample.Value})
+	}
+	device.ScoreHistory.mu.Unlock()
+
+	device.AQIHistory.mu.Lock()
+	for _, hour := range snapshot.PM25Hours {
+		device.AQIHistory.hours = append(device.AQIHistory.hours, pmHour{start: hour.Start, sum: hour.Sum, count: hour.Count})
+	}
+	device.AQIHistory.mu.Unlock()
+
+	device.Smoothing.mu.Lock()
+	for field, value := range snapshot.Smoothed {
+		if device.Smoothing.values == nil {
+			device.Smoothing.values = map[string]float64{}
+		}
+		device.Smoothing.values[field] = value
+	}
+	device.Smoothing.mu.Unlock()
+
+	device.MoldRisk.mu.Lock()
+	for _, span := range snapshot.MoldRisk {
+		device.MoldRisk.spans = append(device.MoldRisk.spans, moldSpan{end: span.Time, duration: time.Duration(span.Value * float64(time.Second))})
+	}
+	device.MoldRisk.mu.Unlock()
+
+	app.Logger.Info("Restored device state", zap.String("device", device.Name))
+}
+
+// loadState reads the --state-file. A missing file or one of another
+// version leaves nothing to restore.
+func (app *App) loadState() error {
+	if app.StateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(app.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	snapshot := stateSnapshot{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to parse state file %s: %w", app.StateFile, err)
+	}
+	if snapshot.Version != stateSnapshotVersion {
+		app.Logger.Warn("Ignoring state file of another version", zap.String("state_file", app.StateFile), zap.Int("version", snapshot.Version))
+		return nil
+	}
+
+	app.restoredState = snapshot.Devices
+	app.Logger.Info("Loaded state file", zap.String("state_file", app.StateFile), zap.Time("saved_at", snapshot.SavedAt), zap.Int("devices", len(snapshot.Devices)))
+	return nil
+}
+
+// saveState writes the state of every device to the --state-file once the
+// pollers have stopped. The file is replaced atomically so a crash while
+// writing keeps the previous snapshot.
+func (app *App) saveState() error {
+	if app.StateFile == "" {
+		return nil
+	}
+
+	snapshot := stateSnapshot{
+		Version: stateSnapshotVersion,
+		SavedAt: time.Now(),
+		Devices: map[string]deviceSnapshot{},
+	}
+	for _, device := range app.devices() {
+		snapshot.Devices[device.Name] = app.snapshotDevice(device)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(app.StateFile, data); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data, readable by the owner only, so a
+// crash mid-write never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func newSnapshotApp(stateFile string) *App {
+	counter := func(name string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Name: name}, []string{"device"})
+	}
+	above := 1000.0
+	return &App{
+		Logger:                  zap.NewNop(),
+		StateFile:               stateFile,
+		Thresholds:              []Threshold{{Sensor: "co2", Above: &above}},
+		PollsCounter:            counter("polls"),
+		PollErrorsCounter:       counter("poll_errors"),
+		PollRetriesCounter:      counter("poll_retries"),
+		DuplicateSamplesCounter: counter("duplicate_samples"),
+		MoldRiskHoursCounter:    counter("mold_risk_hours"),
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	at := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	app := newSnapshotApp(stateFile)
+	device := newDevice("office", "http://office")
+	device.Labels = prometheus.Labels{"device": "office"}
+	app.Devices = []*Device{device}
+	app.PollsCounter.With(device.Labels).Add(42)
+	app.PollErrorsCounter.With(device.Labels).Add(3)
+	device.Thresholds.breached = map[int]bool{0: true}
+	device.Baselines.alerted["co2"] = true
+	device.RollingAverages.samples = map[string][]rollingSample{"co2": {{time: at, value: 800}}}
+	device.ScoreHistory.samples = []scoreSample{{time: at, score: 85}}
+	device.AQIHistory.hours = []pmHour{{start: at, sum: 24, count: 2}}
+	device.Smoothing.values = map[string]float64{"pm25": 12.5}
+	device.MoldRisk.spans = []moldSpan{{end: at, duration: time.Minute}}
+	app.MoldRiskHoursCounter.With(device.Labels).Add(5)
+
+	if err := app.saveState(); err != nil {
+		t.Fatalf("saveState() error = %v", err)
+	}
+
+	restored := newSnapshotApp(stateFile)
+	if err := restored.loadState(); err != nil {
+		t.Fatalf("loadState() error = %v", err)
+	}
+	device = newDevice("office", "http://office")
+	device.Labels = prometheus.Labels{"device": "office"}
+	restored.restoreDevice(device)
+
+	if got := testutil.ToFloat64(restored.PollsCounter.With(device.Labels)); got != 42 {
+		t.Errorf("polls = %v, want 42", got)
+	}
+	if got := testutil.ToFloat64(restored.PollErrorsCounter.With(device.Labels)); got != 3 {
+		t.Errorf("poll errors = %v, want 3", got)
+	}
+	if !device.Thresholds.breached[0] {
+		t.Error("threshold breach was not restored")
+	}
+	if !device.Baselines.alerted["co2"] {
+		t.Error("baseline alert was not restored")
+	}
+	if samples := device.RollingAverages.samples["co2"]; len(samples) != 1 || !samples[0].time.Equal(at) || samples[0].value != 800 {
+		t.Errorf("rolling samples = %+v, want one of 800 at %s", samples, at)
+	}
+	if len(device.ScoreHistory.samples) != 1 || device.ScoreHistory.samples[0].score != 85 {
+		t.Errorf("score samples = %+v, want one of 85", device.ScoreHistory.samples)
+	}
+	if len(device.AQIHistory.hours) != 1 || device.AQIHistory.hours[0].count != 2 {
+		t.Errorf("PM2.5 hours = %+v, want one of 2 readings", device.AQIHistory.hours)
+	}
+	if got := device.Smoothing.values["pm25"]; got != 12.5 {
+		t.Errorf("smoothed pm25 = %v, want 12.5", got)
+	}
+	if spans := device.MoldRisk.spans; len(spans) != 1 || !spans[0].end.Equal(at) || spans[0].duration != time.Minute {
+		t.Errorf("mold risk spans = %+v, want one of a minute at %s", spans, at)
+	}
+	if got := testutil.ToFloat64(restored.MoldRiskHoursCounter.With(device.Labels)); got != 5 {
+		t.Errorf("mold risk hours = %v, want 5", got)
+	}
+
+	// The state is restored once, so a device started again starts afresh.
+	again := newDevice("office", "http://office")
+	again.Labels = device.Labels
+	restored.restoreDevice(again)
+	if len(again.ScoreHistory.samples) != 0 {
+		t.Error("state was restored twice")
+	}
+}
+
+func TestLoadStateMissingFile(t *testing.T) {
+	app := newSnapshotApp(filepath.Join(t.TempDir(), "missing.json"))
+	if err := app.loadState(); err != nil {
+		t.Fatalf("loadState() error = %v", err)
+	}
+	if len(app.restoredState) != 0 {
+		t.Errorf("restoredState = %v, want empty", app.restoredState)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// spikeMaxRejections is the number of consecutive samples of a sensor
+// rejected before the new level is taken to be real, e.g. a window opened
+// next to the device.
+const spikeMaxRejections = 3
+
+// parseSpikeLimits parses the --spike-limit field=limit pairs.
+func parseSpikeLimits(values map[string]string) (map[string]float64, error) {
+	limits := map[string]float64{}
+	for field, value := range values {
+		if !knownFields.has(field) || field == "occupancy" {
+			return nil, fmt.Errorf("invalid spike-limit sensor %q, must be one of %s except occupancy", field, strings.Join(knownFields.Fields, ", "))
+		}
+		limit, err := strconv.ParseFloat(value, 64)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid spike-limit of %s %q, must be a positive number", field, value)
+		}
+		limits[field] = limit
+	}
+	return limits, nil
+}
+
+type spikeSample struct {
+	time  time.Time
+	value float64
+}
+
+// SpikeFilter holds the last accepted reading of each --spike-limit field
+// of a device.
+type SpikeFilter struct {
+	mu         sync.Mutex
+	accepted   map[string]spikeSample
+	rejections map[string]int
+	// rejected is the time of the last rejected reading, which the device
+	// repeats until its next sample.
+	rejected map[string]time.Time
+}
+
+// filter returns the value to use for a reading, and whether it was
+// rejected for changing faster than limit per minute since the last
+// accepted reading, in which case that reading's value is returned.
+func (f *SpikeFilter) filter(field string, t time.Time, value, limit float64) (float64, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accepted == nil {
+		f.accepted = map[string]spikeSample{}
+		f.rejections = map[string]int{}
+		f.rejected = map[string]time.Time{}
+	}
+
+	last, ok := f.accepted[field]
+	if ok && t.Equal(f.rejected[field]) {
+		return last.value, false
+	}
+	if ok && t.After(last.time) && f.rejections[field] < spikeMaxRejections {
+		rate := math.Abs(value-last.value) / t.Sub(last.time).Minutes()
+		if rate > limit {
+			f.rejections[field]++
+			f.rejected[field] = t
+			return last.value, true
+		}
+	}
+	if !ok || !t.Before(last.time) {
+		f.accepted[field] = spikeSample{time: t, value: value}
+	}
+	f.rejections[field] = 0
+	return value, false
+}
+
+func (app *App) initializeSpikeMetrics() {
+	app.RejectedSamplesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "exporter",
+		Name:      "rejected_samples_total",
+		Help:      "Number of readings of the sensor rejected for changing faster than its --spike-limit",
+	}, append(app.deviceLabelNames(), "sensor"))
+}
+
+func spikeLabels(device *Device, sensor string) prometheus.Labels {
+	labels := prometheus.Labels{"sensor": sensor}
+	for name, value := range device.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// rejectSpikes replaces the --spike-limit fields of the reading that jumped
+// implausibly fast with their last accepted value.
+func (app *App) rejectSpikes(device *Device, stats AwairStats) AwairStats {
+	at := readingTime(stats)
+	for field, limit := range app.SpikeLimits {
+		if !hasField(stats, field) {
+			continue
+		}
+		value, rejected := device.Spikes.filter(field, at, fieldValue(stats, field), limit)
+		if rejected {
+			app.RejectedSamplesCounter.With(spikeLabels(device, field)).Inc()
+			app.Logger.Debug("Rejected spike in device reading", zap.String("device", device.Name), zap.String("sensor", field), zap.Float64("value", fieldValue(stats, field)), zap.Float64("kept", value))
+			stats.SetValue(field, value)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSpikeLimits(t *testing.T) {
+	tests := []struct {
+		values  map[string]string
+		wantErr bool
+	}{
+		{map[string]string{"co2": "1000", "pm25": "50.5"}, false},
+		{map[string]string{"co2": "0"}, true},
+		{map[string]string{"co2": "fast"}, true},
+		{map[string]string{"occupancy": "1"}, true},
+	}
+	for _, tt := range tests {
+		if _, err := parseSpikeLimits(tt.values); (err != nil) != tt.wantErr {
+			t.Errorf("parseSpikeLimits(%v) error = %v, want error %v", tt.values, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSpikeFilter(t *testing.T) {
+	filter := &SpikeFilter{}
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		at           time.Duration
+		value        float64
+		want         float64
+		wantRejected bool
+	}{
+		{0, 600, 600, false},
+		{time.Minute, 700, 700, false},
+		// 7300 ppm in a minute is a glitch.
+		{2 * time.Minute, 8000, 700, true},
+		// The device repeats the sample until its next one.
+		{2 * time.Minute, 8000, 700, false},
+		{3 * time.Minute, 720, 720, false},
+		// A level held for longer than spikeMaxRejections samples is real.
+		{4 * time.Minute, 5000, 720, true},
+		{5 * time.Minute, 5000, 720, true},
+		{6 * time.Minute, 5000, 720, true},
+		{7 * time.Minute, 5000, 5000, false},
+	}
+	for i, tt := range tests {
+		got, rejected := filter.filter("co2", start.Add(tt.at), tt.value, 1000)
+		if got != tt.want || rejected != tt.wantRejected {
+			t.Errorf("filter() of reading %d = %v, %v, want %v, %v", i, got, rejected, tt.want, tt.wantRejected)
+		}
+	}
+}
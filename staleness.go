@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Policies for the climate gauges once the last reading is older than
+// --stale-after, or after --stale-after-failures consecutive failed polls.
+const (
+	// stalePolicyHold keeps serving the last known values.
+	stalePolicyHold = "hold"
+	// stalePolicyExpire stops exporting the climate gauges until the device
+	// responds again.
+	stalePolicyExpire = "expire"
+	// stalePolicyZero resets the climate gauges to zero.
+	stalePolicyZero = "zero"
+	// stalePolicyNaN sets the climate gauges to NaN. Prometheus stores NaN
+	// as an ordinary sample, not a gap, so sum() and avg() over the series
+	// return NaN until the device responds again.
+	stalePolicyNaN = "nan"
+)
+
+func validateStalePolicy(policy string) error {
+	switch policy {
+	case stalePolicyHold, stalePolicyExpire, stalePolicyZero, stalePolicyNaN:
+		return nil
+	default:
+		return fmt.Errorf("invalid stale policy %q, must be one of %s, %s, %s or %s", policy, stalePolicyHold, stalePolicyExpire, stalePolicyZero, stalePolicyNaN)
+	}
+}
+
+// dataAge returns how long ago the last successful reading from the device
+// was taken, and false if there has not been one yet.
+func dataAge(device *Device) (time.Duration, bool) {
+	lastSuccess := device.Status.LastSuccess()
+	if lastSuccess.IsZero() {
+		return 0, false
+	}
+	return time.Since(lastSuccess), true
+}
+
+func (app *App) isStale(device *Device) bool {
+	if app.StaleAfterFailures > 0 && device.Status.ConsecutiveFailures() >= app.StaleAfterFailures {
+		return true
+	}
+
+	age, ok := dataAge(device)
+	return !ok || age > app.StaleAfter
+}
+
+// initializeStalenessMetrics registers the device's staleness gauges and
+// returns them so they can be unregistered with the device.
+func (app *App) initializeStalenessMetrics(device *Device) []prometheus.Collector {
+	staleGauge := promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   app.metricNamespace(),
+		Name:        "data_stale",
+		Help:        "Whether the exported readings are stale per --stale-after or --stale-after-failures (1) or fresh (0)",
+		ConstLabels: device.Labels,
+	}, func() float64 {
+		if app.isStale(device) {
+			return 1
+		}
+		return 0
+	})
+
+	ageGauge := promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   app.metricNamespace(),
+		Name:        "data_age_seconds",
+		Help:        "Seconds since the last successful reading from the device",
+		ConstLabels: device.Labels,
+	}, func() float64 {
+		age, ok := dataAge(device)
+		if !ok {
+			return math.NaN()
+		}
+		return age.Seconds()
+	})
+
+	return []prometheus.Collector{staleGauge, ageGauge}
+}
+
+// climateGauges returns every gauge populated from the device reading that
+// the device profile reports, including the _raw gauges.
+func (app *App) climateGauges(device *Device) []*prometheus.GaugeVec {
+	fields := app.climateFields(device.Profile)
+	gauges := make([]*prometheus.GaugeVec, 0, len(fields))
+	for _, field := range fields {
+		gauges = append(gauges, app.climateGaugeForField(field))
+	}
+	for _, gauge := range app.rawGauges(device) {
+		gauges = append(gauges, gauge)
+	}
+	return gauges
+}
+
+// applyStalePolicy expires or zeroes the device's climate series once its
+// data is stale. Expired series come back with the next successful poll.
+func (app *App) applyStalePolicy(device *Device) {
+	if !app.isStale(device) {
+		if device.climateExpired {
+			device.climateExpired = false
+			app.Logger.Info("Device data is fresh again, restored climate metrics", zap.String("device", device.Name))
+		}
+		return
+	}
+
+	switch app.StalePolicy {
+	case stalePolicyExpire:
+		if device.climateExpired {
+			return
+		}
+		for _, gauge := range app.climateGauges(device) {
+			gauge.Delete(device.Labels)
+		}
+		device.climateExpired = true
+		app.Logger.Warn("Device data is stale, expired climate metrics", zap.String("device", device.Name), zap.Duration("stale_after", app.StaleAfter))
+	case stalePolicyZero:
+		for _, gauge := range app.climateGauges(device) {
+			gauge.With(device.Labels).Set(0)
+		}
+	case stalePolicyNaN:
+		for _, gauge := range app.climateGauges(device) {
+			gauge.With(device.Labels).Set(math.NaN())
+		}
+	}
+}
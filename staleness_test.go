@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestApplyStalePolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		// want is the temperature once stale, missing for an expired series.
+		want    float64
+		expired bool
+	}{
+		{policy: stalePolicyHold, want: 21.5},
+		{policy: stalePolicyExpire, expired: true},
+		{policy: stalePolicyZero, want: 0},
+		{policy: stalePolicyNaN, want: math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			app := newTestApp(t, "--stale-after=1m", "--stale-policy="+tt.policy)
+			fake := newFakeDevice(t)
+			device := addTestDevice(app, "office", fake.address())
+			ctx := context.Background()
+
+			if err := app.poll(ctx, device); err != nil {
+				t.Fatalf("poll() error = %v", err)
+			}
+			if app.isStale(device) {
+				t.Fatal("isStale() = true right after a poll")
+			}
+
+			// Age the reading past --stale-after.
+			device.Status.mu.Lock()
+			device.Status.lastSuccess = time.Now().Add(-time.Hour)
+			device.Status.mu.Unlock()
+			if !app.isStale(device) {
+				t.Fatal("isStale() = false for a reading an hour old")
+			}
+			app.applyStalePolicy(device)
+
+			if tt.expired {
+				if n := testutil.CollectAndCount(app.TempGauge); n != 0 {
+					t.Errorf("temp_c series once stale = %d, want 0", n)
+				}
+			} else {
+				got := testutil.ToFloat64(app.TempGauge.With(device.Labels))
+				if got != tt.want && !(math.IsNaN(got) && math.IsNaN(tt.want)) {
+					t.Errorf("temp_c once stale = %v, want %v", got, tt.want)
+				}
+			}
+
+			// The next successful poll restores the reading.
+			if err := app.poll(ctx, device); err != nil {
+				t.Fatalf("poll() error = %v", err)
+			}
+			if got := testutil.ToFloat64(app.TempGauge.With(device.Labels)); got != 21.5 {
+				t.Errorf("temp_c once fresh again = %v, want 21.5", got)
+			}
+			if device.climateExpired {
+				t.Error("climate metrics still marked expired once fresh again")
+			}
+		})
+	}
+}
+
+func TestStaleAfterFailures(t *testing.T) {
+	app := newTestApp(t, "--stale-after-failures=2", "--stale-policy=nan", "--retry-attempts=1")
+	fake := newFakeDevice(t)
+	device := addTestDevice(app, "office", fake.address())
+	ctx := context.Background()
+
+	if err := app.poll(ctx, device); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+
+	fake.status.Store(http.StatusInternalServerError)
+	if err := app.poll(ctx, device); err == nil {
+		t.Fatal("poll() of a failing device succeeded")
+	}
+	if app.isStale(device) {
+		t.Error("isStale() = true after a single failed poll")
+	}
+	if got := testutil.ToFloat64(app.TempGauge.With(device.Labels)); got != 21.5 {
+		t.Errorf("temp_c after a single failed poll = %v, want 21.5", got)
+	}
+
+	if err := app.poll(ctx, device); err == nil {
+		t.Fatal("poll() of a failing device succeeded")
+	}
+	if !app.isStale(device) {
+		t.Error("isStale() = false after two failed polls")
+	}
+	if got := testutil.ToFloat64(app.TempGauge.With(device.Labels)); !math.IsNaN(got) {
+		t.Errorf("temp_c after two failed polls = %v, want NaN", got)
+	}
+
+	fake.status.Store(http.StatusOK)
+	if err := app.poll(ctx, device); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+	if app.isStale(device) {
+		t.Error("isStale() = true after a successful poll")
+	}
+}
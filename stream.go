@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	streamBuffer       = 16
+	streamWriteTimeout = time.Second * 5
+	streamPingInterval = time.Second * 30
+)
+
+type streamReading struct {
+	Name string     `json:"name"`
+	Data AwairStats `json:"data"`
+}
+
+// StreamHub fans new readings out to the connected /api/v1/stream clients.
+type StreamHub struct {
+	mu          sync.Mutex
+	subscribers map[chan streamReading]string
+	closed      bool
+}
+
+// subscribe returns a channel of new readings from the named device, or from
+// every device if name is empty. It returns nil once the hub is closed.
+func (h *StreamHub) subscribe(name string) chan streamReading {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+	if h.subscribers == nil {
+		h.subscribers = map[chan streamReading]string{}
+	}
+	ch := make(chan streamReading, streamBuffer)
+	h.subscribers[ch] = name
+	return ch
+}
+
+func (h *StreamHub) unsubscribe(ch chan streamReading) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends the reading to every interested subscriber. Readings are
+// dropped for subscribers that have fallen behind rather than holding up
+// the poll.
+func (h *StreamHub) publish(device *Device, stats AwairStats) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch, name := range h.subscribers {
+		if name != "" && name != device.Name {
+			continue
+		}
+		select {
+		case ch <- streamReading{Name: device.Name, Data: stats}:
+		default:
+		}
+	}
+}
+
+// close ends every stream. The server does not close hijacked connections
+// on shutdown, so this is registered with RegisterOnShutdown.
+func (h *StreamHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+var streamUpgrader = websocket.Upgrader{
+	// The stream is read-only, so cross-origin displays are allowed.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// streamHandler upgrades to a WebSocket and sends each new reading of every
+// device, or of the one named by the device query parameter, as a JSON
+// message.
+func (app *App) streamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("device")
+	if name != "" && app.device(name) == nil {
+		http.Error(w, "unknown device", http.StatusNotFound)
+		return
+	}
+
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client.
+		app.Logger.Debug("Error upgrading stream", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	readings := app.Stream.subscribe(name)
+	if readings == nil {
+		return
+	}
+	defer app.Stream.unsubscribe(readings)
+
+	// Drain client messages so close frames and pongs are handled, and stop
+	// once the client goes away.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case reading, ok := <-readings:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(streamWriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(reading); err != nil {
+				app.Logger.Debug("Error writing stream", zap.Error(err))
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// waitForSubscribers waits until the hub has n subscribers.
+func waitForSubscribers(t *testing.T, hub *StreamHub, n int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		hub.mu.Lock()
+		got := len(hub.subscribers)
+		hub.mu.Unlock()
+		if got == n {
+			return
+		}
+	}
+	t.Fatalf("stream never had %d subscribers", n)
+}
+
+func TestStreamHub(t *testing.T) {
+	var hub StreamHub
+	all, office := hub.subscribe(""), hub.subscribe("office")
+
+	hub.publish(newDevice("office", "http://office"), AwairStats{Temp: 21.5})
+	hub.publish(newDevice("kitchen", "http://kitchen"), AwairStats{Temp: 19})
+
+	for _, want := range []string{"office", "kitchen"} {
+		if got := (<-all).Name; got != want {
+			t.Errorf("reading from %s, want %s", got, want)
+		}
+	}
+	if got := (<-office).Name; got != "office" {
+		t.Errorf("reading from %s, want office", got)
+	}
+	select {
+	case reading := <-office:
+		t.Errorf("office subscriber got a reading from %s", reading.Name)
+	default:
+	}
+
+	// A subscriber that has fallen behind does not hold up the others.
+	for i := 0; i < streamBuffer*2; i++ {
+		hub.publish(newDevice("office", "http://office"), AwairStats{})
+	}
+	if got := len(all); got != streamBuffer {
+		t.Errorf("buffered readings = %d, want %d", got, streamBuffer)
+	}
+
+	hub.unsubscribe(office)
+	hub.close()
+	for range all {
+	}
+	if ch := hub.subscribe(""); ch != nil {
+		t.Error("subscribe() after close returned a channel")
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	app := newTestApp(t)
+	fake := newFakeDevice(t)
+	device := addTestDevice(app, "office", fake.address())
+	server := httptest.NewServer(http.HandlerFunc(app.streamHandler))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url+"?device=kitchen", nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("dialing an unknown device: error = %v, want status 404", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?device=office", nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	waitForSubscribers(t, &app.Stream, 1)
+
+	if err := app.poll(context.Background(), device); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+	var reading streamReading
+	if err := conn.ReadJSON(&reading); err != nil {
+		t.Fatalf("ReadJSON() error = %v", err)
+	}
+	if reading.Name != "office" || reading.Data.Temp != 21.5 {
+		t.Errorf("reading = %+v, want 21.5ºC from office", reading)
+	}
+
+	// Shutting down closes the stream.
+	app.Stream.close()
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("ReadMessage() after close error = %v, want going away", err)
+	}
+}
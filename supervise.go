@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// panicRestartDelay is how long a crashed goroutine waits before restarting,
+// to avoid a hot loop when it panics immediately.
+const panicRestartDelay = time.Second
+
+// supervise runs fn until ctx is cancelled, recovering from panics and
+// restarting it so a single bad payload can't silently stop background work.
+func (app *App) supervise(ctx context.Context, name string, fn func(ctx context.Context)) {
+	for {
+		if !app.runRecovered(ctx, name, fn) {
+			return
+		}
+
+		select {
+		case <-time.After(panicRestartDelay):
+			app.Logger.Info("Restarting goroutine after panic", zap.String("goroutine", name))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runRecovered runs fn and reports whether it panicked.
+func (app *App) runRecovered(ctx context.Context, name string, fn func(ctx context.Context)) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			app.PanicsCounter.WithLabelValues(name).Inc()
+			app.Logger.Error("Recovered from panic",
+				zap.String("goroutine", name),
+				zap.String("panic", fmt.Sprint(r)),
+				zap.String("stack", string(debug.Stack())),
+			)
+		}
+	}()
+
+	fn(ctx)
+	return false
+}
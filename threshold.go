@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// defaultHysteresis is the share of the threshold a reading has to move back
+// past it before a breach recovers, unless configured.
+const defaultHysteresis = 0.05
+
+// Threshold is a limit on a climate field from the config file. Exactly one
+// of Above and Below is set.
+type Threshold struct {
+	Sensor     string   `yaml:"sensor"`
+	Above      *float64 `yaml:"above"`
+	Below      *float64 `yaml:"below"`
+	Hysteresis *float64 `yaml:"hysteresis"`
+}
+
+// limit returns the threshold value and whether it is breached from below.
+func (t Threshold) limit() (float64, bool) {
+	if t.Above != nil {
+		return *t.Above, true
+	}
+	return *t.Below, false
+}
+
+// Label identifies the threshold on its series, e.g. >1000.
+func (t Threshold) Label() string {
+	limit, above := t.limit()
+	op := "<"
+	if above {
+		op = ">"
+	}
+	return op + strconv.FormatFloat(limit, 'f', -1, 64)
+}
+
+func (t Threshold) hysteresis() float64 {
+	if t.Hysteresis != nil {
+		return *t.Hysteresis
+	}
+	limit, _ := t.limit()
+	return math.Abs(limit) * defaultHysteresis
+}
+
+// breached returns whether value breaches the threshold, given whether it
+// was already breached. A breach only recovers once the value is back past
+// the threshold by the hysteresis.
+func (t Threshold) breached(value float64, wasBreached bool) bool {
+	limit, above := t.limit()
+	margin := 0.0
+	if wasBreached {
+		margin = t.hysteresis()
+	}
+	if above {
+		return value > limit-margin
+	}
+	return value < limit+margin
+}
+
+func validateThresholds(thresholds []Threshold) error {
+	for _, t := range thresholds {
+		if !profileProvides(knownFields, t.Sensor) {
+			return fmt.Errorf("invalid threshold sensor %q", t.Sensor)
+		}
+		if (t.Above == nil) == (t.Below == nil) {
+			return fmt.Errorf("threshold on %s must set exactly one of above and below", t.Sensor)
+		}
+		if t.Hysteresis != nil && *t.Hysteresis < 0 {
+			return errors.New("threshold hysteresis must not be negative")
+		}
+	}
+	return nil
+}
+
+// profileProvides returns whether a device with the profile reports the
+// climate field, either in its payload or derived from it.
+func profileProvides(profile deviceProfile, field string) bool {
+	for celsius, fahrenheit := range fahrenheitFields {
+		if field == fahrenheit {
+			field = celsius
+		}
+	}
+	for _, derived := range derivedFields {
+		if derived.Field == field {
+			return hasAll(profile, derived.Requires)
+		}
+	}
+	return profile.has(field)
+}
+
+// ThresholdStates keeps which thresholds a device currently breaches.
+type ThresholdStates struct {
+	mu       sync.Mutex
+	breached map[int]bool
+}
+
+// update records whether the threshold is breached and returns whether that
+// changed. A device found in breach on its first reading counts as a change.
+func (s *ThresholdStates) update(i int, t Threshold, value float64) (bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.breached == nil {
+		s.breached = map[int]bool{}
+	}
+	was, known := s.breached[i]
+	now := t.breached(value, was)
+	s.breached[i] = now
+	return now, now != was || (!known && now)
+}
+
+func (app *App) initializeThresholdMetrics() {
+	app.ThresholdBreachedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Name:      "threshold_breached",
+		Help:      "Whether the sensor reading breaches a threshold from the config file (1) or not (0)",
+	}, append(app.deviceLabelNames(), "sensor", "threshold"))
+}
+
+func thresholdLabels(device *Device, t Threshold) prometheus.Labels {
+	labels := prometheus.Labels{"sensor": t.Sensor, "threshold": t.Label()}
+	for name, value := range device.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// recordThresholds refreshes the breach state of every threshold the device
+// has the sensor for, adding crossings to the report and notifying the
+// webhooks of them.
+func (app *App) recordThresholds(device *Device, stats AwairStats) {
+	for i, t := range app.Thresholds {
+		if !profileProvides(device.Profile, t.Sensor) || !hasField(stats, t.Sensor) {
+			continue
+		}
+		value := fieldValue(stats, t.Sensor)
+		breached, changed := device.Thresholds.update(i, t, value)
+		app.ThresholdBreachedGauge.With(thresholdLabels(device, t)).Set(boolToFloat(breached))
+		if changed {
+			event := ThresholdEvent{
+				Device:    device.Name,
+				Labels:    device.ExtraLabels,
+				Sensor:    t.Sensor,
+				Threshold: t.Label(),
+				Value:     value,
+				Breached:  breached,
+				Time:      readingTime(stats),
+			}
+			app.recordReportEvent(device, event)
+			app.notifyThreshold(event)
+		}
+	}
+}
+
+func (app *App) deleteThresholds(device *Device) {
+	for _, t := range app.Thresholds {
+		app.ThresholdBreachedGauge.Delete(thresholdLabels(device, t))
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sampleTimestampGatherer stamps the climate gauges with the time the
+// device took the sample, so Prometheus stores the measurement time rather
+// than the scrape time and drops repeated scrapes of the same sample.
+type sampleTimestampGatherer struct {
+	prometheus.Gatherer
+	app *App
+}
+
+// sampleMetricNames returns the full names of the gauges set straight from a
+// reading. Derived series such as the rolling averages share the climate
+// prefix but are not measurements of the sample.
+func (app *App) sampleMetricNames() map[string]bool {
+	names := map[string]bool{}
+	for _, name := range climateMetricNames {
+		names[app.climatePrefix()+name] = true
+	}
+	for _, name := range derivedMetricNames {
+		names[app.climatePrefix()+name] = true
+	}
+	for field := range app.RawGauges {
+		names[app.climatePrefix()+climateMetricNames[field]+"_raw"] = true
+	}
+	return names
+}
+
+func (g sampleTimestampGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	names := g.app.sampleMetricNames()
+
+	timestamps := map[string]int64{}
+	for _, device := range g.app.devices() {
+		if sampleTime := device.Status.LastSampleTime(); !sampleTime.IsZero() {
+			timestamps[device.Name] = sampleTime.UnixMilli()
+		}
+	}
+
+	for _, family := range families {
+		if !names[family.GetName()] {
+			continue
+		}
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() != "device" {
+					continue
+				}
+				if timestamp, ok := timestamps[label.GetValue()]; ok {
+					metric.TimestampMs = &timestamp
+				}
+			}
+		}
+	}
+
+	return families, err
+}
+
+// isDuplicateSample reports whether the reading is the sample the previous
+// successful poll already recorded, so its gauges and derived metrics need
+// no update. Expired series are always restored from the reading.
+func (app *App) isDuplicateSample(device *Device, stats AwairStats) bool {
+	if stats.Timestamp.IsZero() || device.climateExpired || device.Status.ConsecutiveFailures() > 0 {
+		return false
+	}
+	previous, _ := device.Status.Latest()
+	return previous != nil && previous.Timestamp.Equal(stats.Timestamp)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// tracingFlushInterval is how often the pending poll spans are exported.
+	tracingFlushInterval = time.Second * 5
+	// tracingQueueSize bounds the pending poll spans, dropping new ones
+	// while the collector is unreachable.
+	tracingQueueSize = 1024
+	// exemplarTraceIDLabel is the exemplar label Grafana links to traces by.
+	exemplarTraceIDLabel = "trace_id"
+
+	otlpSpanKindClient  = 3
+	otlpStatusCodeError = 2
+)
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func newOTLPAttribute(key, value string) otlpAttribute {
+	attribute := otlpAttribute{Key: key}
+	attribute.Value.StringValue = value
+	return attribute
+}
+
+// otlpSpan is a span in the OTLP/HTTP JSON encoding, where the trace and
+// span IDs are hex rather than base64.
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// pollSpan is the span of a single poll of a device.
+type pollSpan struct {
+	traceID string
+	spanID  string
+	start   time.Time
+}
+
+type pollSpanKey struct{}
+
+// tracer exports a span per poll to an OTLP/HTTP collector with
+// --tracing-endpoint, in batches so polls never wait on the collector.
+type tracer struct {
+	url     string
+	headers map[string]string
+	spans   chan otlpSpan
+}
+
+func newTracer(endpoint string, headers map[string]string) *tracer {
+	return &tracer{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		headers: headers,
+		spans:   make(chan otlpSpan, tracingQueueSize),
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startPollSpan starts the span of a poll when tracing is enabled, carrying
+// it in the returned context for the poll metrics' exemplars.
+func (app *App) startPollSpan(ctx context.Context) (context.Context, *pollSpan) {
+	if app.tracer == nil {
+		return ctx, nil
+	}
+	span := &pollSpan{traceID: randomHex(16), spanID: randomHex(8), start: time.Now()}
+	return context.WithValue(ctx, pollSpanKey{}, span), span
+}
+
+// endPollSpan queues the span of the poll for export.
+func (app *App) endPollSpan(span *pollSpan, device *Device, err error) {
+	if span == nil {
+		return
+	}
+
+	s := otlpSpan{
+		TraceID:           span.traceID,
+		SpanID:            span.spanID,
+		Name:              "poll",
+		Kind:              otlpSpanKindClient,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes: []otlpAttribute{
+			newOTLPAttribute("device.id", device.Name),
+			newOTLPAttribute("url.full", device.Address),
+		},
+	}
+	if err != nil {
+		s.Status.Code = otlpStatusCodeError
+		s.Status.Message = err.Error()
+	}
+
+	select {
+	case app.tracer.spans <- s:
+	default:
+		app.Logger.Debug("Dropping poll span, the tracing queue is full", zap.String("device", device.Name))
+	}
+}
+
+// pollExemplar returns the exemplar labels linking a poll metric to the
+// poll's trace, or nil when the poll is not traced.
+func pollExemplar(ctx context.Context) prometheus.Labels {
+	span, ok := ctx.Value(pollSpanKey{}).(*pollSpan)
+	if !ok {
+		return nil
+	}
+	return prometheus.Labels{exemplarTraceIDLabel: span.traceID}
+}
+
+// observeWithExemplar observes the value, with the poll's trace ID as an
+// exemplar when traced.
+func observeWithExemplar(ctx context.Context, observer prometheus.Observer, value float64) {
+	if exemplar := pollExemplar(ctx); exemplar != nil {
+		if eo, ok := observer.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(value, exemplar)
+			return
+		}
+	}
+	observer.Observe(value)
+}
+
+// incWithExemplar increments the counter, with the poll's trace ID as an
+// exemplar when traced.
+func incWithExemplar(ctx context.Context, counter prometheus.Counter) {
+	if exemplar := pollExemplar(ctx); exemplar != nil {
+		if adder, ok := counter.(prometheus.ExemplarAdder); ok {
+			adder.AddWithExemplar(1, exemplar)
+			return
+		}
+	}
+	counter.Inc()
+}
+
+// run exports the queued spans every tracingFlushInterval until ctx is done.
+func (t *tracer) run(ctx context.Context, logger *zap.Logger) {
+	ticker := time.NewTicker(tracingFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.flush(ctx); err != nil {
+				logger.Warn("Error exporting poll spans", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// flush exports the queued spans in one request.
+func (t *tracer) flush(ctx context.Context) error {
+	var spans []otlpSpan
+drain:
+	for len(spans) < tracingQueueSize {
+		select {
+		case span := <-t.spans:
+			spans = append(spans, span)
+		default:
+			break drain
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	scope := otlpScopeSpans{Spans: spans}
+	scope.Scope.Name = "awair-local-prom-exporter"
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpAttribute{newOTLPAttribute("service.name", "awair-local-prom-exporter")}
+	traces := otlpTraces{ResourceSpans: []otlpResourceSpans{resource}}
+
+	body, err := json.Marshal(traces)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tracingFlushInterval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, t.url)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+func TestPollSpanExemplars(t *testing.T) {
+	app := &App{Logger: zap.NewNop(), tracer: newTracer("http://localhost:4318", nil)}
+	ctx, span := app.startPollSpan(context.Background())
+
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "poll_duration_seconds", Buckets: []float64{1}})
+	observeWithExemplar(ctx, histogram, 0.5)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "poll_errors_total"})
+	incWithExemplar(ctx, counter)
+
+	metric := &dto.Metric{}
+	if err := histogram.Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	if got := traceIDOf(metric.GetHistogram().GetBucket()[0].GetExemplar()); got != span.traceID {
+		t.Errorf("histogram exemplar trace ID = %q, want %q", got, span.traceID)
+	}
+	metric = &dto.Metric{}
+	if err := counter.Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	if got := traceIDOf(metric.GetCounter().GetExemplar()); got != span.traceID {
+		t.Errorf("counter exemplar trace ID = %q, want %q", got, span.traceID)
+	}
+
+	// Without tracing the metrics are recorded without exemplars.
+	untraced, _ := (&App{}).startPollSpan(context.Background())
+	incWithExemplar(untraced, counter)
+	if got := testutil.ToFloat64(counter); got != 2 {
+		t.Errorf("counter = %v, want 2", got)
+	}
+}
+
+func traceIDOf(exemplar *dto.Exemplar) string {
+	for _, label := range exemplar.GetLabel() {
+		if label.GetName() == exemplarTraceIDLabel {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+func TestTracerFlush(t *testing.T) {
+	var received otlpTraces
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("invalid OTLP payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	app := &App{Logger: zap.NewNop(), tracer: newTracer(server.URL+"/", nil)}
+	device := newDevice("office", "http://office/air-data/latest")
+	_, succeeded := app.startPollSpan(context.Background())
+	app.endPollSpan(succeeded, device, nil)
+	_, failed := app.startPollSpan(context.Background())
+	app.endPollSpan(failed, device, errors.New("timeout"))
+
+	if err := app.tracer.flush(context.Background()); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+	if len(received.ResourceSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("received %+v, want one resource and scope", received)
+	}
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("received %d spans, want 2", len(spans))
+	}
+	if spans[0].TraceID != succeeded.traceID || spans[0].Status.Code != 0 {
+		t.Errorf("spans[0] = %+v, want the successful poll", spans[0])
+	}
+	if spans[1].Status.Code != otlpStatusCodeError || spans[1].Status.Message != "timeout" {
+		t.Errorf("spans[1] status = %+v, want the timeout error", spans[1].Status)
+	}
+
+	// Nothing is sent without new spans.
+	received = otlpTraces{}
+	if err := app.tracer.flush(context.Background()); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+	if len(received.ResourceSpans) != 0 {
+		t.Errorf("flush() without spans sent %+v", received)
+	}
+}
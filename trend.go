@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// scoreDeltaWindows are the look-back windows of the score delta metrics.
+var scoreDeltaWindows = []struct {
+	name   string
+	window time.Duration
+}{
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+}
+
+type scoreSample struct {
+	time  time.Time
+	score float64
+}
+
+// ScoreHistory keeps the scores seen over the longest delta window.
+type ScoreHistory struct {
+	mu      sync.Mutex
+	samples []scoreSample
+}
+
+// add records a score, which may be older than the latest one for a
+// backfilled reading, and drops samples that are no longer needed by any
+// window. One sample older than the longest window is kept as its reference.
+func (h *ScoreHistory) add(t time.Time, score float64, keep time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := sort.Search(len(h.samples), func(i int) bool { return h.samples[i].time.After(t) })
+	h.samples = append(h.samples, scoreSample{})
+	copy(h.samples[i+1:], h.samples[i:])
+	h.samples[i] = scoreSample{time: t, score: score}
+
+	cutoff := h.samples[len(h.samples)-1].time.Add(-keep)
+	drop := 0
+	for drop+1 < len(h.samples) && !h.samples[drop+1].time.After(cutoff) {
+		drop++
+	}
+	h.samples = h.samples[drop:]
+}
+
+// delta returns how much the latest score changed compared to the newest
+// sample at least window old, and false if the history is too short.
+func (h *ScoreHistory) delta(window time.Duration) (float64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) == 0 {
+		return 0, false
+	}
+
+	latest := h.samples[len(h.samples)-1]
+	cutoff := latest.time.Add(-window)
+	for i := len(h.samples) - 1; i >= 0; i-- {
+		if !h.samples[i].time.After(cutoff) {
+			return latest.score - h.samples[i].score, true
+		}
+	}
+	return 0, false
+}
+
+func (app *App) initializeTrendMetrics() {
+	app.ScoreDeltaGauges = map[string]*prometheus.GaugeVec{}
+	for _, w := range scoreDeltaWindows {
+		gauge := promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: app.metricNamespace(),
+			Subsystem: "derived",
+			Name:      "score_delta_" + w.name,
+			Help:      "Change in the Awair Score over the last " + w.name + ", positive when air quality is improving",
+		}, app.deviceLabelNames())
+		app.ScoreDeltaGauges[w.name] = gauge
+	}
+}
+
+// initializeScoreDeltas marks the device's score deltas as unknown until its
+// history covers each window.
+func (app *App) initializeScoreDeltas(device *Device) {
+	for _, gauge := range app.ScoreDeltaGauges {
+		gauge.With(device.Labels).Set(math.NaN())
+	}
+}
+
+func (app *App) deleteScoreDeltas(device *Device) {
+	for _, gauge := range app.ScoreDeltaGauges {
+		gauge.Delete(device.Labels)
+	}
+}
+
+// recordScoreTrend adds the reading's score to the history and refreshes the
+// delta metrics.
+func (app *App) recordScoreTrend(device *Device, stats AwairStats) {
+	if !device.Profile.has("score") {
+		return
+	}
+
+	longest := scoreDeltaWindows[len(scoreDeltaWindows)-1].window
+	device.ScoreHistory.add(readingTime(stats), float64(stats.Score), longest)
+
+	for _, w := range scoreDeltaWindows {
+		if delta, ok := device.ScoreHistory.delta(w.window); ok {
+			app.ScoreDeltaGauges[w.name].With(device.Labels).Set(delta)
+		}
+	}
+}
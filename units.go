@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Temperature units of the exported climate gauges.
+const (
+	temperatureCelsius    = "celsius"
+	temperatureFahrenheit = "fahrenheit"
+	temperatureBoth       = "both"
+)
+
+// fahrenheitFields maps the Celsius payload fields to the derived Fahrenheit
+// series exported with --temperature-unit.
+var fahrenheitFields = map[string]string{
+	"temp":       "temp_f",
+	"dew_point":  "dew_point_f",
+	"heat_index": "heat_index_f",
+	"wet_bulb":   "wet_bulb_f",
+}
+
+// derivedMetricNames are the names of the climate gauges of the Fahrenheit and
+// derived series, without the climate metric prefix.
+var derivedMetricNames = map[string]string{
+	"temp_f":       "temp_f",
+	"dew_point_f":  "dew_point_f",
+	"heat_index":   "heat_index_c",
+	"heat_index_f": "heat_index_f",
+	"humidex":      "humidex",
+	"wet_bulb":     "wet_bulb_c",
+	"wet_bulb_f":   "wet_bulb_f",
+}
+
+// derivedField is a climate series computed from payload fields.
+type derivedField struct {
+	Field    string
+	Requires []string
+}
+
+var derivedFields = []derivedField{
+	{Field: "heat_index", Requires: []string{"temp", "humid"}},
+	{Field: "humidex", Requires: []string{"temp", "humid"}},
+	{Field: "wet_bulb", Requires: []string{"temp", "humid"}},
+}
+
+func validateTemperatureUnit(unit string) error {
+	switch unit {
+	case temperatureCelsius, temperatureFahrenheit, temperatureBoth:
+		return nil
+	}
+	return fmt.Errorf("invalid temperature unit %q, must be one of %s, %s or %s", unit, temperatureCelsius, temperatureFahrenheit, temperatureBoth)
+}
+
+func celsiusToFahrenheit(c float64) float64 {
+	return c*9/5 + 32
+}
+
+// climateFields returns the fields of the climate series exported for a
+// profile, including the series derived from its fields, with temperatures
+// in the units picked by --temperature-unit.
+func (app *App) climateFields(profile deviceProfile) []string {
+	sources := append([]string(nil), profile.Fields...)
+	for _, derived := range derivedFields {
+		if hasAll(profile, derived.Requires) {
+			sources = append(sources, derived.Field)
+		}
+	}
+
+	fields := make([]string, 0, len(sources))
+	for _, field := range sources {
+		fahrenheit, ok := fahrenheitFields[field]
+		if !ok {
+			fields = append(fields, field)
+			continue
+		}
+		if app.TemperatureUnit != temperatureFahrenheit {
+			fields = append(fields, field)
+		}
+		if app.TemperatureUnit != temperatureCelsius {
+			fields = append(fields, fahrenheit)
+		}
+	}
+	return fields
+}
+
+func hasAll(profile deviceProfile, fields []string) bool {
+	for _, field := range fields {
+		if !profile.has(field) {
+			return false
+		}
+	}
+	return true
+}
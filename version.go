@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Build information, set at build time with e.g.
+// -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)".
+var (
+	version string
+	commit  string
+	date    string
+)
+
+type buildInfo struct {
+	Version   string
+	Commit    string
+	Date      string
+	GoVersion string
+}
+
+// currentBuildInfo returns the build information, taking what -ldflags left
+// unset from the module version and VCS details Go embeds, e.g. for binaries
+// built with go install.
+func currentBuildInfo() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version()}
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && embedded.Main.Version != "(devel)" {
+			info.Version = embedded.Main.Version
+		}
+		for _, setting := range embedded.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.Date == "":
+				info.Date = setting.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "unknown"
+	}
+	return info
+}
+
+func (info buildInfo) String() string {
+	return fmt.Sprintf("awair-local-prom-exporter %s (commit %s, built %s, %s %s/%s)",
+		info.Version, orUnknown(info.Commit), orUnknown(info.Date), info.GoVersion, runtime.GOOS, runtime.GOARCH)
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+func (app *App) initializeBuildInfo() {
+	info := currentBuildInfo()
+	promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: app.metricNamespace(),
+		Subsystem: "exporter",
+		Name:      "build_info",
+		Help:      "Constant 1 labelled with the version, commit, build date and Go version the exporter was built from",
+		ConstLabels: prometheus.Labels{
+			"version":    info.Version,
+			"revision":   info.Commit,
+			"build_date": info.Date,
+			"goversion":  info.GoVersion,
+		},
+	}).Set(1)
+}
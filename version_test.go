@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestCurrentBuildInfo(t *testing.T) {
+	defer func(v, c, d string) { version, commit, date = v, c, d }(version, commit, date)
+
+	version, commit, date = "v1.2.3", "abc123", "2024-01-02T03:04:05Z"
+	info := currentBuildInfo()
+	if info.Version != "v1.2.3" || info.Commit != "abc123" || info.Date != "2024-01-02T03:04:05Z" || info.GoVersion == "" {
+		t.Errorf("currentBuildInfo() = %+v, want the -ldflags values", info)
+	}
+
+	// Test binaries carry no module version to fall back to.
+	version, commit, date = "", "", ""
+	if info := currentBuildInfo(); info.Version == "" {
+		t.Errorf("currentBuildInfo().Version is empty, want a fallback")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"go.uber.org/zap"
+)
+
+const unixListenPrefix = "unix://"
+
+// listen opens the listener for --listen, which is either a TCP address
+// served on --port or a unix:// socket path created with --listen-socket-mode.
+func (app *App) listen() (net.Listener, string, error) {
+	if !strings.HasPrefix(app.ListenAddress, unixListenPrefix) {
+		address := net.JoinHostPort(app.ListenAddress, strconv.FormatUint(app.ListenPort, 10))
+		listener, err := net.Listen("tcp", address)
+		return listener, address, err
+	}
+
+	path := strings.TrimPrefix(app.ListenAddress, unixListenPrefix)
+	mode, err := strconv.ParseUint(app.ListenSocketMode, 8, 32)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid listen-socket-mode %q: must be octal permissions", app.ListenSocketMode)
+	}
+
+	// Remove the socket left behind by a previous run that did not shut down
+	// cleanly, but nothing else.
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, "", fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		listener.Close()
+		return nil, "", fmt.Errorf("failed to set permissions of %s: %w", path, err)
+	}
+	return listener, app.ListenAddress, nil
+}
+
+// kitLogger adapts zap to the go-kit logger used by exporter-toolkit.
+type kitLogger struct {
+	logger *zap.Logger
+}
+
+func (l kitLogger) Log(keyvals ...interface{}) error {
+	msg := ""
+	lvl := level.InfoValue()
+	fields := make([]zap.Field, 0, len(keyvals)/2)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		switch value := keyvals[i+1].(type) {
+		case level.Value:
+			lvl = value
+		default:
+			if key == "msg" {
+				msg = fmt.Sprint(value)
+			} else {
+				fields = append(fields, zap.Any(key, value))
+			}
+		}
+	}
+
+	switch lvl {
+	case level.ErrorValue():
+		l.logger.Error(msg, fields...)
+	case level.WarnValue():
+		l.logger.Warn(msg, fields...)
+	case level.DebugValue():
+		l.logger.Debug(msg, fields...)
+	default:
+		l.logger.Info(msg, fields...)
+	}
+	return nil
+}